@@ -0,0 +1,506 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"go-transfer/internal/config"
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+	"go-transfer/internal/infrastructure/system"
+	"go-transfer/internal/infrastructure/web"
+	"go-transfer/internal/transfer/client"
+)
+
+// command 子命令定义
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string)
+}
+
+// commands 按帮助信息中的显示顺序排列
+var commands = []command{
+	{"send", "send <路径> --to URL [--parallel N] [--chunks N] [--delta] [--archive] [--include 模式] [--exclude 模式] [-y]", "发送文件或目录到服务器", cmdSend},
+	{"sync", "sync <目录> URL [--delete] [--dry-run] [--checksum] [--delta] [-y]", "增量同步目录到接收服务器（只发送新增和变化的文件）", cmdSync},
+	{"get", "get <URL/路径> [目标]", "从接收服务器下载文件（支持断点续传）", cmdGet},
+	{"ls", "ls <URL[/目录]> [-r]", "列出接收服务器上的文件", cmdLs},
+	{"receive", "receive [--port 端口] [--dir 目录]", "启动接收服务器", cmdReceive},
+	{"forward", "forward [--port 端口] --to URL [--on-conflict 策略]", "启动转发服务器", cmdForward},
+}
+
+// printUsage 打印帮助信息
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "用法:")
+	fmt.Fprintln(os.Stderr, "  gt [-v|-s|-debug]")
+	fmt.Fprintln(os.Stderr, "      交互式配置向导（需要终端）")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  gt %s\n      %s\n", cmd.usage, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\n使用 gt <命令> -h 查看命令参数。")
+	fmt.Fprintf(os.Stderr, "所有配置项均可通过 %s* 环境变量设置（如 %sTARGET_URL、%sTOKEN），命令行参数优先。\n",
+		config.EnvPrefix, config.EnvPrefix, config.EnvPrefix)
+}
+
+// runCommand 执行子命令
+func runCommand(args []string) {
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage()
+		return
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			cmd.run(args[1:])
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "未知命令: %s\n\n", name)
+	printUsage()
+	os.Exit(2)
+}
+
+// cmdSend gt send <路径> --to URL
+func cmdSend(args []string) {
+	opts := newCommandOptions("send", "client")
+	opts.bindTarget("服务器地址")
+	opts.bindToken()
+	opts.bindClientTLS()
+	opts.bindUpload()
+	opts.bindConflict("服务器上已存在同名文件时的处理方式，覆盖服务器默认策略")
+	opts.fs.BoolVar(&opts.archive, "archive", false, "以单个 tar 归档发送目录，保留权限、修改时间、空目录和符号链接")
+	opts.fs.BoolVar(&opts.compress, "compress", false, "以 gzip 压缩归档（隐含 --archive）")
+	opts.bindFilter()
+	yes := opts.fs.Bool("y", false, "跳过传输确认")
+
+	positional := opts.parse(args)
+	if len(positional) != 1 {
+		opts.fail("需要指定一个要发送的文件或目录")
+	}
+
+	cfg := opts.build()
+	cfg.FilePath = positional[0]
+	if cfg.TargetURL == "" {
+		opts.fail("需要通过 --to 或 %sTARGET_URL 指定服务器地址", config.EnvPrefix)
+	}
+
+	runClient(cfg, *yes)
+}
+
+// cmdSync gt sync <目录> URL
+func cmdSync(args []string) {
+	opts := newCommandOptions("sync", "client")
+	opts.bindTarget("服务器地址（也可作为第二个位置参数）")
+	opts.bindToken()
+	opts.bindClientTLS()
+	opts.bindUpload()
+	opts.bindConflict("变化的文件在服务器上的处理方式（默认 " + constants.ConflictOverwrite + "）")
+	opts.bindFilter()
+	deleteExtra := opts.fs.Bool("delete", false, "删除服务器上存在、本地已不存在的文件和目录")
+	dryRun := opts.fs.Bool("dry-run", false, "只输出同步计划，不做任何修改")
+	checksum := opts.fs.Bool("checksum", false, "大小相同的文件比较摘要而不是修改时间（双方都需要读取文件内容）")
+	yes := opts.fs.Bool("y", false, "跳过同步确认")
+
+	positional := opts.parse(args)
+	if len(positional) < 1 || len(positional) > 2 {
+		opts.fail("需要指定要同步的目录和服务器地址")
+	}
+
+	cfg := opts.build()
+	cfg.FilePath = positional[0]
+	if len(positional) == 2 {
+		cfg.TargetURL = positional[1]
+	}
+	if cfg.TargetURL == "" {
+		opts.fail("需要指定服务器地址（位置参数、--to 或 %sTARGET_URL）", config.EnvPrefix)
+	}
+
+	runSync(cfg, syncOptions{deleteExtra: *deleteExtra, dryRun: *dryRun, checksum: *checksum, assumeYes: *yes})
+}
+
+// cmdGet gt get URL/路径 [目标]
+func cmdGet(args []string) {
+	opts := newCommandOptions("get", "client")
+	opts.bindToken()
+	opts.bindClientTLS()
+
+	positional := opts.parse(args)
+	if len(positional) < 1 || len(positional) > 2 {
+		opts.fail("需要指定下载地址和可选的保存位置")
+	}
+	dest := ""
+	if len(positional) == 2 {
+		dest = positional[1]
+	}
+
+	serverURL, remotePath, err := client.SplitFileURL(positional[0])
+	if err != nil {
+		opts.fail("%v", err)
+	}
+	if remotePath == "" {
+		opts.fail("地址中缺少文件路径: %s", positional[0])
+	}
+	cfg := opts.build()
+
+	transferClient := newRemoteClient(cfg, serverURL)
+	if err := transferClient.Download(remotePath, system.ExpandPath(dest)); err != nil {
+		logger.LogError("%v", err)
+		os.Exit(1)
+	}
+}
+
+// cmdLs gt ls URL[/前缀] [-r]
+func cmdLs(args []string) {
+	opts := newCommandOptions("ls", "client")
+	opts.bindToken()
+	opts.bindClientTLS()
+	recursive := opts.fs.Bool("r", false, "递归列出子目录中的文件")
+
+	positional := opts.parse(args)
+	if len(positional) != 1 {
+		opts.fail("需要指定服务器地址（可带目录路径）")
+	}
+
+	serverURL, prefix, err := client.SplitFileURL(positional[0])
+	if err != nil {
+		opts.fail("%v", err)
+	}
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	transferClient := newRemoteClient(opts.build(), serverURL)
+	if err := transferClient.ListFiles(prefix, *recursive); err != nil {
+		logger.LogError("%v", err)
+		os.Exit(1)
+	}
+}
+
+// newRemoteClient 创建访问服务器存储（下载、列表）的客户端
+func newRemoteClient(cfg *config.Config, serverURL string) *client.TransferClient {
+	tlsConfig, err := web.ClientTLSConfig(cfg.TLS.CA, cfg.TLS.Pin, cfg.TLS.ClientCert, cfg.TLS.ClientKey)
+	if err != nil {
+		logger.LogError("TLS配置错误: %v", err)
+		os.Exit(1)
+	}
+	transferClient := client.NewTransferClient()
+	transferClient.SetServerURL(serverURL)
+	transferClient.SetToken(cfg.Token)
+	transferClient.SetTLSConfig(tlsConfig)
+	return transferClient
+}
+
+// cmdReceive gt receive --port --dir
+func cmdReceive(args []string) {
+	opts := newCommandOptions("receive", "receiver")
+	opts.bindServer()
+	opts.fs.StringVar(&opts.storagePath, "dir", "", "存储目录（默认 "+constants.DefaultStoragePath+"）")
+	opts.bindConflict("同名文件已存在时的默认处理方式（默认 " + constants.ConflictOverwrite + "）")
+	opts.fs.StringVar(&opts.quota, "quota", "", "存储目录总配额，如 500GB（默认不限制）")
+	opts.fs.StringVar(&opts.diskReserve, "disk-reserve", "", "需保留的磁盘剩余空间（默认 "+system.FormatSize(constants.DefaultDiskReserve)+"）")
+	opts.fs.BoolVar(&opts.discardPartials, "discard-partials", false, "停止服务时删除被中止上传的暂存文件（默认保留供续传）")
+	opts.fs.BoolVar(&opts.ignoreMetadata, "ignore-metadata", false, "忽略客户端发送的权限和修改时间，不创建符号链接")
+
+	if len(opts.parse(args)) > 0 {
+		opts.fail("receive 不接受位置参数")
+	}
+
+	cfg := opts.build()
+	if cfg.StoragePath == "" {
+		cfg.StoragePath = constants.DefaultStoragePath
+	}
+	runServer(cfg)
+}
+
+// cmdForward gt forward --port --to
+func cmdForward(args []string) {
+	opts := newCommandOptions("forward", "forward")
+	opts.bindServer()
+	opts.bindTarget("下一跳服务器地址")
+	opts.bindToken()
+	opts.bindClientTLS()
+	opts.bindConflict("上传未指定冲突策略时，转发到下一跳使用的默认策略")
+
+	if len(opts.parse(args)) > 0 {
+		opts.fail("forward 不接受位置参数")
+	}
+
+	cfg := opts.build()
+	if cfg.TargetURL == "" {
+		opts.fail("需要通过 --to 或 %sTARGET_URL 指定下一跳地址", config.EnvPrefix)
+	}
+	runServer(cfg)
+}
+
+// commandOptions 子命令参数，显式设置的参数覆盖配置文件和环境变量
+type commandOptions struct {
+	fs   *flag.FlagSet
+	mode string
+	log  *logFlags
+
+	configFile      string
+	port            int
+	storagePath     string
+	targetURL       string
+	token           string
+	authTokens      tokenList
+	parallel        int
+	chunks          int
+	onConflict      string
+	archive         bool
+	compress        bool
+	delta           bool
+	include         stringList
+	exclude         stringList
+	minSize         string
+	newerThan       string
+	maxFileSize     string
+	quota           string
+	diskReserve     string
+	drainTimeout    string
+	discardPartials bool
+	ignoreMetadata  bool
+	tls             config.TLSConfig
+}
+
+// newCommandOptions 创建子命令参数集合
+func newCommandOptions(name, mode string) *commandOptions {
+	opts := &commandOptions{
+		fs:   flag.NewFlagSet("gt "+name, flag.ExitOnError),
+		mode: mode,
+	}
+	opts.log = addLogFlags(opts.fs)
+	opts.fs.StringVar(&opts.configFile, "config", "", "从YAML配置文件读取参数")
+	return opts
+}
+
+// bindServer 服务器模式参数
+func (o *commandOptions) bindServer() {
+	o.fs.IntVar(&o.port, "port", constants.DefaultPort, "监听端口")
+	o.fs.StringVar(&o.maxFileSize, "max-file-size", "", "单个文件大小上限，如 16GB，0 表示不限制（默认 "+system.FormatSize(constants.DefaultMaxFileSize)+"）")
+	o.fs.StringVar(&o.drainTimeout, "drain-timeout", "", "停止服务时等待进行中传输完成的最长时间（默认 "+constants.DefaultDrainTimeout.String()+"）")
+	o.fs.Var(&o.authTokens, "auth-token", "允许访问的令牌 TOKEN[:read+write[:路径前缀]]，可重复")
+	o.fs.StringVar(&o.tls.Cert, "tls-cert", "", "TLS证书路径")
+	o.fs.StringVar(&o.tls.Key, "tls-key", "", "TLS私钥路径")
+	o.fs.StringVar(&o.tls.ClientCA, "tls-client-ca", "", "校验客户端证书的CA（启用mTLS）")
+	o.fs.BoolVar(&o.tls.AutoCert, "tls-auto-cert", false, "自动生成自签名证书")
+}
+
+// bindUpload 上传并发参数
+func (o *commandOptions) bindUpload() {
+	o.fs.IntVar(&o.parallel, "parallel", constants.DefaultParallel, fmt.Sprintf("目录上传的并发数（最大 %d）", constants.MaxParallel))
+	o.fs.IntVar(&o.chunks, "chunks", constants.DefaultChunks, fmt.Sprintf("大文件切分为N个分块并发上传（最大 %d，小于 %s 的文件不分块）", constants.MaxChunks, system.FormatSize(constants.ChunkThreshold)))
+	o.fs.BoolVar(&o.delta, "delta", false, fmt.Sprintf("服务器上已有旧版本的文件只发送变化的块（不小于 %s 的文件）", system.FormatSize(constants.DeltaMinSize)))
+}
+
+// bindFilter 目录上传的筛选参数
+func (o *commandOptions) bindFilter() {
+	o.fs.Var(&o.include, "include", "目录上传只发送匹配的文件，glob 模式（** 匹配多级目录），可重复")
+	o.fs.Var(&o.exclude, "exclude", "目录上传不发送匹配的文件和目录，可重复（目录中的 "+constants.IgnoreFileName+" 同样生效）")
+	o.fs.StringVar(&o.minSize, "min-size", "", "目录上传只发送不小于该大小的文件，如 1MB")
+	o.fs.StringVar(&o.newerThan, "newer-than", "", "目录上传只发送在此之后修改的文件，如 24h、7d、2024-01-31")
+}
+
+// bindTarget 目标地址参数
+func (o *commandOptions) bindTarget(usage string) {
+	o.fs.StringVar(&o.targetURL, "to", "", usage)
+}
+
+// bindToken 访问服务器/下一跳使用的令牌
+func (o *commandOptions) bindToken() {
+	o.fs.StringVar(&o.token, "token", "", "访问服务器时携带的令牌")
+}
+
+// bindConflict 同名文件冲突策略参数
+func (o *commandOptions) bindConflict(usage string) {
+	o.fs.StringVar(&o.onConflict, "on-conflict", "", usage+"："+strings.Join(config.ConflictPolicies, "、"))
+}
+
+// bindClientTLS 访问https服务器的TLS参数
+func (o *commandOptions) bindClientTLS() {
+	o.fs.StringVar(&o.tls.CA, "tls-ca", "", "校验服务器证书的CA")
+	o.fs.StringVar(&o.tls.Pin, "tls-pin", "", "服务器证书SHA-256指纹")
+	o.fs.StringVar(&o.tls.ClientCert, "tls-client-cert", "", "mTLS客户端证书")
+	o.fs.StringVar(&o.tls.ClientKey, "tls-client-key", "", "mTLS客户端私钥")
+}
+
+// parse 解析参数，允许参数与位置参数交错（如 send 文件 --to URL），
+// -- 之后的参数均为位置参数（如以 - 开头的文件名）
+func (o *commandOptions) parse(args []string) []string {
+	var positional []string
+	for {
+		o.fs.Parse(args)
+		if o.fs.NArg() == 0 {
+			break
+		}
+		if consumed := len(args) - o.fs.NArg(); consumed > 0 && args[consumed-1] == "--" {
+			positional = append(positional, o.fs.Args()...)
+			break
+		}
+		positional = append(positional, o.fs.Arg(0))
+		args = o.fs.Args()[1:]
+	}
+	o.log.apply()
+	return positional
+}
+
+// build 按 配置文件 < 环境变量 < 命令行参数 的优先级生成配置
+func (o *commandOptions) build() *config.Config {
+	cfg := &config.Config{}
+	if o.configFile != "" {
+		loaded, err := config.LoadFile(o.configFile)
+		if err != nil {
+			o.fail("读取配置文件失败: %v", err)
+		}
+		cfg = loaded
+	}
+
+	if err := config.ApplyEnv(cfg); err != nil {
+		o.fail("%v", err)
+	}
+
+	o.fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.Port = o.port
+		case "dir":
+			cfg.StoragePath = o.storagePath
+		case "to":
+			cfg.TargetURL = o.targetURL
+		case "token":
+			cfg.Token = o.token
+		case "auth-token":
+			cfg.Tokens = o.authTokens
+		case "parallel":
+			cfg.Parallel = o.parallel
+		case "chunks":
+			cfg.Chunks = o.chunks
+		case "on-conflict":
+			cfg.OnConflict = o.onConflict
+		case "archive":
+			cfg.Archive = o.archive
+		case "compress":
+			cfg.Compress = o.compress
+		case "delta":
+			cfg.Delta = o.delta
+		case "include":
+			cfg.Include = o.include
+		case "exclude":
+			cfg.Exclude = o.exclude
+		case "min-size":
+			cfg.MinSize = o.minSize
+		case "newer-than":
+			cfg.NewerThan = o.newerThan
+		case "max-file-size":
+			cfg.MaxFileSize = o.maxFileSize
+		case "quota":
+			cfg.Quota = o.quota
+		case "disk-reserve":
+			cfg.DiskReserve = o.diskReserve
+		case "drain-timeout":
+			cfg.DrainTimeout = o.drainTimeout
+		case "discard-partials":
+			cfg.DiscardPartials = o.discardPartials
+		case "ignore-metadata":
+			cfg.IgnoreMetadata = o.ignoreMetadata
+		case "tls-cert":
+			cfg.TLS.Cert = o.tls.Cert
+		case "tls-key":
+			cfg.TLS.Key = o.tls.Key
+		case "tls-client-ca":
+			cfg.TLS.ClientCA = o.tls.ClientCA
+		case "tls-auto-cert":
+			cfg.TLS.AutoCert = o.tls.AutoCert
+		case "tls-ca":
+			cfg.TLS.CA = o.tls.CA
+		case "tls-pin":
+			cfg.TLS.Pin = o.tls.Pin
+		case "tls-client-cert":
+			cfg.TLS.ClientCert = o.tls.ClientCert
+		case "tls-client-key":
+			cfg.TLS.ClientKey = o.tls.ClientKey
+		}
+	})
+
+	cfg.Mode = o.mode
+	if cfg.Port == 0 {
+		cfg.Port = constants.DefaultPort
+	}
+	return cfg
+}
+
+// fail 打印错误和命令用法后退出
+func (o *commandOptions) fail(format string, v ...interface{}) {
+	logger.LogError(format, v...)
+	fmt.Fprintln(os.Stderr)
+	o.fs.Usage()
+	os.Exit(2)
+}
+
+// tokenList 可重复的 --auth-token 参数
+type tokenList []config.APIToken
+
+// String 实现 flag.Value 接口
+func (t *tokenList) String() string {
+	names := make([]string, len(*t))
+	for i := range *t {
+		names[i] = "***"
+	}
+	return strings.Join(names, ",")
+}
+
+// Set 实现 flag.Value 接口
+func (t *tokenList) Set(value string) error {
+	token, err := config.ParseTokenSpec(value)
+	if err != nil {
+		return err
+	}
+	*t = append(*t, token)
+	return nil
+}
+
+// stringList 可重复的字符串参数（--include、--exclude）
+type stringList []string
+
+// String 实现 flag.Value 接口
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+// Set 实现 flag.Value 接口
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// logFlags 日志级别参数
+type logFlags struct {
+	verbose *bool
+	silent  *bool
+	debug   *bool
+}
+
+// addLogFlags 注册日志级别参数
+func addLogFlags(fs *flag.FlagSet) *logFlags {
+	return &logFlags{
+		verbose: fs.Bool("v", false, "详细模式"),
+		silent:  fs.Bool("s", false, "静默模式"),
+		debug:   fs.Bool("debug", false, "调试模式"),
+	}
+}
+
+// apply 设置日志级别（只在显式指定时生效）
+func (l *logFlags) apply() {
+	if *l.debug {
+		logger.GlobalLogger.SetLevel(logger.DEBUG)
+	} else if *l.verbose {
+		logger.GlobalLogger.SetVerbose(true)
+	} else if *l.silent {
+		logger.GlobalLogger.SetSilent(true)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go-transfer/internal/config"
+	"go-transfer/internal/constants"
+)
+
+// sendOptions 与 gt send 注册相同的参数
+func sendOptions() *commandOptions {
+	opts := newCommandOptions("send", "client")
+	opts.bindTarget("")
+	opts.bindToken()
+	opts.bindClientTLS()
+	opts.bindUpload()
+	opts.bindConflict("")
+	opts.bindFilter()
+	opts.fs.Bool("y", false, "")
+	return opts
+}
+
+func TestParsePositional(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"a.txt", "--to", "http://x"}, []string{"a.txt"}},
+		{[]string{"--to", "http://x", "a.txt", "-y"}, []string{"a.txt"}},
+		{[]string{"a", "--parallel", "2", "b"}, []string{"a", "b"}},
+		{[]string{"--to", "http://x", "--", "-file.txt"}, []string{"-file.txt"}},
+		{[]string{"a", "--", "-b", "--to", "c"}, []string{"a", "-b", "--to", "c"}},
+		{[]string{"--", "--"}, []string{"--"}},
+		{[]string{"-y", "--"}, nil},
+	}
+	for _, tt := range tests {
+		if got := sendOptions().parse(tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parse(%q) = %q, 期望 %q", tt.args, got, tt.want)
+		}
+	}
+
+	// -- 之后的参数不被当作参数解析
+	opts := sendOptions()
+	opts.parse([]string{"--", "--to", "http://x"})
+	if opts.targetURL != "" {
+		t.Errorf("-- 之后的 --to 被解析: %q", opts.targetURL)
+	}
+}
+
+func TestBuildPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gt.yaml")
+	os.WriteFile(path, []byte("target_url: http://file\nparallel: 2\nchunks: 3\ntoken: file-token\non_conflict: skip\n"), 0644)
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want config.Config
+	}{
+		{"仅配置文件", nil, nil,
+			config.Config{TargetURL: "http://file", Parallel: 2, Chunks: 3, Token: "file-token", OnConflict: "skip"}},
+		{"环境变量覆盖配置文件", map[string]string{"GT_TARGET_URL": "http://env", "GT_PARALLEL": "4"}, nil,
+			config.Config{TargetURL: "http://env", Parallel: 4, Chunks: 3, Token: "file-token", OnConflict: "skip"}},
+		{"参数覆盖环境变量", map[string]string{"GT_TARGET_URL": "http://env", "GT_PARALLEL": "4"}, []string{"--to", "http://flag", "--parallel", "8"},
+			config.Config{TargetURL: "http://flag", Parallel: 8, Chunks: 3, Token: "file-token", OnConflict: "skip"}},
+		{"参数设为默认值也生效", map[string]string{"GT_CHUNKS": "6"}, []string{"--chunks", "4", "--on-conflict", ""},
+			config.Config{TargetURL: "http://file", Parallel: 2, Chunks: 4, Token: "file-token"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			opts := sendOptions()
+			opts.parse(append([]string{"--config", path}, tt.args...))
+			cfg := opts.build()
+			got := config.Config{TargetURL: cfg.TargetURL, Parallel: cfg.Parallel, Chunks: cfg.Chunks, Token: cfg.Token, OnConflict: cfg.OnConflict}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("配置 = %+v, 期望 %+v", got, tt.want)
+			}
+			if cfg.Mode != "client" || cfg.Port != constants.DefaultPort {
+				t.Errorf("模式和端口 = %s %d", cfg.Mode, cfg.Port)
+			}
+		})
+	}
+}
+
+func TestTokenListFlag(t *testing.T) {
+	opts := newCommandOptions("receive", "receiver")
+	opts.bindServer()
+	if err := opts.fs.Parse([]string{"--auth-token", "a:read", "--auth-token", "b:write:team"}); err != nil {
+		t.Fatal(err)
+	}
+	want := tokenList{{Token: "a", Scopes: []string{"read"}}, {Token: "b", Scopes: []string{"write"}, PathPrefix: "team"}}
+	if !reflect.DeepEqual(opts.authTokens, want) {
+		t.Errorf("令牌 = %+v", opts.authTokens)
+	}
+	if opts.authTokens.String() != "***,***" {
+		t.Errorf("令牌不应明文显示: %s", opts.authTokens.String())
+	}
+
+	// 格式错误的令牌使参数解析失败
+	for _, spec := range []string{"", ":read", "c:admin"} {
+		if err := new(tokenList).Set(spec); err == nil {
+			t.Errorf("令牌 %q 应解析失败", spec)
+		}
+	}
+}
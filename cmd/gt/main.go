@@ -1,36 +1,43 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"go-transfer/internal/config"
+	"go-transfer/internal/constants"
 	"go-transfer/internal/infrastructure/logger"
 	"go-transfer/internal/infrastructure/system"
+	"go-transfer/internal/infrastructure/web"
 	"go-transfer/internal/transfer/client"
 	"go-transfer/internal/transfer/server"
 )
 
+func main() {
+	// 全局参数（可出现在子命令之前）
+	global := flag.NewFlagSet("gt", flag.ExitOnError)
+	global.Usage = printUsage
+	logFlags := addLogFlags(global)
+	global.Parse(os.Args[1:])
+	logFlags.apply()
 
+	// 子命令：非交互运行，适用于脚本、cron、CI、systemd
+	if global.NArg() > 0 {
+		runCommand(global.Args())
+		return
+	}
+
+	// 无参数时运行交互式配置向导，非终端环境下给出用法提示
+	if !system.IsTerminal(os.Stdin) {
+		logger.LogError("非交互环境请使用子命令运行")
+		printUsage()
+		os.Exit(2)
+	}
 
-func main() {
-	// 命令行参数 - 简化处理
-	verbose := flag.Bool("v", false, "详细模式")
-	silent := flag.Bool("s", false, "静默模式")
-	debug := flag.Bool("debug", false, "调试模式")
-	flag.Parse()
-	
-	// 设置日志级别
-	if *debug {
-		logger.GlobalLogger.SetLevel(logger.DEBUG)
-	} else if *verbose {
-		logger.GlobalLogger.SetVerbose(true)
-	} else if *silent {
-		logger.GlobalLogger.SetSilent(true)
-	}
-	
 	// 创建配置管理器
 	cm := config.NewConfigManager()
 
@@ -45,17 +52,11 @@ func main() {
 	switch cfg.Mode {
 	case "client":
 		// 客户端模式 - 上传文件
-		runClient(cfg)
+		runClient(cfg, false)
 
 	case "receiver", "forward":
 		// 服务器模式 - 启动服务
-		ft := &server.FileTransfer{
-			Mode:        cfg.Mode,
-			Port:        cfg.Port,
-			StoragePath: cfg.StoragePath,
-			TargetURL:   cfg.TargetURL,
-		}
-		ft.Start()
+		runServer(cfg)
 
 	default:
 		logger.LogError("未知模式: %s", cfg.Mode)
@@ -63,59 +64,213 @@ func main() {
 	}
 }
 
-// runClient 根据配置运行客户端
-func runClient(cfg *config.Config) {
-	transferClient := client.NewTransferClient()
-	transferClient.SetFilePath(system.ExpandPath(cfg.FilePath))
-	transferClient.SetServerURL(cfg.TargetURL)
-	
+// runServer 根据配置启动服务器
+func runServer(cfg *config.Config) {
+	onConflict, err := config.ParseConflictPolicy(cfg.OnConflict)
+	if err != nil {
+		logger.LogError("%v", err)
+		os.Exit(1)
+	}
+	limits, err := cfg.ParseLimits()
+	if err != nil {
+		logger.LogError("%v", err)
+		os.Exit(1)
+	}
+	drainTimeout, err := cfg.ParseDrainTimeout()
+	if err != nil {
+		logger.LogError("%v", err)
+		os.Exit(1)
+	}
+
+	ft := &server.FileTransfer{
+		Mode:        cfg.Mode,
+		Port:        cfg.Port,
+		StoragePath: cfg.StoragePath,
+		TargetURL:   cfg.TargetURL,
+		Tokens:      cfg.Tokens,
+		Token:       cfg.Token,
+		TLS:         cfg.TLS,
+		OnConflict:  onConflict,
+		MaxFileSize: limits.MaxFileSize,
+		Quota:       limits.Quota,
+		DiskReserve: limits.DiskReserve,
+
+		DrainTimeout:    drainTimeout,
+		DiscardPartials: cfg.DiscardPartials,
+		IgnoreMetadata:  cfg.IgnoreMetadata,
+	}
+	if err := ft.Start(); err != nil {
+		if errors.Is(err, server.ErrTransfersAborted) {
+			os.Exit(constants.ExitTransfersAborted)
+		}
+		os.Exit(1)
+	}
+}
+
+// runClient 根据配置运行客户端，assumeYes 为 true 时跳过确认
+func runClient(cfg *config.Config, assumeYes bool) {
+	transferClient, serverURL := newUploadClient(cfg)
+
 	// 检查文件/目录
 	fileInfo, err := os.Stat(system.ExpandPath(cfg.FilePath))
 	if err != nil {
 		logger.LogError("路径不存在: %s", cfg.FilePath)
 		os.Exit(1)
 	}
-	
+
 	transferClient.SetIsDir(fileInfo.IsDir())
-	
-	// 验证URL
-	serverURL := cfg.TargetURL
-	if !strings.HasPrefix(serverURL, "http://") && !strings.HasPrefix(serverURL, "https://") {
-		serverURL = "http://" + serverURL
-	}
-	serverURL = strings.TrimSuffix(serverURL, "/")
-	transferClient.SetServerURL(serverURL)
-	
+
 	// 显示传输信息
 	fmt.Println()
 	system.PrintSeparator()
 	fmt.Println("📁 准备传输")
 	system.PrintSeparator()
 	if fileInfo.IsDir() {
-		fileCount, totalSize := transferClient.GetDirStats(system.ExpandPath(cfg.FilePath))
+		fileCount, totalSize, excluded := transferClient.GetDirStats(system.ExpandPath(cfg.FilePath))
 		fmt.Printf("📂 目录: %s\n", cfg.FilePath)
 		fmt.Printf("   包含 %d 个文件，总大小: %s\n", fileCount, system.FormatSize(totalSize))
+		if filter := transferClient.FilterSummary(); filter != "" {
+			fmt.Printf("🔍 筛选: %s\n", filter)
+		}
+		if excluded > 0 {
+			fmt.Printf("   已排除 %d 项（排除的目录计为一项）\n", excluded)
+		}
 	} else {
 		fmt.Printf("📄 文件: %s\n", cfg.FilePath)
 		fmt.Printf("   大小: %s\n", system.FormatSize(fileInfo.Size()))
 	}
 	fmt.Printf("🎯 目标: %s\n", serverURL)
-	
+
 	// 确认上传
-	fmt.Print("\n确认开始传输？[Y/n]: ")
-	var confirm string
-	fmt.Scanln(&confirm)
-	confirm = strings.TrimSpace(strings.ToLower(confirm))
-	
-	// 默认为 Y，只有明确输入 n 才取消
-	if confirm == "n" || confirm == "no" {
+	if !assumeYes && !confirm("确认开始传输？") {
 		fmt.Println("已取消传输")
 		return
 	}
-	
+
 	// 执行上传
 	if err := transferClient.Upload(); err != nil {
 		logger.LogError("%v", err)
 		os.Exit(1)
 	}
 }
+
+// newUploadClient 根据配置创建发送文件的客户端，返回补全协议后的服务器地址，配置无效时退出
+func newUploadClient(cfg *config.Config) (*client.TransferClient, string) {
+	transferClient := client.NewTransferClient()
+	transferClient.SetFilePath(system.ExpandPath(cfg.FilePath))
+	transferClient.SetToken(cfg.Token)
+	if cfg.Parallel > 0 {
+		transferClient.SetParallel(cfg.Parallel)
+	}
+	if cfg.Chunks > 0 {
+		transferClient.SetChunks(cfg.Chunks)
+	}
+	onConflict, err := config.ParseConflictPolicy(cfg.OnConflict)
+	if err != nil {
+		logger.LogError("%v", err)
+		os.Exit(1)
+	}
+	transferClient.SetOnConflict(onConflict)
+	transferClient.SetArchive(cfg.Archive)
+	transferClient.SetCompress(cfg.Compress)
+	transferClient.SetDelta(cfg.Delta)
+	minSize, newerThan, err := cfg.ParseFilter(time.Now())
+	if err != nil {
+		logger.LogError("%v", err)
+		os.Exit(1)
+	}
+	if err := transferClient.SetFilter(cfg.Include, cfg.Exclude, minSize, newerThan); err != nil {
+		logger.LogError("%v", err)
+		os.Exit(1)
+	}
+
+	tlsConfig, err := web.ClientTLSConfig(cfg.TLS.CA, cfg.TLS.Pin, cfg.TLS.ClientCert, cfg.TLS.ClientKey)
+	if err != nil {
+		logger.LogError("TLS配置错误: %v", err)
+		os.Exit(1)
+	}
+	transferClient.SetTLSConfig(tlsConfig)
+
+	// 验证URL
+	serverURL := cfg.TargetURL
+	if !strings.HasPrefix(serverURL, "http://") && !strings.HasPrefix(serverURL, "https://") {
+		serverURL = "http://" + serverURL
+	}
+	serverURL = strings.TrimSuffix(serverURL, "/")
+	transferClient.SetServerURL(serverURL)
+	return transferClient, serverURL
+}
+
+// confirm 在终端中请求确认，默认为 Y，只有明确输入 n 才返回 false；
+// 非终端环境无法确认，报错退出而不是默认同意（脚本中使用 -y）
+func confirm(prompt string) bool {
+	if !system.IsTerminal(os.Stdin) {
+		logger.LogError("标准输入不是终端，无法确认，请使用 -y 跳过确认")
+		os.Exit(1)
+	}
+	fmt.Printf("\n%s[Y/n]: ", prompt)
+	var answer string
+	fmt.Scanln(&answer)
+	answer = strings.TrimSpace(strings.ToLower(answer))
+	return answer != "n" && answer != "no"
+}
+
+// syncOptions gt sync 的参数
+type syncOptions struct {
+	deleteExtra bool // 删除接收端多余的条目
+	dryRun      bool // 只输出计划
+	checksum    bool // 比较摘要而不是修改时间
+	assumeYes   bool // 跳过确认
+}
+
+// runSync 比较本地目录与接收端的清单，只发送新增和变化的文件
+func runSync(cfg *config.Config, opts syncOptions) {
+	fileInfo, err := os.Stat(system.ExpandPath(cfg.FilePath))
+	if err != nil || !fileInfo.IsDir() {
+		logger.LogError("需要指定存在的目录: %s", cfg.FilePath)
+		os.Exit(1)
+	}
+	transferClient, serverURL := newUploadClient(cfg)
+	transferClient.SetIsDir(true)
+
+	fmt.Println()
+	system.PrintSeparator()
+	fmt.Println("🔄 准备同步")
+	system.PrintSeparator()
+	fmt.Printf("📂 目录: %s\n", cfg.FilePath)
+	fmt.Printf("🎯 目标: %s\n", serverURL)
+	if filter := transferClient.FilterSummary(); filter != "" {
+		fmt.Printf("🔍 筛选: %s\n", filter)
+	}
+	plan, err := transferClient.PlanSync(opts.deleteExtra, opts.checksum)
+	if err != nil {
+		logger.LogError("%v", err)
+		os.Exit(1)
+	}
+	plan.Print(opts.dryRun)
+
+	switch {
+	case opts.dryRun:
+		fmt.Println("\n（dry-run，未做任何修改）")
+		return
+	case plan.Empty():
+		fmt.Println("\n✅ 服务器上的目录已是最新")
+		return
+	}
+	prompt := "确认开始同步？"
+	if plan.Removals() > 0 {
+		prompt = fmt.Sprintf("确认开始同步（将删除服务器上的 %d 项）？", plan.Removals())
+	}
+	if !opts.assumeYes && !confirm(prompt) {
+		fmt.Println("已取消同步")
+		return
+	}
+
+	fmt.Println()
+	start := time.Now()
+	if err := transferClient.ApplySync(plan); err != nil {
+		logger.LogError("%v", err)
+		os.Exit(1)
+	}
+	fmt.Printf("\n✅ 同步完成！总耗时: %.1f秒\n", time.Since(start).Seconds())
+}
@@ -7,18 +7,183 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
+	"go-transfer/internal/constants"
 	"go-transfer/internal/infrastructure/system"
 )
 
 // Config 简化配置结构
 type Config struct {
-	Mode        string `yaml:"mode"`         // receiver, forward, client
-	Port        int    `yaml:"port"`         // 监听端口（服务器模式）
-	StoragePath string `yaml:"storage_path"` // receiver模式的存储路径
-	TargetURL   string `yaml:"target_url"`   // forward模式的目标URL 或 client模式的服务器地址
-	FilePath    string `yaml:"-"`            // client模式的文件/目录路径（不保存到配置文件）
+	Mode            string     `yaml:"mode"`                       // receiver, forward, client
+	Port            int        `yaml:"port"`                       // 监听端口（服务器模式）
+	StoragePath     string     `yaml:"storage_path"`               // receiver模式的存储路径
+	TargetURL       string     `yaml:"target_url"`                 // forward模式的目标URL 或 client模式的服务器地址
+	FilePath        string     `yaml:"-"`                          // client模式的文件/目录路径（不保存到配置文件）
+	Tokens          []APIToken `yaml:"tokens,omitempty"`           // 服务器模式允许的访问令牌，为空时不启用认证
+	Token           string     `yaml:"token,omitempty"`            // 访问服务器/下一跳时携带的令牌（client、forward模式）
+	TLS             TLSConfig  `yaml:"tls,omitempty"`              // TLS 配置
+	Parallel        int        `yaml:"parallel,omitempty"`         // client模式目录上传的并发数
+	Chunks          int        `yaml:"chunks,omitempty"`           // client模式单个大文件的分块并发数
+	OnConflict      string     `yaml:"on_conflict,omitempty"`      // 同名文件冲突策略（receiver为默认策略，client为本次上传指定的策略）
+	Archive         bool       `yaml:"archive,omitempty"`          // client模式以单个 tar 归档发送目录
+	Compress        bool       `yaml:"compress,omitempty"`         // client模式以 gzip 压缩归档（隐含 archive）
+	Delta           bool       `yaml:"delta,omitempty"`            // client模式对接收端已有旧版本的大文件只发送变化的块
+	Include         []string   `yaml:"include,omitempty"`          // client模式目录上传只发送匹配的文件（glob，支持 **）
+	Exclude         []string   `yaml:"exclude,omitempty"`          // client模式目录上传不发送匹配的文件和目录
+	MinSize         string     `yaml:"min_size,omitempty"`         // client模式目录上传只发送不小于该大小的文件，如 1MB
+	NewerThan       string     `yaml:"newer_than,omitempty"`       // client模式目录上传只发送在此之后修改的文件，如 24h、7d、2024-01-31
+	MaxFileSize     string     `yaml:"max_file_size,omitempty"`    // 服务器模式单个文件大小上限，如 16GB，0 表示不限制
+	Quota           string     `yaml:"quota,omitempty"`            // receiver模式存储目录的总配额，如 500GB，为空表示不限制
+	DiskReserve     string     `yaml:"disk_reserve,omitempty"`     // receiver模式需保留的磁盘剩余空间，默认 1GB
+	DrainTimeout    string     `yaml:"drain_timeout,omitempty"`    // 服务器模式停止时等待进行中传输完成的最长时间，默认 30s
+	DiscardPartials bool       `yaml:"discard_partials,omitempty"` // receiver模式停止时删除被中止上传的暂存文件（默认保留供续传）
+	IgnoreMetadata  bool       `yaml:"ignore_metadata,omitempty"`  // receiver模式忽略客户端发送的权限和修改时间，不创建符号链接
+}
+
+// Limits 解析后的存储限制（字节）
+type Limits struct {
+	MaxFileSize int64 // 单个文件大小上限，0 表示不限制
+	Quota       int64 // 存储目录总配额，0 表示不限制
+	DiskReserve int64 // 需保留的磁盘剩余空间
+}
+
+// ParseLimits 解析大小上限、配额和磁盘保留空间，未配置的项使用默认值
+func (c *Config) ParseLimits() (Limits, error) {
+	limits := Limits{MaxFileSize: constants.DefaultMaxFileSize, DiskReserve: constants.DefaultDiskReserve}
+	settings := []struct {
+		name   string
+		value  string
+		target *int64
+	}{
+		{"max_file_size", c.MaxFileSize, &limits.MaxFileSize},
+		{"quota", c.Quota, &limits.Quota},
+		{"disk_reserve", c.DiskReserve, &limits.DiskReserve},
+	}
+	for _, setting := range settings {
+		if strings.TrimSpace(setting.value) == "" {
+			continue
+		}
+		size, err := system.ParseSize(setting.value)
+		if err != nil {
+			return limits, fmt.Errorf("%s 无效: %v", setting.name, err)
+		}
+		*setting.target = size
+	}
+	return limits, nil
+}
+
+// ParseDrainTimeout 解析停止服务时的等待时间，未配置时使用默认值
+func (c *Config) ParseDrainTimeout() (time.Duration, error) {
+	if strings.TrimSpace(c.DrainTimeout) == "" {
+		return constants.DefaultDrainTimeout, nil
+	}
+	timeout, err := time.ParseDuration(strings.TrimSpace(c.DrainTimeout))
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("drain_timeout 无效: %q（示例: 30s、2m）", c.DrainTimeout)
+	}
+	return timeout, nil
+}
+
+// ParseFilter 解析目录上传的大小和修改时间筛选条件，未配置的项返回零值
+func (c *Config) ParseFilter(now time.Time) (int64, time.Time, error) {
+	var minSize int64
+	var newerThan time.Time
+	if value := strings.TrimSpace(c.MinSize); value != "" {
+		size, err := system.ParseSize(value)
+		if err != nil {
+			return 0, newerThan, fmt.Errorf("min_size 无效: %v", err)
+		}
+		minSize = size
+	}
+	if value := strings.TrimSpace(c.NewerThan); value != "" {
+		parsed, err := parseNewerThan(value, now)
+		if err != nil {
+			return 0, newerThan, fmt.Errorf("newer_than 无效: %q（示例: 24h、7d、2024-01-31、2024-01-31T08:00:00+08:00）", c.NewerThan)
+		}
+		newerThan = parsed
+	}
+	return minSize, newerThan, nil
+}
+
+// parseNewerThan 解析相对时长（Go 时长格式或 Nd 天数）或绝对时间（日期按本地时区）
+func parseNewerThan(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// ConflictPolicies 可选的同名文件冲突策略
+var ConflictPolicies = []string{
+	constants.ConflictOverwrite,
+	constants.ConflictSkip,
+	constants.ConflictFail,
+	constants.ConflictRename,
+	constants.ConflictVersion,
+}
+
+// ParseConflictPolicy 校验冲突策略（不区分大小写），空值表示使用默认策略
+func ParseConflictPolicy(value string) (string, error) {
+	policy := strings.ToLower(strings.TrimSpace(value))
+	if policy == "" {
+		return "", nil
+	}
+	for _, p := range ConflictPolicies {
+		if policy == p {
+			return policy, nil
+		}
+	}
+	return "", fmt.Errorf("未知冲突策略: %s（可选 %s）", value, strings.Join(ConflictPolicies, "、"))
+}
+
+// TLSConfig TLS 相关配置
+type TLSConfig struct {
+	// 服务器模式
+	Cert     string `yaml:"cert,omitempty"`      // 证书路径
+	Key      string `yaml:"key,omitempty"`       // 私钥路径
+	ClientCA string `yaml:"client_ca,omitempty"` // 校验客户端证书的CA，设置后启用mTLS
+	AutoCert bool   `yaml:"auto_cert,omitempty"` // 未配置证书时自动生成自签名证书
+
+	// 客户端（client 模式及 forward 模式访问下一跳）
+	CA         string `yaml:"ca,omitempty"`          // 校验服务器证书的CA
+	Pin        string `yaml:"pin,omitempty"`         // 固定服务器证书的SHA-256指纹
+	ClientCert string `yaml:"client_cert,omitempty"` // mTLS 客户端证书
+	ClientKey  string `yaml:"client_key,omitempty"`  // mTLS 客户端私钥
+}
+
+// Enabled 判断服务器是否启用TLS
+func (t *TLSConfig) Enabled() bool {
+	return (t.Cert != "" && t.Key != "") || t.AutoCert
+}
+
+// APIToken 访问令牌及其权限
+type APIToken struct {
+	Token      string   `yaml:"token"`
+	PathPrefix string   `yaml:"path_prefix,omitempty"` // 仅允许访问该前缀下的路径，为空表示不限制
+	Scopes     []string `yaml:"scopes,omitempty"`      // read、write，为空表示全部权限
+}
+
+// HasScope 判断令牌是否具有指定权限
+func (t *APIToken) HasScope(scope string) bool {
+	if len(t.Scopes) == 0 {
+		return true
+	}
+	for _, s := range t.Scopes {
+		if strings.EqualFold(s, scope) {
+			return true
+		}
+	}
+	return false
 }
 
 // ConfigManager 配置管理器
@@ -279,16 +444,18 @@ func (cm *ConfigManager) displayConfig(config *Config) {
 	case "receiver":
 		fmt.Printf("  端口: %d\n", config.Port)
 		fmt.Printf("  存储: %s\n", system.ExpandPath(config.StoragePath))
+		cm.displayAuth(config)
+		cm.displayLimits(config)
 		fmt.Println("\n硬编码参数:")
 		fmt.Println("  监听地址: 0.0.0.0")
-		fmt.Println("  最大文件: 16GB")
 		
 	case "forward":
 		fmt.Printf("  端口: %d\n", config.Port)
 		fmt.Printf("  目标: %s\n", config.TargetURL)
+		cm.displayAuth(config)
+		cm.displayLimits(config)
 		fmt.Println("\n硬编码参数:")
 		fmt.Println("  监听地址: 0.0.0.0")
-		fmt.Println("  最大文件: 16GB")
 		
 	case "client":
 		fmt.Printf("  服务器: %s\n", config.TargetURL)
@@ -297,3 +464,26 @@ func (cm *ConfigManager) displayConfig(config *Config) {
 	fmt.Println()
 }
 
+// displayLimits 显示文件大小上限和存储配额
+func (cm *ConfigManager) displayLimits(config *Config) {
+	maxFileSize := config.MaxFileSize
+	if maxFileSize == "" {
+		maxFileSize = system.FormatSize(constants.DefaultMaxFileSize)
+	}
+	fmt.Printf("  最大文件: %s\n", maxFileSize)
+	if config.Mode == "receiver" && config.Quota != "" {
+		fmt.Printf("  存储配额: %s\n", config.Quota)
+	}
+}
+
+// displayAuth 显示认证配置（不显示令牌内容）
+func (cm *ConfigManager) displayAuth(config *Config) {
+	if len(config.Tokens) > 0 {
+		fmt.Printf("  认证: 已启用 (%d 个令牌)\n", len(config.Tokens))
+	} else {
+		fmt.Println("  认证: 未启用")
+	}
+	if config.Mode == "forward" && config.Token != "" {
+		fmt.Println("  下一跳令牌: 已配置")
+	}
+}
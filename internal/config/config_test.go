@@ -0,0 +1,84 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"go-transfer/internal/constants"
+)
+
+func TestParseLimits(t *testing.T) {
+	tests := []struct {
+		cfg     Config
+		want    Limits
+		wantErr bool
+	}{
+		{Config{}, Limits{MaxFileSize: constants.DefaultMaxFileSize, DiskReserve: constants.DefaultDiskReserve}, false},
+		{Config{MaxFileSize: "0", Quota: "1.5KB", DiskReserve: " 2m "}, Limits{Quota: 1536, DiskReserve: 2 << 20}, false},
+		{Config{Quota: "10GiB"}, Limits{MaxFileSize: constants.DefaultMaxFileSize, Quota: 10 << 30, DiskReserve: constants.DefaultDiskReserve}, false},
+		{Config{MaxFileSize: "big"}, Limits{}, true},
+		{Config{Quota: "-1GB"}, Limits{}, true},
+		{Config{DiskReserve: "1XB"}, Limits{}, true},
+	}
+	for _, tt := range tests {
+		got, err := tt.cfg.ParseLimits()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLimits(%+v) 错误 = %v, 期望出错 %v", tt.cfg, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParseLimits(%+v) = %+v, 期望 %+v", tt.cfg, got, tt.want)
+		}
+	}
+}
+
+func TestParseDrainTimeout(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", constants.DefaultDrainTimeout, false},
+		{"0s", 0, false},
+		{" 2m ", 2 * time.Minute, false},
+		{"30", 0, true},
+		{"-5s", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := (&Config{DrainTimeout: tt.value}).ParseDrainTimeout()
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("ParseDrainTimeout(%q) = %v, %v", tt.value, got, err)
+		}
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		minSize, newerThan string
+		wantSize           int64
+		wantTime           time.Time
+		wantErr            bool
+	}{
+		{"", "", 0, time.Time{}, false},
+		{"1MB", "24h", 1 << 20, now.Add(-24 * time.Hour), false},
+		{"", "7d", 0, now.AddDate(0, 0, -7), false},
+		{"", "2024-01-31", 0, time.Date(2024, 1, 31, 0, 0, 0, 0, time.Local), false},
+		{"", "2024-01-31T08:00:00+08:00", 0, time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), false},
+		{"lots", "", 0, time.Time{}, true},
+		{"", "-3d", 0, time.Time{}, true},
+		{"", "-1h", 0, time.Time{}, true},
+		{"", "1.5d", 0, time.Time{}, true},
+		{"", "yesterday", 0, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		size, newer, err := (&Config{MinSize: tt.minSize, NewerThan: tt.newerThan}).ParseFilter(now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFilter(%q, %q) 错误 = %v, 期望出错 %v", tt.minSize, tt.newerThan, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (size != tt.wantSize || !newer.Equal(tt.wantTime)) {
+			t.Errorf("ParseFilter(%q, %q) = %d, %v", tt.minSize, tt.newerThan, size, newer)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix 环境变量前缀
+const EnvPrefix = "GT_"
+
+// LoadFile 从指定的YAML文件加载配置（非交互）
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %v", err)
+	}
+	return &config, nil
+}
+
+// ApplyEnv 使用 GT_* 环境变量覆盖配置，变量名为YAML键名的大写形式
+func ApplyEnv(config *Config) error {
+	lookupString("MODE", &config.Mode)
+	lookupString("STORAGE_PATH", &config.StoragePath)
+	lookupString("TARGET_URL", &config.TargetURL)
+	lookupString("TOKEN", &config.Token)
+	lookupString("ON_CONFLICT", &config.OnConflict)
+	lookupString("MAX_FILE_SIZE", &config.MaxFileSize)
+	lookupString("QUOTA", &config.Quota)
+	lookupString("DISK_RESERVE", &config.DiskReserve)
+	lookupString("DRAIN_TIMEOUT", &config.DrainTimeout)
+	lookupString("MIN_SIZE", &config.MinSize)
+	lookupString("NEWER_THAN", &config.NewerThan)
+	lookupList("INCLUDE", &config.Include)
+	lookupList("EXCLUDE", &config.Exclude)
+
+	if err := lookupInt("PORT", &config.Port); err != nil {
+		return err
+	}
+
+	if err := lookupInt("PARALLEL", &config.Parallel); err != nil {
+		return err
+	}
+	if err := lookupInt("CHUNKS", &config.Chunks); err != nil {
+		return err
+	}
+	if err := lookupBool("DISCARD_PARTIALS", &config.DiscardPartials); err != nil {
+		return err
+	}
+	if err := lookupBool("IGNORE_METADATA", &config.IgnoreMetadata); err != nil {
+		return err
+	}
+	if err := lookupBool("ARCHIVE", &config.Archive); err != nil {
+		return err
+	}
+	if err := lookupBool("COMPRESS", &config.Compress); err != nil {
+		return err
+	}
+	if err := lookupBool("DELTA", &config.Delta); err != nil {
+		return err
+	}
+
+	// 多个令牌以逗号分隔，格式同 ParseTokenSpec
+	if value, ok := lookup("TOKENS"); ok {
+		config.Tokens = nil
+		for _, spec := range strings.Split(value, ",") {
+			if strings.TrimSpace(spec) == "" {
+				continue
+			}
+			token, err := ParseTokenSpec(spec)
+			if err != nil {
+				return fmt.Errorf("%sTOKENS 无效: %v", EnvPrefix, err)
+			}
+			config.Tokens = append(config.Tokens, token)
+		}
+	}
+
+	lookupString("TLS_CERT", &config.TLS.Cert)
+	lookupString("TLS_KEY", &config.TLS.Key)
+	lookupString("TLS_CLIENT_CA", &config.TLS.ClientCA)
+	lookupString("TLS_CA", &config.TLS.CA)
+	lookupString("TLS_PIN", &config.TLS.Pin)
+	lookupString("TLS_CLIENT_CERT", &config.TLS.ClientCert)
+	lookupString("TLS_CLIENT_KEY", &config.TLS.ClientKey)
+	if err := lookupBool("TLS_AUTO_CERT", &config.TLS.AutoCert); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ParseTokenSpec 解析命令行/环境变量中的令牌，格式为 TOKEN[:SCOPES[:PREFIX]]，
+// 多个权限以 + 分隔，例如 "s3cret:write:team-a" 或 "viewer:read"
+func ParseTokenSpec(spec string) (APIToken, error) {
+	parts := strings.SplitN(strings.TrimSpace(spec), ":", 3)
+	token := APIToken{Token: parts[0]}
+	if token.Token == "" {
+		return token, fmt.Errorf("令牌不能为空")
+	}
+
+	if len(parts) > 1 && parts[1] != "" {
+		for _, scope := range strings.Split(parts[1], "+") {
+			scope = strings.ToLower(strings.TrimSpace(scope))
+			if scope != "read" && scope != "write" {
+				return token, fmt.Errorf("未知权限: %s", scope)
+			}
+			token.Scopes = append(token.Scopes, scope)
+		}
+	}
+	if len(parts) > 2 {
+		token.PathPrefix = parts[2]
+	}
+	return token, nil
+}
+
+// lookup 读取 GT_ 前缀的环境变量
+func lookup(name string) (string, bool) {
+	return os.LookupEnv(EnvPrefix + name)
+}
+
+// lookupString 存在对应环境变量时覆盖字符串配置
+func lookupString(name string, target *string) {
+	if value, ok := lookup(name); ok {
+		*target = value
+	}
+}
+
+// lookupList 存在对应环境变量时以逗号分隔覆盖列表配置
+func lookupList(name string, target *[]string) {
+	value, ok := lookup(name)
+	if !ok {
+		return
+	}
+	*target = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*target = append(*target, item)
+		}
+	}
+}
+
+// lookupInt 存在对应环境变量时覆盖整数配置
+func lookupInt(name string, target *int) error {
+	value, ok := lookup(name)
+	if !ok {
+		return nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%s%s 无效: %s", EnvPrefix, name, value)
+	}
+	*target = parsed
+	return nil
+}
+
+// lookupBool 存在对应环境变量时覆盖布尔配置
+func lookupBool(name string, target *bool) error {
+	value, ok := lookup(name)
+	if !ok {
+		return nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("%s%s 无效: %s", EnvPrefix, name, value)
+	}
+	*target = parsed
+	return nil
+}
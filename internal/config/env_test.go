@@ -0,0 +1,84 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseTokenSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    APIToken
+		wantErr bool
+	}{
+		{"s3cret", APIToken{Token: "s3cret"}, false},
+		{" viewer:read ", APIToken{Token: "viewer", Scopes: []string{"read"}}, false},
+		{"t:READ+write:team-a", APIToken{Token: "t", Scopes: []string{"read", "write"}, PathPrefix: "team-a"}, false},
+		{"t::team-a", APIToken{Token: "t", PathPrefix: "team-a"}, false},
+		{"t:write:a:b", APIToken{Token: "t", Scopes: []string{"write"}, PathPrefix: "a:b"}, false},
+		{"", APIToken{}, true},
+		{":read", APIToken{}, true},
+		{"t:admin", APIToken{}, true},
+		{"t:read+", APIToken{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTokenSpec(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTokenSpec(%q) 错误 = %v, 期望出错 %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseTokenSpec(%q) = %+v, 期望 %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestApplyEnvOverridesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gt.yaml")
+	os.WriteFile(path, []byte("port: 9000\ntarget_url: http://file\nparallel: 2\nexclude: [a]\n"), 0644)
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(EnvPrefix+"TARGET_URL", "http://env")
+	t.Setenv(EnvPrefix+"EXCLUDE", "*.tmp, ,build/")
+	t.Setenv(EnvPrefix+"TOKENS", "a:read,b:write:team,")
+	t.Setenv(EnvPrefix+"DELTA", "true")
+	if err := ApplyEnv(cfg); err != nil {
+		t.Fatal(err)
+	}
+	// 未设置环境变量的项保留配置文件中的值
+	if cfg.Port != 9000 || cfg.Parallel != 2 {
+		t.Errorf("配置文件中的值被覆盖: port=%d parallel=%d", cfg.Port, cfg.Parallel)
+	}
+	if cfg.TargetURL != "http://env" || !cfg.Delta || !reflect.DeepEqual(cfg.Exclude, []string{"*.tmp", "build/"}) {
+		t.Errorf("环境变量未生效: %+v", cfg)
+	}
+	want := []APIToken{{Token: "a", Scopes: []string{"read"}}, {Token: "b", Scopes: []string{"write"}, PathPrefix: "team"}}
+	if !reflect.DeepEqual(cfg.Tokens, want) {
+		t.Errorf("令牌 = %+v", cfg.Tokens)
+	}
+}
+
+func TestApplyEnvRejectsInvalid(t *testing.T) {
+	tests := []struct{ name, value string }{
+		{"PORT", "http"},
+		{"PARALLEL", "2.5"},
+		{"CHUNKS", ""},
+		{"DELTA", "maybe"},
+		{"TLS_AUTO_CERT", "yes"},
+		{"TOKENS", "a:read,:write"},
+		{"TOKENS", "a:admin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+"="+tt.value, func(t *testing.T) {
+			t.Setenv(EnvPrefix+tt.name, tt.value)
+			if err := ApplyEnv(&Config{}); err == nil {
+				t.Errorf("%s%s=%q 应返回错误", EnvPrefix, tt.name, tt.value)
+			}
+		})
+	}
+}
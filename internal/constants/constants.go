@@ -37,6 +37,10 @@ const (
 	MaxIdleConnsPerHost = 1
 	MaxConnsPerHost     = 1
 
+	// 并发上传（目录上传的工作协程数，每个协程占用一个连接）
+	DefaultParallel = 1
+	MaxParallel     = 32
+
 	// 重试相关
 	MaxRetries      = 3
 	PortExhaustWait = 5 * time.Second
@@ -48,6 +52,145 @@ const (
 	DirPermission  = 0755
 	FilePermission = 0644
 
+	// 断点续传与暂存
+	PartialSuffix      = ".gtpart"         // 未完成上传的暂存文件后缀
+	HeaderUploadOffset = "X-Upload-Offset" // 接收端已提交的字节偏移
+	StaleStagingAge    = 24 * time.Hour    // 超过该时间未更新的暂存文件视为过期
+
+	// 完整性校验
+	HeaderContentDigest = "X-Content-Digest" // 文件摘要，格式为 "算法=十六进制"
+	HeaderContentLength = "X-Content-Length" // 分块编码（携带trailer）时声明的数据长度
+	QuarantineDir       = ".gtquarantine"    // 校验失败文件的隔离目录
+
+	// 分块并发上传
+	HeaderUploadID   = "X-Upload-Id"    // 同一文件各分块共享的上传ID
+	HeaderFileDigest = "X-File-Digest"  // 整个文件的摘要（分块上传时 X-Content-Digest 只覆盖本分块）
+	ChunkStateSuffix = ".gtchunks"      // 记录已到达分块的状态文件后缀
+	ChunkThreshold   = 64 * 1024 * 1024 // 小于该大小的文件不分块
+	DefaultChunks    = 1
+	MaxChunks        = 16
+
+	// 同名文件冲突策略
+	ConflictOverwrite    = "overwrite"         // 覆盖已有文件（默认）
+	ConflictSkip         = "skip"              // 保留已有文件，跳过本次上传
+	ConflictFail         = "fail"              // 拒绝上传，返回 409
+	ConflictRename       = "rename"            // 以数字后缀另存，例如 a_1.txt
+	ConflictVersion      = "version"           // 已有文件移入版本目录后覆盖
+	HeaderOnConflict     = "X-On-Conflict"     // 客户端指定的冲突策略，覆盖服务器默认值
+	HeaderConflictResult = "X-Conflict-Result" // 接收端的处理结果：created、overwritten、skipped、renamed、versioned
+	HeaderStoredName     = "X-Stored-Name"     // 文件实际保存的相对路径
+	VersionsDir          = ".gtversions"       // 旧版本文件的保存目录
+	ResultCreated        = "created"           // 处理结果：新建
+	ResultOverwritten    = "overwritten"       // 处理结果：已覆盖
+	ResultSkipped        = "skipped"           // 处理结果：已跳过
+	ResultRenamed        = "renamed"           // 处理结果：已另存
+	ResultVersioned      = "versioned"         // 处理结果：旧文件已保存为版本
+	ResultExists         = "exists"            // 处理结果：同名文件已存在，拒绝上传（fail 策略）
+
+	// 存储限制
+	DefaultMaxFileSize = 16 * 1024 * 1024 * 1024 // 单个文件默认大小上限 16GB
+	DefaultDiskReserve = 1024 * 1024 * 1024      // 默认保留的磁盘剩余空间 1GB
+	SpaceScanInterval  = 30 * time.Second        // 重新统计存储目录占用的间隔
+	SpaceReserveStep   = 64 * 1024 * 1024        // 未声明大小的上传每次追加预留的空间
+
+	// 停止服务
+	DefaultDrainTimeout  = 30 * time.Second // 停止时等待进行中传输完成的默认时间
+	AbortWait            = 5 * time.Second  // 中止传输后等待处理函数清理的最长时间
+	ExitTransfersAborted = 3                // 停止服务时有传输被中止的退出码
+
+	// 上传响应（Accept: application/json 时返回 JSON）
+	UploadStatusOK      = "ok"      // 文件已保存
+	UploadStatusPartial = "partial" // 已接收部分数据（分段提交或分块），等待其余数据
+	UploadStatusSkipped = "skipped" // 同名文件已存在，已跳过
+	UploadStatusError   = "error"   // 上传失败，见 error.code
+	MaxUploadResponse   = 1 << 20   // 转发节点读取下一跳上传响应的最大字节数
+
+	// 上传响应错误码
+	ErrCodeBadRequest          = "bad_request"          // 请求参数无效
+	ErrCodeInvalidPath         = "invalid_path"         // 文件名不安全（目录穿越等）
+	ErrCodeInvalidRange        = "invalid_range"        // Content-Range 无效或与数据不符
+	ErrCodeOffsetMismatch      = "offset_mismatch"      // 续传偏移与已提交的偏移不一致
+	ErrCodeUploadConflict      = "upload_conflict"      // 分块上传状态冲突
+	ErrCodeIncomplete          = "incomplete"           // 数据不完整
+	ErrCodeDigestMismatch      = "digest_mismatch"      // 完整性校验失败
+	ErrCodeFileExists          = "file_exists"          // 同名文件已存在（fail 策略）
+	ErrCodeTooLarge            = "too_large"            // 超过单文件大小上限
+	ErrCodeInsufficientStorage = "insufficient_storage" // 超出存储配额或磁盘空间不足
+	ErrCodeUnauthorized        = "unauthorized"         // 缺少或无效的访问令牌
+	ErrCodeForbidden           = "forbidden"            // 令牌没有权限或路径不在允许范围内
+	ErrCodeMethodNotAllowed    = "method_not_allowed"   // 不支持的请求方法
+	ErrCodeUpstream            = "upstream_error"       // 转发到下一跳失败
+	ErrCodeShuttingDown        = "shutting_down"        // 服务正在停止，不再接受新的传输
+	ErrCodeCancelled           = "cancelled"            // 传输已通过 DELETE /transfers/{id} 取消
+	ErrCodeNotFound            = "not_found"            // 要删除的文件不存在
+	ErrCodeDirNotEmpty         = "dir_not_empty"        // 要删除的目录非空
+	ErrCodeBaseChanged         = "base_changed"         // 差量上传的基准文件已变化或不存在
+	ErrCodeInternal            = "internal_error"       // 服务器内部错误
+
+	// 下载
+	FilesRoute = "/files/" // 下载接口路径前缀，其后为存储目录中的相对路径
+	ETagSuffix = ".etag"   // 未完成下载旁记录ETag的文件后缀（续传时用于 If-Range）
+
+	// 文件列表
+	ListRoute        = "/files" // 列表接口路径
+	DefaultListLimit = 1000     // 每页默认条目数
+	MaxListLimit     = 10000    // 每页最大条目数
+
+	// 运行指标
+	MetricsRoute = "/metrics" // Prometheus 文本格式的指标接口
+
+	// 传输列表
+	TransfersRoute    = "/transfers"    // 进行中和最近结束的传输，/transfers/{id} 查看或取消单个传输
+	RecentTransfers   = 100             // 保留的最近结束的传输数
+	TransferRunning   = "running"       // 传输状态：进行中
+	TransferCompleted = "completed"     // 传输状态：已完成
+	TransferFailed    = "failed"        // 传输状态：失败
+	TransferCancelled = "cancelled"     // 传输状态：已取消
+	HeaderTransferID  = "X-Transfer-Id" // 上传对应的传输ID，客户端可预先指定以便订阅进度事件
+
+	// 进度事件（SSE）
+	EventsSuffix     = "/events"              // /transfers/{id}/events
+	EventInterval    = 500 * time.Millisecond // 进度事件的发送间隔
+	EventWaitTimeout = 30 * time.Second       // 订阅尚未开始的传输时等待其出现的最长时间
+	EventProgress    = "progress"             // 事件类型：进度
+	EventComplete    = "complete"             // 事件类型：上传完成
+	EventError       = "error"                // 事件类型：上传失败或被取消
+
+	// 目录归档上传
+	ContentTypeTar    = "application/x-tar" // 以单个 tar 归档上传目录，接收端边接收边解压到 name 指定的目录
+	ArchiveGzip       = "gzip"              // Content-Encoding: gzip 时归档经过 gzip 压缩
+	MaxArchiveIgnored = 100                 // 响应中列出的未解压条目的最大数量
+
+	// 文件元数据（逐个文件上传目录时随请求头发送）
+	HeaderFileMode   = "X-File-Mode"   // 权限位，八进制，如 0755（特殊权限位被忽略）
+	HeaderFileMtime  = "X-File-Mtime"  // 修改时间，RFC 3339 格式
+	HeaderEntryType  = "X-Entry-Type"  // 非普通文件的条目类型：dir 或 symlink，请求体为空
+	HeaderLinkTarget = "X-Link-Target" // 符号链接的目标（URL 编码的相对路径）
+	EntryDir         = "dir"           // 条目类型：目录（不存在时创建，并设置权限和修改时间）
+	EntrySymlink     = "symlink"       // 条目类型：符号链接
+	ResultIgnored    = "ignored"       // 处理结果：条目未创建（链接指向目录树之外或接收端忽略元数据）
+
+	// 目录上传筛选
+	IgnoreFileName = ".gtignore" // 目录中的排除规则文件，语法同 .gitignore，作用于所在目录及其子目录
+
+	// 增量同步
+	ManifestRoute = "/manifest" // 目录清单接口：GET /manifest?prefix=目录[&checksum=true]
+	ResultDeleted = "deleted"   // 处理结果：已删除（DELETE /files/{path}）
+	SyncMtimeSlop = time.Second // 比较修改时间的精度，兼容只保存到秒的文件系统
+
+	// 块级差量传输
+	SignatureRoute    = "/signature"             // 块签名接口：GET /signature?name=文件
+	ContentTypeDelta  = "application/x-gt-delta" // 请求体为差量指令流，接收端以已有文件为基准重建
+	HeaderDeltaBase   = "X-Delta-Base"           // 差量基准文件的 ETag，与接收端当前文件不一致时返回 412
+	DeltaMinSize      = 16 * 1024 * 1024         // 小于该大小的文件不使用差量传输
+	DeltaMinBlockSize = 8 * 1024                 // 块大小约为文件大小的平方根，限制在该范围内
+	DeltaMaxBlockSize = 1024 * 1024
+	DeltaMaxLiteral   = 1024 * 1024 // 单条数据指令的最大长度
+
+	// TLS
+	SelfSignedValidity = 10 * 365 * 24 * time.Hour // 自签名证书有效期
+	TLSDirName         = "tls"                     // 配置目录下存放自签名证书的子目录
+
 	// 默认路径
 	DefaultStoragePath = "~/uploads"
 	DefaultConfigDir   = ".config/go-transfer"
@@ -0,0 +1,451 @@
+package delta
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"go-transfer/internal/constants"
+)
+
+// 差量流格式：4 字节标识 "GTD1" 和 4 字节块大小（大端），之后为指令序列
+const (
+	magic      = "GTD1"
+	StrongSize = 16 // 强校验取 SHA-256 的前 16 字节
+	entrySize  = 4 + StrongSize
+
+	opCopy = 'C' // 复制基准文件中连续的块：起始块序号 uint64 + 块数 uint32
+	opData = 'D' // 新数据：长度 uint32 + 数据
+	opEnd  = 'E' // 结束
+)
+
+// BlockSize 按文件大小选择块大小：约为大小的平方根，按 1KB 对齐，
+// 限制在 DeltaMinBlockSize 和 DeltaMaxBlockSize 之间
+func BlockSize(size int64) int {
+	bs := int64(math.Sqrt(float64(size))) &^ 1023
+	if bs < constants.DeltaMinBlockSize {
+		bs = constants.DeltaMinBlockSize
+	}
+	if bs > constants.DeltaMaxBlockSize {
+		bs = constants.DeltaMaxBlockSize
+	}
+	return int(bs)
+}
+
+// Signature 基准文件的块签名：每块一个滚动弱校验和一个强校验，最后一块可能不足块大小
+type Signature struct {
+	Size      int64
+	BlockSize int
+	Weak      []uint32
+	Strong    [][StrongSize]byte
+}
+
+// Compute 按块大小计算 r 的签名
+func Compute(r io.Reader, blockSize int) (*Signature, error) {
+	sig := &Signature{BlockSize: blockSize}
+	buf := make([]byte, blockSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			sig.Size += int64(n)
+			sig.Weak = append(sig.Weak, weakSum(buf[:n]))
+			sig.Strong = append(sig.Strong, strongSum(buf[:n]))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return sig, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Blocks 块数
+func (s *Signature) Blocks() int {
+	return len(s.Weak)
+}
+
+// MarshalBinary 依次编码各块的 4 字节弱校验（大端）和 16 字节强校验
+func (s *Signature) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, len(s.Weak)*entrySize)
+	for i, weak := range s.Weak {
+		data = binary.BigEndian.AppendUint32(data, weak)
+		data = append(data, s.Strong[i][:]...)
+	}
+	return data, nil
+}
+
+// Unmarshal 由文件大小、块大小和 MarshalBinary 的结果还原签名
+func Unmarshal(size int64, blockSize int, data []byte) (*Signature, error) {
+	if size < 0 || blockSize <= 0 || blockSize > constants.DeltaMaxBlockSize {
+		return nil, fmt.Errorf("签名参数无效: 大小 %d, 块大小 %d", size, blockSize)
+	}
+	blocks := (size + int64(blockSize) - 1) / int64(blockSize)
+	if int64(len(data)) != blocks*entrySize {
+		return nil, fmt.Errorf("签名长度不符: %d 块需要 %d 字节, 实际 %d", blocks, blocks*entrySize, len(data))
+	}
+	sig := &Signature{
+		Size:      size,
+		BlockSize: blockSize,
+		Weak:      make([]uint32, blocks),
+		Strong:    make([][StrongSize]byte, blocks),
+	}
+	for i := range sig.Weak {
+		entry := data[i*entrySize : (i+1)*entrySize]
+		sig.Weak[i] = binary.BigEndian.Uint32(entry)
+		copy(sig.Strong[i][:], entry[4:])
+	}
+	return sig, nil
+}
+
+// weakSum rsync 式弱校验：a 为字节和，b 为按位置加权的和，均取模 2^16
+func weakSum(block []byte) uint32 {
+	var a, b uint32
+	n := uint32(len(block))
+	for i, c := range block {
+		a += uint32(c)
+		b += (n - uint32(i)) * uint32(c)
+	}
+	return a&0xffff | b<<16
+}
+
+// roll 窗口向后移动一个字节：移出 out、移入 in，n 为窗口长度
+func roll(sum uint32, out, in byte, n int) uint32 {
+	a := (sum - uint32(out) + uint32(in)) & 0xffff
+	b := (sum>>16 - uint32(n)*uint32(out) + a) & 0xffff
+	return a | b<<16
+}
+
+// strongSum 块的强校验
+func strongSum(block []byte) [StrongSize]byte {
+	var sum [StrongSize]byte
+	full := sha256.Sum256(block)
+	copy(sum[:], full[:])
+	return sum
+}
+
+// Stats 差量传输的统计：从基准文件复用的字节数和随差量发送的新数据字节数
+type Stats struct {
+	Copied  int64
+	Literal int64
+}
+
+// encoder 生成差量指令，相邻的复制指令合并后写出
+type encoder struct {
+	w        *bufio.Writer
+	sig      *Signature
+	full     int              // 完整块的数量（不含不足块大小的最后一块）
+	index    map[uint32][]int // 弱校验 -> 强校验各不相同的完整块
+	runStart int64            // 尚未写出的连续复制
+	runCount int64
+	stats    Stats
+}
+
+// Encode 将 src 与基准文件的签名比较，向 w 写出重建 src 所需的差量：
+// 与基准文件某块相同的数据写为复制指令，其余数据原样写出
+func Encode(w io.Writer, sig *Signature, src io.Reader) (Stats, error) {
+	bs := sig.BlockSize
+	e := &encoder{
+		w:     bufio.NewWriterSize(w, constants.SmallBufferSize),
+		sig:   sig,
+		full:  int(sig.Size / int64(bs)),
+		index: make(map[uint32][]int),
+	}
+	for i := 0; i < e.full; i++ {
+		e.addIndex(i)
+	}
+	tail := -1 // 不足块大小的最后一块，只在 src 结尾处匹配
+	if e.full < sig.Blocks() {
+		tail = e.full
+	}
+
+	e.w.WriteString(magic)
+	binary.Write(e.w, binary.BigEndian, uint32(bs))
+
+	// buf[lit:pos] 为尚未写出的新数据，buf[pos:pos+bs] 为当前窗口
+	buf := make([]byte, 0, constants.DeltaMaxLiteral+2*bs)
+	pos, lit := 0, 0
+	eof := false
+	var sum uint32
+	rolling := false
+	for {
+		if !eof && len(buf)-pos <= bs {
+			n := copy(buf[:cap(buf)], buf[lit:])
+			pos -= lit
+			lit = 0
+			m, err := io.ReadFull(src, buf[n:cap(buf)])
+			buf = buf[:n+m]
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				eof = true
+			} else if err != nil {
+				return e.stats, err
+			}
+		}
+
+		n := len(buf) - pos
+		if n > bs {
+			n = bs
+		}
+		if n == 0 {
+			break
+		}
+		window := buf[pos : pos+n]
+		matched := -1
+		if n == bs {
+			if !rolling {
+				sum = weakSum(window)
+				rolling = true
+			}
+			matched = e.match(sum, window)
+		} else if tail >= 0 && int64(tail)*int64(bs)+int64(n) == sig.Size &&
+			weakSum(window) == sig.Weak[tail] && strongSum(window) == sig.Strong[tail] {
+			matched = tail
+		}
+		if matched >= 0 {
+			if err := e.literal(buf[lit:pos]); err != nil {
+				return e.stats, err
+			}
+			if err := e.copyBlock(matched, n); err != nil {
+				return e.stats, err
+			}
+			pos += n
+			lit = pos
+			rolling = false
+			continue
+		}
+
+		// 未匹配时窗口后移一个字节
+		if rolling && pos+bs < len(buf) {
+			sum = roll(sum, buf[pos], buf[pos+bs], bs)
+		} else {
+			rolling = false
+		}
+		pos++
+		if pos-lit >= constants.DeltaMaxLiteral {
+			if err := e.literal(buf[lit:pos]); err != nil {
+				return e.stats, err
+			}
+			lit = pos
+		}
+	}
+
+	if err := e.literal(buf[lit:pos]); err != nil {
+		return e.stats, err
+	}
+	if err := e.flushCopy(); err != nil {
+		return e.stats, err
+	}
+	e.w.WriteByte(opEnd)
+	return e.stats, e.w.Flush()
+}
+
+// addIndex 将完整块加入索引，内容相同的块（如全零块）只保留第一个
+func (e *encoder) addIndex(i int) {
+	weak := e.sig.Weak[i]
+	for _, j := range e.index[weak] {
+		if e.sig.Strong[j] == e.sig.Strong[i] {
+			return
+		}
+	}
+	e.index[weak] = append(e.index[weak], i)
+}
+
+// match 查找与窗口内容相同的完整块，优先延续当前的连续复制，未找到时返回 -1
+func (e *encoder) match(sum uint32, window []byte) int {
+	next := e.runStart + e.runCount
+	follows := e.runCount > 0 && next < int64(e.full) && e.sig.Weak[next] == sum
+	candidates := e.index[sum]
+	if !follows && len(candidates) == 0 {
+		return -1
+	}
+	strong := strongSum(window)
+	if follows && e.sig.Strong[next] == strong {
+		return int(next)
+	}
+	for _, i := range candidates {
+		if e.sig.Strong[i] == strong {
+			return i
+		}
+	}
+	return -1
+}
+
+// copyBlock 记录一个匹配的块，与上一个块相邻时合并为同一条复制指令
+func (e *encoder) copyBlock(i, length int) error {
+	e.stats.Copied += int64(length)
+	if e.runCount > 0 && e.runCount < math.MaxUint32 && int64(i) == e.runStart+e.runCount {
+		e.runCount++
+		return nil
+	}
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	e.runStart, e.runCount = int64(i), 1
+	return nil
+}
+
+// flushCopy 写出尚未写出的复制指令
+func (e *encoder) flushCopy() error {
+	if e.runCount == 0 {
+		return nil
+	}
+	var op [13]byte
+	op[0] = opCopy
+	binary.BigEndian.PutUint64(op[1:], uint64(e.runStart))
+	binary.BigEndian.PutUint32(op[9:], uint32(e.runCount))
+	e.runCount = 0
+	_, err := e.w.Write(op[:])
+	return err
+}
+
+// literal 写出新数据（之前的复制指令先写出）
+func (e *encoder) literal(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	var op [5]byte
+	op[0] = opData
+	binary.BigEndian.PutUint32(op[1:], uint32(len(data)))
+	e.w.Write(op[:])
+	e.stats.Literal += int64(len(data))
+	_, err := e.w.Write(data)
+	return err
+}
+
+// Reader 按差量指令重建新文件：复制指令从基准文件读取，数据指令从差量流读取。
+// 读到结束指令后确认差量流已结束，之后返回 io.EOF
+type Reader struct {
+	base      io.ReaderAt
+	baseSize  int64
+	src       io.Reader
+	expected  int64 // 计算签名时的块大小
+	blockSize int64
+	started   bool
+	from      io.Reader // 当前指令的数据来源
+	remaining int64     // 当前指令尚未读出的字节数
+	stats     Stats
+	err       error
+}
+
+// NewReader 以 base（大小为 baseSize）为基准，按 src 中的差量指令重建新文件。
+// blockSize 为基准文件签名的块大小，差量流声明的块大小与之不同时返回错误
+func NewReader(base io.ReaderAt, baseSize int64, blockSize int, src io.Reader) *Reader {
+	return &Reader{base: base, baseSize: baseSize, expected: int64(blockSize), src: src}
+}
+
+// Stats 已读出指令的统计
+func (r *Reader) Stats() Stats {
+	return r.stats
+}
+
+// Read 实现 io.Reader 接口
+func (r *Reader) Read(p []byte) (int, error) {
+	for r.remaining == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.next()
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.from.Read(p)
+	r.remaining -= int64(n)
+	if err == io.EOF {
+		err = nil
+		if r.remaining > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	if err != nil {
+		r.err = err
+		r.remaining = 0
+	}
+	return n, err
+}
+
+// errTrailing 结束指令之后仍有数据
+var errTrailing = errors.New("差量数据在结束指令之后仍有内容")
+
+// next 读取下一条指令
+func (r *Reader) next() error {
+	if !r.started {
+		var header [8]byte
+		if _, err := io.ReadFull(r.src, header[:]); err != nil {
+			return unexpected(err)
+		}
+		if string(header[:4]) != magic {
+			return errors.New("不是有效的差量数据")
+		}
+		r.blockSize = int64(binary.BigEndian.Uint32(header[4:]))
+		if r.blockSize == 0 || r.blockSize != r.expected {
+			return fmt.Errorf("差量块大小 %d 与基准文件签名的块大小 %d 不符", r.blockSize, r.expected)
+		}
+		r.started = true
+	}
+
+	var op [13]byte
+	if _, err := io.ReadFull(r.src, op[:1]); err != nil {
+		return unexpected(err)
+	}
+	switch op[0] {
+	case opCopy:
+		if _, err := io.ReadFull(r.src, op[1:]); err != nil {
+			return unexpected(err)
+		}
+		index := binary.BigEndian.Uint64(op[1:])
+		count := int64(binary.BigEndian.Uint32(op[9:]))
+		blocks := (r.baseSize + r.blockSize - 1) / r.blockSize
+		if count == 0 || index >= uint64(blocks) {
+			return fmt.Errorf("复制指令超出基准文件范围: 块 %d", index)
+		}
+		start := int64(index) * r.blockSize
+		end := start + count*r.blockSize
+		if end-r.blockSize >= r.baseSize {
+			return fmt.Errorf("复制指令超出基准文件范围: 块 %d-%d", index, int64(index)+count-1)
+		}
+		if end > r.baseSize {
+			end = r.baseSize
+		}
+		r.from, r.remaining = io.NewSectionReader(r.base, start, end-start), end-start
+		r.stats.Copied += end - start
+	case opData:
+		if _, err := io.ReadFull(r.src, op[1:5]); err != nil {
+			return unexpected(err)
+		}
+		n := int64(binary.BigEndian.Uint32(op[1:]))
+		if n == 0 || n > constants.DeltaMaxLiteral {
+			return fmt.Errorf("数据指令长度无效: %d", n)
+		}
+		r.from, r.remaining = r.src, n
+		r.stats.Literal += n
+	case opEnd:
+		// 确认差量流已结束（同时使 HTTP trailer 可用）
+		n, err := io.ReadFull(r.src, op[:1])
+		if n > 0 {
+			return errTrailing
+		}
+		if err != io.EOF {
+			return err
+		}
+		return io.EOF
+	default:
+		return fmt.Errorf("未知的差量指令: %#x", op[0])
+	}
+	return nil
+}
+
+// unexpected 指令未读完时到达结尾视为数据不完整
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,167 @@
+package delta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"go-transfer/internal/constants"
+)
+
+const testBlock = constants.DeltaMinBlockSize
+
+// randomBytes 生成确定的伪随机数据
+func randomBytes(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+// join 拼接多段数据
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// roundTrip 以 base 为基准编码 content，再重建并返回统计
+func roundTrip(t *testing.T, base, content []byte) Stats {
+	t.Helper()
+	sig, err := Compute(bytes.NewReader(base), testBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stream bytes.Buffer
+	stats, err := Encode(&stream, sig, bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := NewReader(bytes.NewReader(base), int64(len(base)), testBlock, &stream)
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("重建失败: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("重建结果不一致: %d bytes, 期望 %d", len(got), len(content))
+	}
+	if stats.Copied+stats.Literal != int64(len(content)) || reader.Stats() != stats {
+		t.Fatalf("统计 = %+v, 重建端 %+v, 内容 %d bytes", stats, reader.Stats(), len(content))
+	}
+	return stats
+}
+
+func TestRoundTrip(t *testing.T) {
+	base := randomBytes(1, 20*testBlock+123)
+	zeros := make([]byte, 6*testBlock)
+	repeated := bytes.Repeat(randomBytes(2, testBlock), 4)
+
+	tests := []struct {
+		name       string
+		base       []byte
+		content    []byte
+		maxLiteral int64
+	}{
+		{"内容相同", base, base, 0},
+		{"中间插入", base, join(base[:5*testBlock+7], []byte("inserted"), base[5*testBlock+7:]), testBlock + 8},
+		{"开头插入", base, join([]byte("head"), base), testBlock + 4},
+		{"中间删除", base, join(base[:3*testBlock], base[4*testBlock+100:]), testBlock},
+		{"截去结尾", base, base[:10*testBlock+5], 5},
+		{"追加内容", base, join(base, randomBytes(3, 1000)), testBlock + 1123},
+		{"空基准", nil, base, int64(len(base))},
+		{"空内容", base, nil, 0},
+		{"不足一块的基准", base[:100], join(base[:100]), 0},
+		{"不足一块的结尾", base, join(base[:testBlock], base[20*testBlock:]), 0},
+		{"全零块", zeros, join(zeros[:testBlock], []byte("x"), zeros), 1},
+		{"重复块", repeated, join(repeated, repeated[:2*testBlock]), 0},
+		{"超过单条数据上限", nil, randomBytes(4, constants.DeltaMaxLiteral+testBlock), constants.DeltaMaxLiteral + testBlock},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if stats := roundTrip(t, tt.base, tt.content); stats.Literal > tt.maxLiteral {
+				t.Errorf("新数据 %d bytes, 期望不超过 %d", stats.Literal, tt.maxLiteral)
+			}
+		})
+	}
+}
+
+func TestSignatureMarshal(t *testing.T) {
+	sig, _ := Compute(bytes.NewReader(randomBytes(5, 3*testBlock+1)), testBlock)
+	data, _ := sig.MarshalBinary()
+	got, err := Unmarshal(sig.Size, sig.BlockSize, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Blocks() != 4 || got.Weak[3] != sig.Weak[3] || got.Strong[3] != sig.Strong[3] {
+		t.Errorf("还原的签名不一致: %d 块", got.Blocks())
+	}
+	if _, err := Unmarshal(sig.Size, sig.BlockSize, data[:len(data)-1]); err == nil {
+		t.Error("长度不符的签名应返回错误")
+	}
+	if _, err := Unmarshal(sig.Size, 0, data); err == nil {
+		t.Error("块大小为 0 的签名应返回错误")
+	}
+}
+
+// stream 构造差量流：header 之后依次写入各条指令
+func stream(blockSize uint32, ops ...[]byte) []byte {
+	buf := []byte(magic)
+	buf = binary.BigEndian.AppendUint32(buf, blockSize)
+	for _, op := range ops {
+		buf = append(buf, op...)
+	}
+	return buf
+}
+
+func copyOp(index uint64, count uint32) []byte {
+	op := binary.BigEndian.AppendUint64([]byte{opCopy}, index)
+	return binary.BigEndian.AppendUint32(op, count)
+}
+
+func dataOp(n uint32, data string) []byte {
+	return append(binary.BigEndian.AppendUint32([]byte{opData}, n), data...)
+}
+
+func TestReaderRejectsMalformed(t *testing.T) {
+	base := randomBytes(6, 3*testBlock+10) // 4 块，最后一块 10 字节
+	end := []byte{opEnd}
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"有效", stream(testBlock, copyOp(0, 4), dataOp(2, "ab"), end), ""},
+		{"标识错误", append([]byte("XXXX"), stream(testBlock, end)[4:]...), "不是有效的差量数据"},
+		{"头部截断", []byte("GTD1\x00\x00"), io.ErrUnexpectedEOF.Error()},
+		{"空数据", nil, io.ErrUnexpectedEOF.Error()},
+		{"块大小与签名不符", stream(2*testBlock, copyOp(0, 1), end), "块大小"},
+		{"块大小为零", stream(0, end), "块大小"},
+		{"块序号越界", stream(testBlock, copyOp(4, 1), end), "超出基准文件范围"},
+		{"块序号溢出", stream(testBlock, copyOp(1<<63, 1), end), "超出基准文件范围"},
+		{"块数越界", stream(testBlock, copyOp(2, 3), end), "超出基准文件范围"},
+		{"块数为零", stream(testBlock, copyOp(0, 0), end), "超出基准文件范围"},
+		{"数据过长", stream(testBlock, dataOp(constants.DeltaMaxLiteral+1, "x"), end), "数据指令长度无效"},
+		{"数据长度为零", stream(testBlock, dataOp(0, ""), end), "数据指令长度无效"},
+		{"数据截断", stream(testBlock, dataOp(10, "abc")), io.ErrUnexpectedEOF.Error()},
+		{"复制指令截断", stream(testBlock, copyOp(0, 1)[:5]), io.ErrUnexpectedEOF.Error()},
+		{"缺少结束指令", stream(testBlock, copyOp(0, 1)), io.ErrUnexpectedEOF.Error()},
+		{"未知指令", stream(testBlock, []byte{'Z'}), "未知的差量指令"},
+		{"结束后仍有数据", stream(testBlock, end, []byte("x")), "结束指令之后"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewReader(bytes.NewReader(base), int64(len(base)), testBlock, bytes.NewReader(tt.data))
+			got, err := io.ReadAll(reader)
+			if tt.want == "" {
+				if err != nil || len(got) != len(base)+2 {
+					t.Fatalf("有效差量流: %d bytes, %v", len(got), err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("错误 = %v, 期望包含 %q", err, tt.want)
+			}
+		})
+	}
+}
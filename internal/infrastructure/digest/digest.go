@@ -0,0 +1,54 @@
+package digest
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// DefaultAlgorithm 默认摘要算法
+const DefaultAlgorithm = "sha256"
+
+// algorithms 支持的摘要算法
+var algorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// New 按算法名创建摘要计算器
+func New(algorithm string) (hash.Hash, error) {
+	newHash, ok := algorithms[strings.ToLower(algorithm)]
+	if !ok {
+		return nil, fmt.Errorf("不支持的摘要算法: %s", algorithm)
+	}
+	return newHash(), nil
+}
+
+// Format 将摘要格式化为 "算法=十六进制" 形式
+func Format(algorithm string, h hash.Hash) string {
+	return strings.ToLower(algorithm) + "=" + hex.EncodeToString(h.Sum(nil))
+}
+
+// Parse 解析 "算法=十六进制" 形式的摘要
+func Parse(value string) (algorithm, sum string, err error) {
+	algorithm, sum, ok := strings.Cut(strings.TrimSpace(value), "=")
+	if !ok || sum == "" {
+		return "", "", fmt.Errorf("摘要格式错误: %s", value)
+	}
+	algorithm = strings.ToLower(algorithm)
+	if _, ok := algorithms[algorithm]; !ok {
+		return "", "", fmt.Errorf("不支持的摘要算法: %s", algorithm)
+	}
+	if _, err := hex.DecodeString(sum); err != nil {
+		return "", "", fmt.Errorf("摘要格式错误: %s", value)
+	}
+	return algorithm, strings.ToLower(sum), nil
+}
+
+// Equal 比较两个摘要是否一致（忽略大小写）
+func Equal(a, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
@@ -0,0 +1,259 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType Prometheus 文本格式的响应类型
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// collector 可输出为 Prometheus 文本格式的指标
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry 指标集合，按注册顺序输出
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// NewRegistry 创建指标集合
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	r.collectors = append(r.collectors, c)
+	r.mu.Unlock()
+}
+
+// Write 以 Prometheus 文本格式输出所有指标
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler 返回输出指标的 HTTP 处理器
+func (r *Registry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		r.Write(w)
+	}
+}
+
+// Counter 只增不减的计数器，可带标签
+type Counter struct {
+	name   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]*series
+}
+
+// series 一组标签值对应的数值
+type series struct {
+	labelValues []string
+	value       float64
+}
+
+// NewCounter 注册计数器，labels 为标签名
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{name: name, labels: labels, values: make(map[string]*series)}
+	r.register(&described{name: name, help: help, kind: "counter", body: c})
+	return c
+}
+
+// Add 按标签值累加，v 不能为负数
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	if len(labelValues) != len(c.labels) {
+		panic(fmt.Sprintf("指标 %s 需要 %d 个标签值", c.name, len(c.labels)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	c.mu.Lock()
+	s, ok := c.values[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		c.values[key] = s
+	}
+	s.value += v
+	c.mu.Unlock()
+}
+
+// Inc 按标签值加一
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		s := c.values[key]
+		lines = append(lines, fmt.Sprintf("%s%s %s\n", c.name, formatLabels(c.labels, s.labelValues), formatValue(s.value)))
+	}
+	c.mu.Unlock()
+
+	// 无标签的计数器从 0 开始输出
+	if len(c.labels) == 0 && len(lines) == 0 {
+		lines = append(lines, c.name+" 0\n")
+	}
+	for _, line := range lines {
+		io.WriteString(w, line)
+	}
+}
+
+// Gauge 可增可减的数值
+type Gauge struct {
+	name  string
+	mu    sync.Mutex
+	value float64
+	fn    func() (float64, bool)
+}
+
+// NewGauge 注册数值指标
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{name: name}
+	r.register(&described{name: name, help: help, kind: "gauge", body: g})
+	return g
+}
+
+// NewGaugeFunc 注册在输出时调用 fn 取值的数值指标，fn 返回 false 时不输出
+func (r *Registry) NewGaugeFunc(name, help string, fn func() (float64, bool)) {
+	r.register(&described{name: name, help: help, kind: "gauge", body: &Gauge{name: name, fn: fn}})
+}
+
+// Add 增加 v（可为负数）
+func (g *Gauge) Add(v float64) {
+	g.mu.Lock()
+	g.value += v
+	g.mu.Unlock()
+}
+
+// Inc 加一
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+// Dec 减一
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+func (g *Gauge) write(w io.Writer) {
+	value, ok := g.current()
+	if ok {
+		fmt.Fprintf(w, "%s %s\n", g.name, formatValue(value))
+	}
+}
+
+func (g *Gauge) current() (float64, bool) {
+	if g.fn != nil {
+		return g.fn()
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.value, true
+}
+
+// Histogram 按上界分桶统计观测值
+type Histogram struct {
+	name    string
+	buckets []float64 // 升序的桶上界
+	mu      sync.Mutex
+	counts  []uint64 // 各桶（非累计）的计数，最后一个为 +Inf
+	sum     float64
+	count   uint64
+}
+
+// NewHistogram 注册直方图，buckets 为升序的桶上界
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{name: name, buckets: buckets, counts: make([]uint64, len(buckets)+1)}
+	r.register(&described{name: name, help: help, kind: "histogram", body: h})
+	return h
+}
+
+// Observe 记录一个观测值
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	sum, count := h.sum, h.count
+	h.mu.Unlock()
+
+	var cumulative uint64
+	for i, bound := range h.buckets {
+		cumulative += counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatValue(bound), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.name, formatValue(sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.name, count)
+}
+
+// described 带 HELP/TYPE 说明的指标
+type described struct {
+	name string
+	help string
+	kind string
+	body collector
+}
+
+func (d *described) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.kind)
+	d.body.write(w)
+}
+
+// formatLabels 格式化标签，标签值转义反斜杠、双引号和换行
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=\"%s\"", name, escape.Replace(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// formatValue 格式化数值
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -2,6 +2,7 @@ package progress
 
 import (
 	"fmt"
+	"hash"
 	"io"
 	"strings"
 	"sync"
@@ -22,6 +23,10 @@ type Progress struct {
 	lastPrint   time.Time
 	prefix      string
 	showBar     bool
+	hasher      hash.Hash // 可选，流经的数据同时写入摘要
+	parent      *Progress // 可选，进度同时计入上级（并发传输的汇总进度）
+	filesTotal  int       // 汇总进度包含的文件数，0 表示不显示
+	filesDone   int
 }
 
 // NewProgressReader 创建带进度跟踪的Reader
@@ -48,6 +53,19 @@ func NewProgressWriter(w io.Writer, total int64, prefix string) *Progress {
 	}
 }
 
+// NewAggregateProgress 创建汇总多个并发传输的进度跟踪器，自身不读写数据，
+// 由子进度（见 SetParent）或 Add 累加
+func NewAggregateProgress(total int64, files int, prefix string) *Progress {
+	return &Progress{
+		total:      total,
+		startTime:  time.Now(),
+		lastPrint:  time.Now(),
+		prefix:     prefix,
+		showBar:    true,
+		filesTotal: files,
+	}
+}
+
 // Read 实现 io.Reader 接口
 func (p *Progress) Read(b []byte) (int, error) {
 	if p.reader == nil {
@@ -55,7 +73,7 @@ func (p *Progress) Read(b []byte) (int, error) {
 	}
 	
 	n, err := p.reader.Read(b)
-	p.addProgress(int64(n))
+	p.addProgress(b[:n])
 	
 	// 定期更新进度显示
 	if p.shouldPrint() || err == io.EOF {
@@ -72,7 +90,7 @@ func (p *Progress) Write(b []byte) (int, error) {
 	}
 	
 	n, err := p.writer.Write(b)
-	p.addProgress(int64(n))
+	p.addProgress(b[:n])
 	
 	// 定期更新进度显示
 	if p.shouldPrint() || err == io.EOF {
@@ -89,6 +107,64 @@ func (p *Progress) SetTotal(total int64) {
 	p.total = total
 }
 
+// SetHasher 设置摘要计算器，之后读写的数据都会同步计算摘要
+func (p *Progress) SetHasher(h hash.Hash) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.hasher = h
+}
+
+// SetParent 设置上级进度，之后读写的数据同时计入上级，自身不再单独显示
+func (p *Progress) SetParent(parent *Progress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.parent = parent
+	p.showBar = false
+}
+
+// SetQuiet 只统计进度，不显示进度条（并发写入的分块等）
+func (p *Progress) SetQuiet() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.showBar = false
+}
+
+// Add 累加进度（可为负数，用于撤销失败的尝试），同时计入上级，到达刷新间隔时更新显示
+func (p *Progress) Add(n int64) {
+	p.mu.Lock()
+	p.current += n
+	parent := p.parent
+	p.mu.Unlock()
+
+	if parent != nil {
+		parent.Add(n)
+	}
+	if p.shouldPrint() {
+		p.PrintProgress()
+	}
+}
+
+// Rollback 撤销已计入上级的进度并清零，用于重试前丢弃失败尝试的计数
+func (p *Progress) Rollback() {
+	p.mu.Lock()
+	n := p.current
+	p.current = 0
+	parent := p.parent
+	p.mu.Unlock()
+
+	if parent != nil {
+		parent.Add(-n)
+	}
+}
+
+// FileDone 汇总进度中标记一个文件完成
+func (p *Progress) FileDone() {
+	p.mu.Lock()
+	p.filesDone++
+	p.mu.Unlock()
+	p.PrintProgress()
+}
+
 // GetProgress 获取当前进度
 func (p *Progress) GetProgress() (current, total int64, percentage float64) {
 	p.mu.RLock()
@@ -106,45 +182,34 @@ func (p *Progress) GetProgress() (current, total int64, percentage float64) {
 func (p *Progress) GetSpeed() float64 {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
-	
-	elapsed := time.Since(p.startTime).Seconds()
-	if elapsed <= 0 {
-		return 0
-	}
-	return float64(p.current) / elapsed
+	return p.speed()
 }
 
 // GetETA 获取预计剩余时间
 func (p *Progress) GetETA() time.Duration {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
-	
-	if p.total <= 0 || p.current <= 0 {
-		return 0
-	}
-	
-	speed := p.GetSpeed()
-	if speed <= 0 {
-		return 0
-	}
-	
-	remaining := p.total - p.current
-	seconds := float64(remaining) / speed
-	return time.Duration(seconds) * time.Second
+	return p.eta()
 }
 
 // PrintProgress 打印进度信息
 func (p *Progress) PrintProgress() {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
-	
+	// 只在锁内读取快照，并发汇报时避免重入读锁
+	p.mu.Lock()
 	if !p.showBar {
+		p.mu.Unlock()
 		return
 	}
+	current, total := p.current, p.total
+	speed, eta := p.speed(), p.eta()
+	filesDone, filesTotal := p.filesDone, p.filesTotal
+	p.lastPrint = time.Now()
+	p.mu.Unlock()
 	
-	current, total, percentage := p.GetProgress()
-	speed := p.GetSpeed()
-	eta := p.GetETA()
+	prefix := p.prefix
+	if filesTotal > 0 {
+		prefix = fmt.Sprintf("%s [%d/%d]", prefix, filesDone, filesTotal)
+	}
 	
 	var output string
 	
@@ -153,12 +218,12 @@ func (p *Progress) PrintProgress() {
 		bar := p.buildProgressBar(current, total)
 		
 		// 格式化输出
-		percentStr := fmt.Sprintf("%5.1f%%", percentage)
+		percentStr := fmt.Sprintf("%5.1f%%", float64(current)*100/float64(total))
 		sizeStr := fmt.Sprintf("%s/%s", system.FormatSize(current), system.FormatSize(total))
 		speedStr := fmt.Sprintf("%s/s", system.FormatSize(int64(speed)))
 		
 		output = fmt.Sprintf("%s: [%s] %s %-20s 速度: %-12s",
-			p.prefix, bar, percentStr, sizeStr, speedStr)
+			prefix, bar, percentStr, sizeStr, speedStr)
 		
 		if eta > 0 && current < total {
 			etaStr := fmt.Sprintf("剩余: %d秒", int(eta.Seconds()))
@@ -168,20 +233,52 @@ func (p *Progress) PrintProgress() {
 		// 未知大小时的进度显示
 		sizeStr := system.FormatSize(current)
 		speedStr := fmt.Sprintf("%s/s", system.FormatSize(int64(speed)))
-		output = fmt.Sprintf("%s: %-15s 速度: %-12s", p.prefix, sizeStr, speedStr)
+		output = fmt.Sprintf("%s: %-15s 速度: %-12s", prefix, sizeStr, speedStr)
 	}
 	
 	// 使用固定宽度输出，避免残影
 	system.ClearLine(output)
-	p.lastPrint = time.Now()
 }
 
 // 内部方法
 
-func (p *Progress) addProgress(n int64) {
+func (p *Progress) addProgress(b []byte) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-	p.current += n
+	p.current += int64(len(b))
+	if p.hasher != nil {
+		p.hasher.Write(b)
+	}
+	parent := p.parent
+	p.mu.Unlock()
+	
+	if parent != nil {
+		parent.Add(int64(len(b)))
+	}
+}
+
+// speed 计算传输速度，调用方需持有锁
+func (p *Progress) speed() float64 {
+	elapsed := time.Since(p.startTime).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(p.current) / elapsed
+}
+
+// eta 计算预计剩余时间，调用方需持有锁
+func (p *Progress) eta() time.Duration {
+	if p.total <= 0 || p.current <= 0 {
+		return 0
+	}
+	
+	speed := p.speed()
+	if speed <= 0 {
+		return 0
+	}
+	
+	remaining := p.total - p.current
+	seconds := float64(remaining) / speed
+	return time.Duration(seconds) * time.Second
 }
 
 func (p *Progress) shouldPrint() bool {
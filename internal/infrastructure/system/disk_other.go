@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !dragonfly && !windows
+
+package system
+
+import "errors"
+
+// DiskFree 当前平台不支持查询剩余空间，调用方应跳过检查
+func DiskFree(path string) (int64, error) {
+	return 0, errors.New("不支持查询磁盘剩余空间")
+}
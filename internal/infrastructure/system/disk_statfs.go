@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd || dragonfly
+
+package system
+
+import "syscall"
+
+// DiskFree 返回路径所在文件系统对当前用户可用的字节数
+func DiskFree(path string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(uint64(st.Bavail) * uint64(st.Bsize)), nil
+}
@@ -152,6 +152,12 @@ func HandlePortConflict(port int) bool {
 	
 	fmt.Printf("占用进程: %s (PID: %d)\n", processName, pid)
 	
+	// 非交互环境下不询问，直接放弃
+	if !IsTerminal(os.Stdin) {
+		fmt.Println("请手动释放端口或选择其他端口")
+		return false
+	}
+	
 	// 询问用户是否杀死进程
 	reader := bufio.NewReader(os.Stdin)
 	for {
@@ -0,0 +1,5 @@
+package system
+
+import "syscall"
+
+const ioctlReadTermios = syscall.TCGETS
@@ -0,0 +1,16 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package system
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// IsTerminal 判断文件是否为交互式终端（用于区分脚本/cron/systemd 等非交互环境）
+func IsTerminal(f *os.File) bool {
+	var termios syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), ioctlReadTermios, uintptr(unsafe.Pointer(&termios)))
+	return errno == 0
+}
@@ -0,0 +1,12 @@
+package system
+
+import (
+	"os"
+	"syscall"
+)
+
+// IsTerminal 判断文件是否为交互式终端（用于区分脚本/计划任务等非交互环境）
+func IsTerminal(f *os.File) bool {
+	var mode uint32
+	return syscall.GetConsoleMode(syscall.Handle(f.Fd()), &mode) == nil
+}
@@ -2,8 +2,10 @@ package system
 
 import (
 	"fmt"
+	"math"
 	"os/user"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"go-transfer/internal/constants"
@@ -23,6 +25,27 @@ func FormatSize(bytes int64) string {
 	return fmt.Sprintf("%.2f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
 
+// ParseSize 解析人类可读的大小（如 16GB、512M、1.5TiB、1024），单位按 1024 进制，与 FormatSize 一致
+func ParseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+
+	multiplier := int64(1)
+	if s != "" {
+		if i := strings.IndexByte("KMGTPE", s[len(s)-1]); i >= 0 {
+			multiplier = int64(1) << (10 * (i + 1))
+			s = strings.TrimSpace(s[:len(s)-1])
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	size := n * float64(multiplier)
+	if err != nil || n < 0 || size >= math.MaxInt64 {
+		return 0, fmt.Errorf("无效的大小: %s", value)
+	}
+	return int64(size), nil
+}
+
 // ExpandPath 展开路径中的 ~ 符号为用户主目录
 func ExpandPath(path string) string {
 	if !strings.HasPrefix(path, "~") {
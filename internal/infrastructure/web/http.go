@@ -1,6 +1,7 @@
 package web
 
 import (
+	"crypto/tls"
 	"net"
 	"net/http"
 	"time"
@@ -8,18 +9,23 @@ import (
 	"go-transfer/internal/constants"
 )
 
-// CreateUploadClient 创建用于文件上传的HTTP客户端（客户端模式使用）
-func CreateUploadClient() *http.Client {
+// CreateUploadClient 创建用于文件上传的HTTP客户端（客户端模式使用），tlsConfig 可为 nil，
+// conns 为并发上传数，连接池按该值放开（小于1时按单连接处理）
+func CreateUploadClient(tlsConfig *tls.Config, conns int) *http.Client {
+	if conns < 1 {
+		conns = constants.MaxConnsPerHost
+	}
 	return &http.Client{
 		Timeout: constants.DefaultTimeout,
 		Transport: &http.Transport{
-			MaxConnsPerHost:       constants.MaxConnsPerHost,
-			MaxIdleConnsPerHost:   constants.MaxIdleConnsPerHost,
-			MaxIdleConns:          constants.MaxIdleConns,
+			MaxConnsPerHost:       conns,
+			MaxIdleConnsPerHost:   conns,
+			MaxIdleConns:          conns,
 			IdleConnTimeout:       constants.IdleConnTimeout,
 			DisableKeepAlives:     false,
 			ForceAttemptHTTP2:     false, // 强制 HTTP/1.1
 			ResponseHeaderTimeout: constants.ResponseTimeout,
+			TLSClientConfig:       tlsConfig,
 			DialContext: (&net.Dialer{
 				Timeout:   30 * time.Second,
 				KeepAlive: 30 * time.Second,
@@ -28,8 +34,9 @@ func CreateUploadClient() *http.Client {
 	}
 }
 
-// CreateForwardClient 创建用于转发的HTTP客户端（转发模式使用）
-func CreateForwardClient() *http.Client {
+// CreateForwardClient 创建用于转发的HTTP客户端（转发模式使用），tlsConfig 可为 nil。
+// 客户端并行上传的文件和分块都发往同一下一跳，连接池按最大并发数放开
+func CreateForwardClient(tlsConfig *tls.Config) *http.Client {
 	return &http.Client{
 		Timeout: constants.DefaultTimeout,
 		Transport: &http.Transport{
@@ -38,8 +45,23 @@ func CreateForwardClient() *http.Client {
 			IdleConnTimeout:     constants.IdleConnTimeout,
 			WriteBufferSize:     constants.MediumBufferSize,
 			ReadBufferSize:      constants.MediumBufferSize,
-			MaxIdleConns:        10,
-			MaxConnsPerHost:     10,
+			MaxIdleConns:        constants.MaxParallel,
+			MaxIdleConnsPerHost: constants.MaxParallel,
+			MaxConnsPerHost:     constants.MaxParallel,
+			TLSClientConfig:     tlsConfig,
 		},
 	}
-}
\ No newline at end of file
+}
+
+// CreateEventsClient 创建订阅下一跳事件流（SSE）的HTTP客户端，tlsConfig 可为 nil。
+// 事件流持续到传输结束，不设置整体超时，由请求的上下文取消；连接池与转发数据的客户端分开
+func CreateEventsClient(tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DisableKeepAlives:     false,
+			IdleConnTimeout:       constants.IdleConnTimeout,
+			ResponseHeaderTimeout: constants.ResponseTimeout,
+			TLSClientConfig:       tlsConfig,
+		},
+	}
+}
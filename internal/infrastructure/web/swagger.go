@@ -21,37 +21,325 @@ func generateSwaggerJSON(host string) string {
 			"/upload": map[string]interface{}{
 				"post": map[string]interface{}{
 					"summary":     "上传文件",
-					"description": "支持浏览器FormData和命令行二进制流，零缓存传输",
-					"consumes":    []string{"multipart/form-data", "application/octet-stream"},
-					"produces":    []string{"text/plain"},
+					"description": "支持浏览器FormData和命令行二进制流，零缓存传输。表单逐个读取文件部分，可一次上传多个文件。Content-Type 为 application/x-tar 时将请求体作为目录归档边接收边解压到 name 指定的目录；为 application/x-gt-delta 时请求体为差量指令流，以已有文件为基准重建新文件（X-Content-Length 声明重建后的大小）。Accept 为 application/json 时返回 JSON，否则返回纯文本",
+					"consumes":    []string{"multipart/form-data", "application/octet-stream", "application/x-tar", "application/x-gt-delta"},
+					"produces":    []string{"text/plain", "application/json"},
 					"parameters": []map[string]interface{}{
 						{
 							"name":        "name",
 							"in":          "query",
-							"description": "文件名（可选，FormData时自动获取）",
+							"description": "文件名（可选，FormData时自动获取；表单中位于文件之前的 name 字段优先，URL 参数只作用于第一个文件）",
+							"required":    false,
+							"type":        "string",
+						},
+						{
+							"name":        "X-Transfer-Id",
+							"in":          "header",
+							"description": "传输ID（字母数字、- 和 _），用于订阅 /transfers/{id}/events；不指定时由服务器生成，在响应头中返回",
+							"required":    false,
+							"type":        "string",
+						},
+						{
+							"name":        "Accept",
+							"in":          "header",
+							"description": "application/json 返回 UploadResponse，默认返回纯文本",
+							"required":    false,
+							"type":        "string",
+							"enum":        []string{"text/plain", "application/json"},
+						},
+						{
+							"name":        "Content-Encoding",
+							"in":          "header",
+							"description": "目录归档（application/x-tar）经过 gzip 压缩时为 gzip",
+							"required":    false,
+							"type":        "string",
+							"enum":        []string{"gzip"},
+						},
+						{
+							"name":        "X-File-Mode",
+							"in":          "header",
+							"description": "文件或目录的权限位（八进制，如 0755），接收端在保存时设置",
+							"required":    false,
+							"type":        "string",
+						},
+						{
+							"name":        "X-File-Mtime",
+							"in":          "header",
+							"description": "文件或目录的修改时间（RFC 3339）",
+							"required":    false,
+							"type":        "string",
+						},
+						{
+							"name":        "X-Entry-Type",
+							"in":          "header",
+							"description": "非普通文件的条目（请求体为空）：dir 创建目录，symlink 创建符号链接；链接须指向所在顶层目录之内，否则不创建（result 为 ignored）",
+							"required":    false,
+							"type":        "string",
+							"enum":        []string{"dir", "symlink"},
+						},
+						{
+							"name":        "X-Link-Target",
+							"in":          "header",
+							"description": "符号链接的目标（URL 编码的相对路径）",
 							"required":    false,
 							"type":        "string",
 						},
+						{
+							"name":        "X-Delta-Base",
+							"in":          "header",
+							"description": "差量上传时基准文件的 ETag（取自 /signature），与接收端当前文件不一致时返回 412",
+							"required":    false,
+							"type":        "string",
+						},
+						{
+							"name":        "X-On-Conflict",
+							"in":          "header",
+							"description": "同名文件已存在时的处理方式：overwrite、skip、fail、rename、version（默认使用服务器配置）",
+							"required":    false,
+							"type":        "string",
+							"enum":        []string{"overwrite", "skip", "fail", "rename", "version"},
+						},
 						{
 							"name":        "file",
 							"in":          "formData",
-							"description": "选择要上传的文件",
+							"description": "选择要上传的文件，可重复；文件名中的目录会保留",
 							"required":    true,
 							"type":        "file",
 						},
 					},
 					"responses": map[string]interface{}{
 						"200": map[string]interface{}{
-							"description": "上传成功",
+							"description": "上传成功（status 为 ok）或同名文件已跳过（status 为 skipped）",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/UploadResponse"},
 							"examples": map[string]interface{}{
-								"text/plain": "文件上传成功: example.zip (1024 bytes)",
+								"text/plain": "文件上传成功: example.zip (1024 bytes, sha256=..., created)",
+								"application/json": map[string]interface{}{
+									"status":      "ok",
+									"name":        "example.zip",
+									"stored":      "example.zip",
+									"bytes":       1024,
+									"digest":      "sha256=...",
+									"result":      "created",
+									"duration_ms": 12,
+									"speed":       85333.3,
+									"hops": []map[string]interface{}{
+										{"node": "gateway:17002", "mode": "forward", "duration_ms": 15},
+										{"node": "storage:17002", "mode": "receiver", "duration_ms": 12},
+									},
+									"message": "文件上传成功: example.zip (1024 bytes, sha256=..., created)",
+								},
 							},
 						},
+						"202": map[string]interface{}{
+							"description": "已接收部分数据，等待其余分块或分段（status 为 partial）",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/UploadResponse"},
+						},
 						"400": map[string]interface{}{
-							"description": "缺少文件名参数",
+							"description": "请求参数无效（bad_request、invalid_path、invalid_range、incomplete）",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/UploadResponse"},
+						},
+						"409": map[string]interface{}{
+							"description": "同名文件已存在（file_exists）、续传偏移不一致（offset_mismatch）或分块状态冲突（upload_conflict）",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/UploadResponse"},
+						},
+						"410": map[string]interface{}{
+							"description": "上传已通过 DELETE /transfers/{id} 取消（cancelled）",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/UploadResponse"},
+						},
+						"412": map[string]interface{}{
+							"description": "差量上传的基准文件已变化或不存在（base_changed），应改为完整上传",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/UploadResponse"},
+						},
+						"413": map[string]interface{}{
+							"description": "文件超过单文件大小上限（too_large）",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/UploadResponse"},
+						},
+						"422": map[string]interface{}{
+							"description": "完整性校验失败（digest_mismatch）",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/UploadResponse"},
 						},
 						"500": map[string]interface{}{
-							"description": "服务器错误",
+							"description": "服务器错误（internal_error）",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/UploadResponse"},
+						},
+						"502": map[string]interface{}{
+							"description": "转发到下一跳失败（upstream_error）",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/UploadResponse"},
+						},
+						"507": map[string]interface{}{
+							"description": "超出存储配额或磁盘剩余空间不足（insufficient_storage）",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/UploadResponse"},
+						},
+					},
+				},
+			},
+			"/files": map[string]interface{}{
+				"get": map[string]interface{}{
+					"summary":     "列出文件",
+					"description": "列出接收服务器存储目录中的文件，包含大小、修改时间、已知摘要和上传中标记，转发节点代理到下一跳",
+					"produces":    []string{"application/json"},
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "prefix",
+							"in":          "query",
+							"description": "路径前缀，例如 dataset/",
+							"required":    false,
+							"type":        "string",
+						},
+						{
+							"name":        "recursive",
+							"in":          "query",
+							"description": "是否递归列出子目录",
+							"required":    false,
+							"type":        "boolean",
+						},
+						{
+							"name":        "limit",
+							"in":          "query",
+							"description": "每页条目数（默认 1000，最大 10000）",
+							"required":    false,
+							"type":        "integer",
+						},
+						{
+							"name":        "cursor",
+							"in":          "query",
+							"description": "上一页响应中的 next_cursor",
+							"required":    false,
+							"type":        "string",
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "文件列表",
+						},
+						"400": map[string]interface{}{
+							"description": "参数无效",
+						},
+					},
+				},
+			},
+			"/files/{path}": map[string]interface{}{
+				"get": map[string]interface{}{
+					"summary":     "下载文件",
+					"description": "下载接收服务器存储目录中的文件，支持 Range 断点续传和 ETag/Last-Modified 条件请求，转发节点代理到下一跳",
+					"produces":    []string{"application/octet-stream"},
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "path",
+							"in":          "path",
+							"description": "存储目录中的相对路径",
+							"required":    true,
+							"type":        "string",
+						},
+						{
+							"name":        "Range",
+							"in":          "header",
+							"description": "续传范围，例如 bytes=1048576-",
+							"required":    false,
+							"type":        "string",
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "完整文件",
+						},
+						"206": map[string]interface{}{
+							"description": "部分内容",
+						},
+						"404": map[string]interface{}{
+							"description": "文件不存在",
+						},
+					},
+				},
+				"delete": map[string]interface{}{
+					"summary":     "删除文件",
+					"description": "删除接收服务器存储目录中的文件、符号链接（只删除链接本身）或空目录，需要 write 权限，转发节点转发到下一跳。供 gt sync --delete 使用",
+					"produces":    []string{"application/json", "text/plain"},
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "path",
+							"in":          "path",
+							"description": "存储目录中的相对路径",
+							"required":    true,
+							"type":        "string",
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "已删除（result 为 deleted）",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/UploadResponse"},
+						},
+						"400": map[string]interface{}{
+							"description": "路径不安全（invalid_path）",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/UploadResponse"},
+						},
+						"404": map[string]interface{}{
+							"description": "文件不存在（not_found）",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/UploadResponse"},
+						},
+						"409": map[string]interface{}{
+							"description": "目录非空（dir_not_empty）",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/UploadResponse"},
+						},
+					},
+				},
+			},
+			"/manifest": map[string]interface{}{
+				"get": map[string]interface{}{
+					"summary":     "目录清单",
+					"description": "递归列出目录中已完成的文件、子目录和符号链接（不分页，不含上传中的文件），包含大小、修改时间、摘要和链接目标，供 gt sync 比较。转发节点代理到下一跳",
+					"produces":    []string{"application/json"},
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "prefix",
+							"in":          "query",
+							"description": "目录的相对路径，例如 dataset，为空时列出整个存储目录",
+							"required":    false,
+							"type":        "string",
+						},
+						{
+							"name":        "checksum",
+							"in":          "query",
+							"description": "为尚无摘要的文件计算摘要（需要读取文件内容）",
+							"required":    false,
+							"type":        "boolean",
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "清单，entries 的每项包含 name（目录以 / 结尾）、type（file、dir、symlink）、size、mtime、digest、target",
+						},
+						"400": map[string]interface{}{
+							"description": "参数无效",
+						},
+					},
+				},
+			},
+			"/signature": map[string]interface{}{
+				"get": map[string]interface{}{
+					"summary":     "块签名",
+					"description": "返回接收端已有文件的块签名（每块 4 字节滚动弱校验和 16 字节强校验），客户端据此计算差量，只发送变化的块。转发节点代理到下一跳",
+					"produces":    []string{"application/json"},
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "name",
+							"in":          "query",
+							"description": "存储目录中的相对路径",
+							"required":    true,
+							"type":        "string",
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "签名，包含 name、size、block_size、etag（差量上传时以 X-Delta-Base 发回）和 blocks（base64）",
+						},
+						"400": map[string]interface{}{
+							"description": "参数无效",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/UploadResponse"},
+						},
+						"404": map[string]interface{}{
+							"description": "文件不存在（not_found）",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/UploadResponse"},
 						},
 					},
 				},
@@ -97,6 +385,208 @@ func generateSwaggerJSON(host string) string {
 					},
 				},
 			},
+			"/metrics": map[string]interface{}{
+				"get": map[string]interface{}{
+					"summary":     "运行指标",
+					"description": "Prometheus 文本格式的运行指标：接收/转发字节数、按状态码统计的上传数、进行中的上传、上传耗时和速度直方图、转发失败数、存储目录所在磁盘的剩余空间（仅接收模式）",
+					"produces":    []string{"text/plain"},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "Prometheus 文本格式（version 0.0.4）",
+						},
+					},
+				},
+			},
+			"/transfers": map[string]interface{}{
+				"get": map[string]interface{}{
+					"summary":     "传输列表",
+					"description": "本节点进行中的上传（按开始时间）和最近结束的上传（最新的在前），包含文件名、客户端地址、已传输字节数、总大小、速度、预计剩余时间、模式和下一跳",
+					"produces":    []string{"application/json"},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "传输列表",
+							"schema": map[string]interface{}{
+								"type": "object",
+								"properties": map[string]interface{}{
+									"transfers": map[string]interface{}{
+										"type":  "array",
+										"items": map[string]interface{}{"$ref": "#/definitions/Transfer"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/transfers/{id}/events": map[string]interface{}{
+				"get": map[string]interface{}{
+					"summary":     "传输进度事件流",
+					"description": "Server-Sent Events：传输进行中每 500ms 发送 progress 事件，完成时发送 complete 事件（含保存路径和摘要），失败或取消时发送 error 事件（含错误码），随后关闭连接。数据均为 Transfer。上传时用 X-Transfer-Id 请求头预先指定ID即可先订阅再上传（传输最多等待 30 秒出现）；转发节点转发最终接收端的事件",
+					"produces":    []string{"text/event-stream"},
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "id",
+							"in":          "path",
+							"description": "传输ID",
+							"required":    true,
+							"type":        "string",
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "事件流",
+						},
+						"404": map[string]interface{}{
+							"description": "传输不存在",
+						},
+					},
+				},
+			},
+			"/transfers/{id}": map[string]interface{}{
+				"get": map[string]interface{}{
+					"summary":  "查看传输",
+					"produces": []string{"application/json"},
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "id",
+							"in":          "path",
+							"description": "传输ID",
+							"required":    true,
+							"type":        "string",
+						},
+					},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{
+							"description": "传输信息",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Transfer"},
+						},
+						"404": map[string]interface{}{
+							"description": "传输不存在",
+						},
+					},
+				},
+				"delete": map[string]interface{}{
+					"summary":     "取消传输",
+					"description": "中止进行中的上传（需要 write 权限），上传请求返回 410，错误码 cancelled；接收端删除暂存文件",
+					"produces":    []string{"application/json"},
+					"parameters": []map[string]interface{}{
+						{
+							"name":        "id",
+							"in":          "path",
+							"description": "传输ID",
+							"required":    true,
+							"type":        "string",
+						},
+					},
+					"responses": map[string]interface{}{
+						"202": map[string]interface{}{
+							"description": "已取消",
+							"schema":      map[string]interface{}{"$ref": "#/definitions/Transfer"},
+						},
+						"404": map[string]interface{}{
+							"description": "传输不存在",
+						},
+						"409": map[string]interface{}{
+							"description": "传输已结束",
+						},
+					},
+				},
+			},
+		},
+		"definitions": map[string]interface{}{
+			"UploadResponse": map[string]interface{}{
+				"type":     "object",
+				"required": []string{"status", "bytes", "duration_ms", "speed", "message"},
+				"properties": map[string]interface{}{
+					"status": map[string]interface{}{
+						"type":        "string",
+						"description": "处理状态",
+						"enum":        []string{"ok", "partial", "skipped", "error"},
+					},
+					"name":   map[string]interface{}{"type": "string", "description": "请求的文件名"},
+					"stored": map[string]interface{}{"type": "string", "description": "实际保存的相对路径"},
+					"bytes":  map[string]interface{}{"type": "integer", "description": "已接收的字节数"},
+					"total":  map[string]interface{}{"type": "integer", "description": "文件总大小（partial 时）"},
+					"digest": map[string]interface{}{"type": "string", "description": "接收端计算的整个文件的摘要"},
+					"result": map[string]interface{}{
+						"type":        "string",
+						"description": "同名文件处理结果",
+						"enum":        []string{"created", "overwritten", "skipped", "renamed", "versioned", "ignored"},
+					},
+					"duration_ms": map[string]interface{}{"type": "integer", "description": "接收耗时（毫秒）"},
+					"speed":       map[string]interface{}{"type": "number", "description": "平均速度（字节/秒）"},
+					"hops": map[string]interface{}{
+						"type":        "array",
+						"description": "经过的节点，从客户端一侧开始",
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"node":        map[string]interface{}{"type": "string", "description": "主机名:端口"},
+								"mode":        map[string]interface{}{"type": "string", "enum": []string{"forward", "receiver"}},
+								"duration_ms": map[string]interface{}{"type": "integer", "description": "该节点处理请求的耗时（毫秒）"},
+							},
+						},
+					},
+					"files": map[string]interface{}{
+						"type":        "array",
+						"description": "表单包含多个文件时各文件的结果",
+						"items":       map[string]interface{}{"$ref": "#/definitions/UploadResponse"},
+					},
+					"archive": map[string]interface{}{
+						"type":        "object",
+						"description": "目录归档上传的解压统计",
+						"properties": map[string]interface{}{
+							"files":   map[string]interface{}{"type": "integer", "description": "解压的文件数"},
+							"dirs":    map[string]interface{}{"type": "integer", "description": "创建的目录数"},
+							"links":   map[string]interface{}{"type": "integer", "description": "创建的符号链接和硬链接数"},
+							"skipped": map[string]interface{}{"type": "integer", "description": "因同名文件已存在而跳过的条目数"},
+							"ignored": map[string]interface{}{
+								"type":        "array",
+								"description": "未解压的条目（不安全的链接、设备文件等）及原因",
+								"items":       map[string]interface{}{"type": "string"},
+							},
+						},
+					},
+					"error": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"code": map[string]interface{}{
+								"type": "string",
+								"enum": []string{"bad_request", "invalid_path", "invalid_range", "offset_mismatch", "upload_conflict",
+									"incomplete", "digest_mismatch", "file_exists", "too_large", "insufficient_storage",
+									"unauthorized", "forbidden", "method_not_allowed", "upstream_error", "shutting_down", "cancelled", "internal_error"},
+							},
+							"message": map[string]interface{}{"type": "string"},
+						},
+					},
+					"message": map[string]interface{}{"type": "string", "description": "供人阅读的说明，即纯文本响应的内容"},
+				},
+			},
+			"Transfer": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"id":       map[string]interface{}{"type": "string", "description": "传输ID"},
+					"name":     map[string]interface{}{"type": "string", "description": "请求的文件名"},
+					"remote":   map[string]interface{}{"type": "string", "description": "客户端地址"},
+					"mode":     map[string]interface{}{"type": "string", "enum": []string{"forward", "receiver"}},
+					"upstream": map[string]interface{}{"type": "string", "description": "转发模式的下一跳"},
+					"state": map[string]interface{}{
+						"type": "string",
+						"enum": []string{"running", "completed", "failed", "cancelled"},
+					},
+					"code":        map[string]interface{}{"type": "integer", "description": "已结束时的响应状态码"},
+					"stored":      map[string]interface{}{"type": "string", "description": "实际保存的相对路径（完成时）"},
+					"digest":      map[string]interface{}{"type": "string", "description": "接收端计算的摘要（完成时）"},
+					"error":       map[string]interface{}{"type": "string", "description": "失败时的错误码"},
+					"message":     map[string]interface{}{"type": "string"},
+					"bytes":       map[string]interface{}{"type": "integer", "description": "已传输的字节数"},
+					"total":       map[string]interface{}{"type": "integer", "description": "数据总大小，-1 表示未知"},
+					"speed":       map[string]interface{}{"type": "number", "description": "平均速度（字节/秒）"},
+					"eta_seconds": map[string]interface{}{"type": "integer", "description": "预计剩余时间（秒）"},
+					"started":     map[string]interface{}{"type": "string", "format": "date-time"},
+					"finished":    map[string]interface{}{"type": "string", "format": "date-time"},
+				},
+			},
 		},
 	}
 
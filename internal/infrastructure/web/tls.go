@@ -0,0 +1,243 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go-transfer/internal/constants"
+)
+
+// ServerTLSConfig 创建服务器TLS配置，clientCAFile 非空时启用双向认证（mTLS）
+func ServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("加载证书失败: %v", err)
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if clientCAFile != "" {
+		pool, err := loadCertPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// ClientTLSConfig 创建客户端TLS配置
+//   - caFile: 校验服务器证书的CA，为空时使用系统根证书
+//   - pin: 服务器证书的SHA-256指纹，设置后只信任该证书（适合自签名证书）；
+//     同时设置 caFile 时先校验证书链和主机名，再比对指纹
+//   - certFile/keyFile: 双向认证时使用的客户端证书
+func ClientTLSConfig(caFile, pin, certFile, keyFile string) (*tls.Config, error) {
+	if caFile == "" && pin == "" && certFile == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	if pin != "" {
+		expected := normalizeFingerprint(pin)
+		roots := config.RootCAs
+		// 指纹固定：跳过默认的链校验，未指定CA时只比对证书指纹
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return fmt.Errorf("服务器未提供证书")
+			}
+			if roots != nil {
+				if err := verifyChain(cs, roots); err != nil {
+					return err
+				}
+			}
+			sum := sha256.Sum256(cs.PeerCertificates[0].Raw)
+			if hex.EncodeToString(sum[:]) != expected {
+				return fmt.Errorf("服务器证书指纹不匹配")
+			}
+			return nil
+		}
+	}
+
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// verifyChain 按CA校验服务器证书链和主机名
+func verifyChain(cs tls.ConnectionState, roots *x509.CertPool) error {
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		DNSName:       cs.ServerName,
+	})
+	if err != nil {
+		return fmt.Errorf("服务器证书校验失败: %v", err)
+	}
+	return nil
+}
+
+// EnsureSelfSignedCert 在目录中查找或生成自签名证书，返回证书/私钥路径
+func EnsureSelfSignedCert(dir string) (certFile, keyFile string, err error) {
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+
+	// 已有且未过期的证书直接复用，保证指纹稳定
+	if cert, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil && time.Now().Before(leaf.NotAfter) {
+			return certFile, keyFile, nil
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", err
+	}
+	if err := generateSelfSigned(certFile, keyFile, time.Now().Add(constants.SelfSignedValidity)); err != nil {
+		return "", "", err
+	}
+	return certFile, keyFile, nil
+}
+
+// generateSelfSigned 生成有效期至 notAfter 的自签名证书和私钥
+func generateSelfSigned(certFile, keyFile string, notAfter time.Time) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "go-transfer", Organization: []string{"go-transfer"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           localIPs(),
+	}
+	if hostname != "" && hostname != "localhost" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := writePEM(certFile, "CERTIFICATE", der, 0644); err != nil {
+		return err
+	}
+	return writePEM(keyFile, "EC PRIVATE KEY", keyDER, 0600)
+}
+
+// CertFingerprint 返回证书文件的SHA-256指纹（冒号分隔的大写十六进制）
+func CertFingerprint(certFile string) (string, error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return "", fmt.Errorf("无效的证书文件: %s", certFile)
+	}
+
+	sum := sha256.Sum256(block.Bytes)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":"), nil
+}
+
+// loadCertPool 从PEM文件加载证书池
+func loadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("读取CA证书失败: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("CA证书中没有有效证书: %s", file)
+	}
+	return pool, nil
+}
+
+// normalizeFingerprint 统一指纹格式：去掉前缀和冒号，转为小写
+func normalizeFingerprint(pin string) string {
+	pin = strings.TrimSpace(pin)
+	if i := strings.Index(pin, ":"); i > 0 && strings.EqualFold(pin[:i], "sha256") {
+		pin = pin[i+1:]
+	}
+	return strings.ToLower(strings.ReplaceAll(pin, ":", ""))
+}
+
+// localIPs 返回本机所有IP地址（用于自签名证书的SAN）
+func localIPs() []net.IP {
+	ips := []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ips
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+	return ips
+}
+
+// writePEM 将DER数据以PEM格式写入文件
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	return os.WriteFile(path, data, perm)
+}
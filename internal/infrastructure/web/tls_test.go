@@ -0,0 +1,188 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newCert 生成一对自签名证书和私钥文件
+func newCert(t *testing.T, name string, notAfter time.Time) (certFile, keyFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	if err := generateSelfSigned(certFile, keyFile, notAfter); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// newClientCert 生成用于双向认证的客户端证书（自签名，同时作为服务器信任的CA）
+func newClientCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	writePEM(certFile, "CERTIFICATE", der, 0644)
+	writePEM(keyFile, "EC PRIVATE KEY", keyDER, 0600)
+	return certFile, keyFile
+}
+
+// startTLS 以给定配置启动 HTTPS 测试服务器
+func startTLS(t *testing.T, config *tls.Config) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = config
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// get 以客户端TLS配置请求服务器
+func get(srv *httptest.Server, config *tls.Config) error {
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func TestClientTLSConfigPinning(t *testing.T) {
+	certFile, keyFile := newCert(t, "server", time.Now().Add(time.Hour))
+	otherCA, _ := newCert(t, "other", time.Now().Add(time.Hour))
+	serverConfig, err := ServerTLSConfig(certFile, keyFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := startTLS(t, serverConfig)
+	pin, _ := CertFingerprint(certFile)
+	wrongPin, _ := CertFingerprint(otherCA)
+
+	tests := []struct {
+		name string
+		ca   string
+		pin  string
+		ok   bool
+	}{
+		{"仅CA", certFile, "", true},
+		{"CA不匹配", otherCA, "", false},
+		{"仅指纹", "", pin, true},
+		{"带前缀的小写指纹", "", "sha256:" + normalizeFingerprint(pin), true},
+		{"指纹不匹配", "", wrongPin, false},
+		{"CA和指纹", certFile, pin, true},
+		{"指纹匹配但CA不匹配", otherCA, pin, false},
+		{"CA匹配但指纹不匹配", certFile, wrongPin, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ClientTLSConfig(tt.ca, tt.pin, "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := get(srv, config); (err == nil) != tt.ok {
+				t.Errorf("连接结果 = %v, 期望成功 %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	certFile, keyFile := newCert(t, "server", time.Now().Add(time.Hour))
+	clientCert, clientKey := newClientCert(t)
+	serverConfig, err := ServerTLSConfig(certFile, keyFile, clientCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := startTLS(t, serverConfig)
+
+	anonymous, _ := ClientTLSConfig(certFile, "", "", "")
+	if err := get(srv, anonymous); err == nil {
+		t.Error("未提供客户端证书时连接应失败")
+	}
+	authenticated, err := ClientTLSConfig(certFile, "", clientCert, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := get(srv, authenticated); err != nil {
+		t.Errorf("提供客户端证书时连接失败: %v", err)
+	}
+	if _, err := ClientTLSConfig("", "", clientCert, "missing.pem"); err == nil {
+		t.Error("客户端私钥不存在时应返回错误")
+	}
+}
+
+func TestEnsureSelfSignedCert(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tls")
+	certFile, keyFile, err := EnsureSelfSignedCert(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := CertFingerprint(certFile)
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("私钥文件权限 = %v (%v)", info.Mode().Perm(), err)
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	if leaf.VerifyHostname("localhost") != nil || !containsIP(leaf.IPAddresses, net.ParseIP("127.0.0.1")) {
+		t.Errorf("证书缺少本机名称: %v %v", leaf.DNSNames, leaf.IPAddresses)
+	}
+
+	// 已有证书被复用，指纹不变
+	EnsureSelfSignedCert(dir)
+	if again, _ := CertFingerprint(certFile); again != first {
+		t.Error("未过期的证书被重新生成")
+	}
+
+	// 过期的证书重新生成
+	if err := generateSelfSigned(certFile, keyFile, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	expired, _ := CertFingerprint(certFile)
+	if _, _, err := EnsureSelfSignedCert(dir); err != nil {
+		t.Fatal(err)
+	}
+	renewed, _ := CertFingerprint(certFile)
+	if renewed == expired || renewed == first {
+		t.Error("过期的证书未重新生成")
+	}
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, candidate := range ips {
+		if candidate.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package web
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// uploadPage 内置的上传页面，不依赖外部资源
+//
+//go:embed static/upload.html
+var uploadPage []byte
+
+// HandleUploadPage 处理上传页面请求（仅根路径，其他未注册的路径返回 404）
+func HandleUploadPage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "仅支持GET方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(uploadPage)
+}
@@ -0,0 +1,206 @@
+package client
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/digest"
+	"go-transfer/internal/infrastructure/progress"
+	"go-transfer/internal/infrastructure/system"
+)
+
+// archiveStats 接收端返回的解压统计
+type archiveStats struct {
+	Files   int      `json:"files"`
+	Dirs    int      `json:"dirs"`
+	Links   int      `json:"links"`
+	Skipped int      `json:"skipped"`
+	Ignored []string `json:"ignored"`
+}
+
+// uploadArchive 以单个 tar 归档流式发送目录（保留权限、修改时间、空目录和符号链接），接收端边接收边解压。
+// 归档无法从中间续传，失败时需重新发送整个目录
+func (tc *TransferClient) uploadArchive() error {
+	baseDir := filepath.Base(tc.filePath)
+	scan, err := tc.scanUpload()
+	if err != nil {
+		return err
+	}
+	fileCount, totalSize := scan.files, scan.size
+	if tc.compress {
+		fmt.Printf("📦 以 tar 归档（gzip 压缩）发送 %d 个文件，总大小: %s\n\n", fileCount, system.FormatSize(totalSize))
+	} else {
+		fmt.Printf("📦 以 tar 归档发送 %d 个文件，总大小: %s\n\n", fileCount, system.FormatSize(totalSize))
+	}
+
+	// 边遍历目录边打包，经管道直接发送，不生成临时归档文件
+	total := progress.NewAggregateProgress(totalSize, fileCount, "总进度")
+	pipeReader, pipeWriter := io.Pipe()
+	archiveErr := make(chan error, 1)
+	go func() {
+		err := writeArchive(pipeWriter, scan, tc.compress, total)
+		pipeWriter.CloseWithError(err)
+		archiveErr <- err
+	}()
+	defer pipeReader.Close()
+
+	// 摘要覆盖发送的原始字节（压缩后），数据发送完毕后写入trailer
+	hasher, _ := digest.New(digest.DefaultAlgorithm)
+	body := &trailerReader{reader: io.TeeReader(pipeReader, hasher), eof: make(chan struct{})}
+	uploadURL := fmt.Sprintf("%s/upload?name=%s", tc.serverURL, url.QueryEscape(baseDir))
+	req, err := tc.newUploadRequest(uploadURL, body)
+	if err != nil {
+		return err
+	}
+	localDigest := ""
+	body.onEOF = func() {
+		localDigest = digest.Format(digest.DefaultAlgorithm, hasher)
+		req.Trailer.Set(constants.HeaderContentDigest, localDigest)
+	}
+	req.Header.Set("Content-Type", constants.ContentTypeTar)
+	if tc.compress {
+		req.Header.Set("Content-Encoding", constants.ArchiveGzip)
+	}
+	req.ContentLength = -1
+	req.Trailer = http.Header{constants.HeaderContentDigest: nil}
+
+	resp, err := tc.httpClient.Do(req)
+	if err != nil {
+		pipeReader.CloseWithError(err)
+		if werr := <-archiveErr; werr != nil && werr != err {
+			return fmt.Errorf("打包目录失败: %v", werr)
+		}
+		return err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("读取响应失败: %v", err)
+	}
+	total.PrintProgress()
+	fmt.Println()
+
+	if err := checkRejected(resp, respBody); err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp, respBody)
+	}
+	select {
+	case <-body.eof:
+	default:
+		return fmt.Errorf("请求体未完整发送")
+	}
+	if err := <-archiveErr; err != nil {
+		return fmt.Errorf("打包目录失败: %v", err)
+	}
+
+	parsed := parseUploadResponse(resp, respBody)
+	remoteDigest := resp.Header.Get(constants.HeaderContentDigest)
+	if parsed != nil && parsed.Digest != "" {
+		remoteDigest = parsed.Digest
+	}
+	if remoteDigest != "" && !digest.Equal(remoteDigest, localDigest) {
+		return fmt.Errorf("完整性校验失败: 本地 %s, 接收端 %s", localDigest, remoteDigest)
+	}
+
+	fmt.Println()
+	if parsed == nil || parsed.Archive == nil {
+		return nil
+	}
+	stats := parsed.Archive
+	fmt.Printf("📂 已解压到 %s: %d 个文件, %d 个目录, %d 个链接\n", parsed.Stored, stats.Files, stats.Dirs, stats.Links)
+	if stats.Skipped > 0 {
+		fmt.Printf("⏭️  %d 个条目在服务器上已存在，已跳过\n", stats.Skipped)
+	}
+	for _, ignored := range stats.Ignored {
+		fmt.Printf("⚠️  未解压: %s\n", ignored)
+	}
+	if len(parsed.Hops) > 1 {
+		nodes := make([]string, len(parsed.Hops))
+		for i, hop := range parsed.Hops {
+			nodes[i] = hop.Node
+		}
+		fmt.Printf("🛰️  经过节点: %s\n", strings.Join(nodes, " → "))
+	}
+	if remoteDigest != "" {
+		fmt.Printf("🔐 校验一致: %s\n", remoteDigest)
+	}
+	return nil
+}
+
+// writeArchive 将遍历选中的条目打包为 tar 写入 w，compress 为 true 时以 gzip 压缩。
+// 符号链接按链接本身打包，不跟随
+func writeArchive(w io.Writer, scan *treeScan, compress bool, total *progress.Progress) error {
+	out := w
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(w)
+		out = gz
+	}
+	tw := tar.NewWriter(out)
+
+	for _, entry := range scan.entries {
+		if err := writeArchiveEntry(tw, entry, total); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if gz != nil {
+		return gz.Close()
+	}
+	return nil
+}
+
+// writeArchiveEntry 写入单个条目的头部和内容
+func writeArchiveEntry(tw *tar.Writer, entry treeEntry, total *progress.Progress) error {
+	info := entry.info
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(entry.path); err != nil {
+			return err
+		}
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = entry.rel
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	// 不发送属主信息，接收端以服务进程的身份保存
+	hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	file, err := os.Open(entry.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := progress.NewProgressReader(file, hdr.Size, "")
+	reader.SetParent(total)
+	// 按打包时的大小发送，传输期间文件变化时报错而不是生成损坏的归档
+	if _, err := io.CopyN(tw, reader, hdr.Size); err != nil {
+		return fmt.Errorf("读取 %s 失败: %v", entry.rel, err)
+	}
+	total.FileDone()
+	return nil
+}
@@ -0,0 +1,219 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/digest"
+	"go-transfer/internal/infrastructure/progress"
+)
+
+// chunkSpan 单个分块的字节范围 [start, end]（包含）
+type chunkSpan struct {
+	start int64
+	end   int64
+}
+
+// splitChunks 将文件平均切分为 n 个分块
+func splitChunks(fileSize int64, n int) []chunkSpan {
+	size := (fileSize + int64(n) - 1) / int64(n)
+	var spans []chunkSpan
+	for start := int64(0); start < fileSize; start += size {
+		end := start + size - 1
+		if end >= fileSize {
+			end = fileSize - 1
+		}
+		spans = append(spans, chunkSpan{start: start, end: end})
+	}
+	return spans
+}
+
+// newUploadID 生成分块上传共享的上传ID
+func newUploadID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// hashLocalFile 计算本地文件的摘要
+func hashLocalFile(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher, _ := digest.New(digest.DefaultAlgorithm)
+	buffer := make([]byte, constants.LargeBufferSize)
+	if _, err := io.CopyBuffer(hasher, file, buffer); err != nil {
+		return "", err
+	}
+	return digest.Format(digest.DefaultAlgorithm, hasher), nil
+}
+
+// uploadChunked 将大文件切分为多个分块并发上传，接收端按偏移写入并在收齐后拼装，
+// 返回接收端确认的上传结果（摘要为整个文件的摘要）
+func (tc *TransferClient) uploadChunked(filePath, uploadName string, fileSize int64) (uploadResult, error) {
+	// 先计算整个文件的摘要，接收端拼装完成后据此校验
+	fmt.Println("🔐 计算文件摘要...")
+	fileDigest, err := hashLocalFile(filePath)
+	if err != nil {
+		return uploadResult{}, fmt.Errorf("计算文件摘要失败: %v", err)
+	}
+
+	spans := splitChunks(fileSize, tc.chunks)
+	uploadID := newUploadID()
+	fmt.Printf("🧩 分为 %d 个分块并发上传\n", len(spans))
+
+	total := progress.NewAggregateProgress(fileSize, len(spans), "分块上传")
+	errs := make([]error, len(spans))
+	finals := make([]uploadResult, len(spans))
+
+	var wg sync.WaitGroup
+	for i, span := range spans {
+		wg.Add(1)
+		go func(i int, span chunkSpan) {
+			defer wg.Done()
+			finals[i], errs[i] = tc.uploadChunk(filePath, uploadName, fileSize, span, uploadID, fileDigest, total)
+			total.FileDone()
+		}(i, span)
+	}
+	wg.Wait()
+	total.PrintProgress()
+	fmt.Println() // 进度条后换行
+
+	for i, err := range errs {
+		if _, permanent := err.(*rejectedError); permanent {
+			return uploadResult{}, err
+		}
+		if err != nil {
+			return uploadResult{}, fmt.Errorf("分块 %d/%d [%d-%d] 上传失败: %v", i+1, len(spans), spans[i].start, spans[i].end, err)
+		}
+	}
+
+	// 同名文件已存在时接收端直接跳过各分块
+	for _, result := range finals {
+		if result.conflict == constants.ResultSkipped {
+			return result, nil
+		}
+	}
+
+	// 最后到达的分块触发拼装，其响应携带整个文件的摘要
+	for _, result := range finals {
+		if result.digest == "" {
+			continue
+		}
+		if !digest.Equal(result.digest, fileDigest) {
+			return uploadResult{}, fmt.Errorf("完整性校验失败: 本地 %s, 接收端 %s", fileDigest, result.digest)
+		}
+		return result, nil
+	}
+	return uploadResult{}, fmt.Errorf("所有分块已发送，但接收端未完成拼装")
+}
+
+// uploadChunk 上传单个分块（失败时独立重试整个分块），拼装完成时返回接收端的上传结果
+func (tc *TransferClient) uploadChunk(filePath, uploadName string, fileSize int64, span chunkSpan, uploadID, fileDigest string, total *progress.Progress) (uploadResult, error) {
+	var lastErr error
+	for attempt := 1; attempt <= constants.MaxRetries; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * 2 * time.Second)
+		}
+
+		final, err := tc.doUploadChunk(filePath, uploadName, fileSize, span, uploadID, fileDigest, total)
+		if err == nil {
+			return final, nil
+		}
+		lastErr = err
+		if _, permanent := err.(*rejectedError); permanent {
+			return uploadResult{}, err
+		}
+	}
+	return uploadResult{}, fmt.Errorf("重试 %d 次后仍然失败: %v", constants.MaxRetries, lastErr)
+}
+
+// doUploadChunk 发送一个分块，分块摘要随trailer发送，失败时撤销本次尝试计入的进度
+func (tc *TransferClient) doUploadChunk(filePath, uploadName string, fileSize int64, span chunkSpan, uploadID, fileDigest string, total *progress.Progress) (_ uploadResult, err error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return uploadResult{}, fmt.Errorf("打开文件失败: %v", err)
+	}
+	defer file.Close()
+
+	length := span.end - span.start + 1
+	hasher, _ := digest.New(digest.DefaultAlgorithm)
+	reader := progress.NewProgressReader(io.NewSectionReader(file, span.start, length), length, "")
+	reader.SetHasher(hasher)
+	reader.SetParent(total)
+	defer func() {
+		if err != nil {
+			reader.Rollback()
+		}
+	}()
+
+	uploadURL := fmt.Sprintf("%s/upload?name=%s", tc.serverURL, url.QueryEscape(uploadName))
+	body := &trailerReader{reader: reader, eof: make(chan struct{})}
+	req, err := tc.newUploadRequest(uploadURL, body)
+	if err != nil {
+		return uploadResult{}, err
+	}
+	localDigest := ""
+	body.onEOF = func() {
+		localDigest = digest.Format(digest.DefaultAlgorithm, hasher)
+		req.Trailer.Set(constants.HeaderContentDigest, localDigest)
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.ContentLength = -1
+	req.Header.Set(constants.HeaderContentLength, strconv.FormatInt(length, 10))
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", span.start, span.end, fileSize))
+	req.Header.Set(constants.HeaderUploadID, uploadID)
+	req.Header.Set(constants.HeaderFileDigest, fileDigest)
+	if info, err := file.Stat(); err == nil {
+		setFileMeta(req.Header, info)
+	}
+	req.Trailer = http.Header{constants.HeaderContentDigest: nil}
+
+	resp, err := tc.httpClient.Do(req)
+	if err != nil {
+		return uploadResult{}, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return uploadResult{}, fmt.Errorf("读取响应失败: %v", err)
+	}
+
+	// 200 表示本分块触发了拼装（或同名文件已跳过），202 表示已接收、等待其余分块
+	if err := checkRejected(resp, respBody); err != nil {
+		return uploadResult{}, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return uploadResult{}, statusError(resp, respBody)
+	}
+	if result := readUploadResult(resp, respBody, constants.HeaderFileDigest); result.conflict == constants.ResultSkipped {
+		return result, nil
+	}
+
+	select {
+	case <-body.eof:
+	default:
+		return uploadResult{}, fmt.Errorf("请求体未完整发送")
+	}
+	if remote := resp.Header.Get(constants.HeaderContentDigest); remote != "" && !digest.Equal(remote, localDigest) {
+		return uploadResult{}, fmt.Errorf("分块校验失败: 本地 %s, 接收端 %s", localDigest, remote)
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		return readUploadResult(resp, respBody, constants.HeaderFileDigest), nil
+	}
+	return uploadResult{}, nil
+}
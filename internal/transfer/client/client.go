@@ -1,16 +1,23 @@
 package client
 
 import (
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/delta"
+	"go-transfer/internal/infrastructure/digest"
 	"go-transfer/internal/infrastructure/progress"
 	"go-transfer/internal/infrastructure/system"
 	"go-transfer/internal/infrastructure/web"
@@ -21,6 +28,15 @@ type TransferClient struct {
 	serverURL  string
 	filePath   string
 	isDir      bool
+	token      string
+	parallel   int         // 目录上传的并发数
+	chunks     int         // 单个大文件的分块并发数
+	onConflict string      // 同名文件冲突策略，为空时使用服务器默认策略
+	archive    bool        // 以单个 tar 归档发送目录
+	compress   bool        // 归档以 gzip 压缩
+	delta      bool        // 接收端已有旧版本的大文件只发送变化的块
+	filter     fileFilter  // 目录上传的筛选条件
+	tlsConfig  *tls.Config
 	httpClient *http.Client
 }
 
@@ -34,20 +50,89 @@ func (tc *TransferClient) SetServerURL(url string) {
 	tc.serverURL = url
 }
 
+// SetToken 设置访问令牌
+func (tc *TransferClient) SetToken(token string) {
+	tc.token = token
+}
+
+// SetTLSConfig 设置TLS配置（自定义CA、证书指纹、客户端证书）
+func (tc *TransferClient) SetTLSConfig(tlsConfig *tls.Config) {
+	tc.tlsConfig = tlsConfig
+	tc.rebuildClient()
+}
+
+// SetParallel 设置目录上传的并发数，连接池随之调整
+func (tc *TransferClient) SetParallel(n int) {
+	if n < 1 {
+		n = 1
+	}
+	if n > constants.MaxParallel {
+		n = constants.MaxParallel
+	}
+	tc.parallel = n
+	tc.rebuildClient()
+}
+
+// SetChunks 设置单个大文件切分的分块数（大于1时启用分块并发上传），连接池随之调整
+func (tc *TransferClient) SetChunks(n int) {
+	if n < 1 {
+		n = 1
+	}
+	if n > constants.MaxChunks {
+		n = constants.MaxChunks
+	}
+	tc.chunks = n
+	tc.rebuildClient()
+}
+
+// SetOnConflict 设置同名文件冲突策略（overwrite、skip、fail、rename、version）
+func (tc *TransferClient) SetOnConflict(policy string) {
+	tc.onConflict = policy
+}
+
+// SetArchive 设置是否以单个 tar 归档发送目录（保留权限、修改时间、空目录和符号链接）
+func (tc *TransferClient) SetArchive(archive bool) {
+	tc.archive = archive
+}
+
+// SetCompress 设置是否以 gzip 压缩归档，启用时隐含归档模式
+func (tc *TransferClient) SetCompress(compress bool) {
+	tc.compress = compress
+	if compress {
+		tc.archive = true
+	}
+}
+
+// SetDelta 设置是否对接收端已有旧版本的大文件使用块级差量传输
+func (tc *TransferClient) SetDelta(delta bool) {
+	tc.delta = delta
+}
+
+// rebuildClient 按TLS配置和最大并发数重建HTTP客户端
+func (tc *TransferClient) rebuildClient() {
+	conns := tc.parallel
+	if tc.chunks > conns {
+		conns = tc.chunks
+	}
+	tc.httpClient = web.CreateUploadClient(tc.tlsConfig, conns)
+}
+
 // SetIsDir 设置是否为目录
 func (tc *TransferClient) SetIsDir(isDir bool) {
 	tc.isDir = isDir
 }
 
-// GetDirStats 获取目录统计信息
-func (tc *TransferClient) GetDirStats(dirPath string) (int, int64) {
+// GetDirStats 获取按筛选条件选中的文件数、总大小和被排除的条目数
+func (tc *TransferClient) GetDirStats(dirPath string) (int, int64, int) {
 	return tc.getDirStats(dirPath)
 }
 
 // NewTransferClient 创建新的传输客户端
 func NewTransferClient() *TransferClient {
 	return &TransferClient{
-		httpClient: web.CreateUploadClient(),
+		parallel:   constants.DefaultParallel,
+		chunks:     constants.DefaultChunks,
+		httpClient: web.CreateUploadClient(nil, constants.DefaultParallel),
 	}
 }
 
@@ -62,7 +147,9 @@ func (tc *TransferClient) Upload() error {
 	startTime := time.Now()
 	
 	var err error
-	if tc.isDir {
+	if tc.isDir && tc.archive {
+		err = tc.uploadArchive()
+	} else if tc.isDir {
 		err = tc.uploadDirectory()
 	} else {
 		err = tc.uploadFile()
@@ -81,13 +168,10 @@ func (tc *TransferClient) Upload() error {
 
 // uploadFile 上传单个文件
 func (tc *TransferClient) uploadFile() error {
-	file, err := os.Open(tc.filePath)
+	fileInfo, err := os.Stat(tc.filePath)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	
-	fileInfo, _ := file.Stat()
 	fileSize := fileInfo.Size()
 	// 单个文件上传时，只使用文件名，不包含路径
 	fileName := filepath.Base(tc.filePath)
@@ -95,116 +179,322 @@ func (tc *TransferClient) uploadFile() error {
 	fmt.Printf("📁 文件: %s\n", fileName)
 	fmt.Printf("📊 大小: %s\n", system.FormatSize(fileSize))
 	
-	// 创建进度读取器
-	reader := progress.NewProgressReader(file, fileSize, "上传进度")
-	
-	// 构建上传URL，文件名不包含路径
-	uploadURL := fmt.Sprintf("%s/upload?name=%s", tc.serverURL, url.QueryEscape(fileName))
-	
-	// 创建请求
-	req, err := http.NewRequest("POST", uploadURL, reader)
-	if err != nil {
-		return err
+	// 接收端已有旧版本时只发送变化的块；否则大文件切分为多个分块并发上传，
+	// 其余单连接上传（失败时自动从已提交的偏移续传）
+	result, sent, err := tc.uploadDelta(tc.filePath, fileName, fileSize, nil)
+	if !sent {
+		if tc.chunks > 1 && fileSize >= constants.ChunkThreshold {
+			result, err = tc.uploadChunked(tc.filePath, fileName, fileSize)
+		} else {
+			result, err = tc.uploadSingleFile(tc.filePath, fileName, fileSize, nil)
+		}
 	}
-	
-	req.Header.Set("Content-Type", "application/octet-stream")
-	req.ContentLength = fileSize
-	
-	// 执行上传（使用共享的客户端）
-	resp, err := tc.httpClient.Do(req)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("服务器返回错误: %s", string(body))
-	}
 	
 	fmt.Println() // 换行
+	if note := result.describe(); note != "" {
+		fmt.Println(note)
+	}
+	if len(result.hops) > 1 {
+		fmt.Printf("🛰️  经过节点: %s\n", strings.Join(result.hops, " → "))
+	}
+	if result.delta != nil {
+		fmt.Printf("🧩 差量传输: 复用 %s，发送新数据 %s\n",
+			system.FormatSize(result.delta.Copied), system.FormatSize(result.delta.Literal))
+	}
+	if result.digest != "" {
+		fmt.Printf("🔐 校验一致: %s\n", result.digest)
+	}
 	return nil
 }
 
-// uploadDirectory 上传目录（逐个上传文件，保留路径结构）
-func (tc *TransferClient) uploadDirectory() error {
-	// 获取目录名称作为路径前缀
-	baseDir := filepath.Base(tc.filePath)
-	
-	// 收集所有文件信息
-	var files []struct {
-		path     string
-		relPath  string
-		size     int64
+// uploadResult 接收端确认的上传结果
+type uploadResult struct {
+	digest   string       // 接收端计算的摘要
+	conflict string       // 同名文件的处理结果（X-Conflict-Result）
+	stored   string       // 实际保存的相对路径
+	hops     []string     // 经过的节点，从客户端一侧开始
+	message  string       // 服务器的说明（条目未创建时为原因）
+	delta    *delta.Stats // 差量上传的统计，完整上传时为 nil
+}
+
+// uploadResponse 服务器 /upload 的 JSON 响应
+type uploadResponse struct {
+	Status string `json:"status"`
+	Stored string `json:"stored"`
+	Digest string `json:"digest"`
+	Result string `json:"result"`
+	Hops   []struct {
+		Node string `json:"node"`
+		Mode string `json:"mode"`
+	} `json:"hops"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+	Message string        `json:"message"`
+	Archive *archiveStats `json:"archive"`
+}
+
+// parseUploadResponse 解析 JSON 响应，服务器（或中间代理）返回其他格式时返回 nil
+func parseUploadResponse(resp *http.Response, body []byte) *uploadResponse {
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return nil
 	}
-	
-	var totalSize int64
-	
-	// 遍历目录收集文件信息
-	err := filepath.Walk(tc.filePath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		
-		// 跳过目录
-		if info.IsDir() {
-			return nil
-		}
-		
-		// 计算相对路径（相对于传入的目录）
-		relPath, err := filepath.Rel(tc.filePath, path)
-		if err != nil {
-			return err
-		}
-		
-		// 构建包含目录名的完整路径
-		uploadName := filepath.Join(baseDir, relPath)
-		// 将路径分隔符统一为斜杠（跨平台兼容）
-		uploadName = strings.ReplaceAll(uploadName, string(filepath.Separator), "/")
-		
-		files = append(files, struct {
-			path     string
-			relPath  string
-			size     int64
-		}{
-			path:    path,
-			relPath: uploadName,
-			size:    info.Size(),
-		})
-		
-		totalSize += info.Size()
+	var parsed uploadResponse
+	if json.Unmarshal(body, &parsed) != nil || parsed.Status == "" {
 		return nil
-	})
-	
+	}
+	return &parsed
+}
+
+// readUploadResult 读取上传结果，非 JSON 响应时从响应头读取
+func readUploadResult(resp *http.Response, body []byte, digestHeader string) uploadResult {
+	if parsed := parseUploadResponse(resp, body); parsed != nil {
+		result := uploadResult{digest: parsed.Digest, conflict: parsed.Result, stored: parsed.Stored, message: parsed.Message}
+		for _, hop := range parsed.Hops {
+			result.hops = append(result.hops, hop.Node)
+		}
+		return result
+	}
+	return uploadResult{
+		digest:   resp.Header.Get(digestHeader),
+		conflict: resp.Header.Get(constants.HeaderConflictResult),
+		stored:   resp.Header.Get(constants.HeaderStoredName),
+	}
+}
+
+// describe 返回同名文件处理结果的说明，无冲突时为空
+func (r uploadResult) describe() string {
+	switch r.conflict {
+	case constants.ResultSkipped:
+		return "⏭️  服务器上已存在同名文件，已跳过"
+	case constants.ResultOverwritten:
+		return "⚠️  已覆盖服务器上的同名文件"
+	case constants.ResultRenamed:
+		return fmt.Sprintf("📝 服务器上已存在同名文件，已另存为: %s", r.stored)
+	case constants.ResultVersioned:
+		return "🗂️  已覆盖服务器上的同名文件，旧版本已保留"
+	}
+	return ""
+}
+
+// deltaNote 差量上传时返回发送的新数据量，完整上传时为空
+func (r uploadResult) deltaNote() string {
+	if r.delta == nil {
+		return ""
+	}
+	return fmt.Sprintf(" 🧩 仅发送 %s", system.FormatSize(r.delta.Literal))
+}
+
+// serverError 返回响应中的错误码和说明，非 JSON 响应按状态码推断错误码
+func serverError(resp *http.Response, body []byte) (code, message string) {
+	if parsed := parseUploadResponse(resp, body); parsed != nil && parsed.Error != nil {
+		return parsed.Error.Code, parsed.Error.Message
+	}
+	message = strings.TrimSpace(string(body))
+	switch {
+	case resp.StatusCode == http.StatusConflict && resp.Header.Get(constants.HeaderConflictResult) == constants.ResultExists:
+		code = constants.ErrCodeFileExists
+	case resp.StatusCode == http.StatusRequestEntityTooLarge:
+		code = constants.ErrCodeTooLarge
+	case resp.StatusCode == http.StatusInsufficientStorage:
+		code = constants.ErrCodeInsufficientStorage
+	case resp.StatusCode == http.StatusGone:
+		code = constants.ErrCodeCancelled
+	}
+	return code, message
+}
+
+// statusError 服务器返回的其他错误
+func statusError(resp *http.Response, body []byte) error {
+	_, message := serverError(resp, body)
+	return fmt.Errorf("服务器返回错误: %s", message)
+}
+
+// rejectedError 服务器明确拒绝的上传（同名文件已存在、超过大小上限、存储空间不足、被管理员取消），不重试
+type rejectedError struct {
+	reason  string
+	message string
+}
+
+func (e *rejectedError) Error() string {
+	return fmt.Sprintf("%s: %s", e.reason, e.message)
+}
+
+// checkRejected 识别同名文件已存在（fail 策略）、超过大小上限、存储空间不足和已取消的响应
+func checkRejected(resp *http.Response, body []byte) error {
+	code, message := serverError(resp, body)
+	switch code {
+	case constants.ErrCodeFileExists:
+		return &rejectedError{reason: "服务器上已存在同名文件", message: message}
+	case constants.ErrCodeTooLarge:
+		return &rejectedError{reason: "文件超过服务器允许的大小", message: message}
+	case constants.ErrCodeInsufficientStorage:
+		return &rejectedError{reason: "服务器存储空间不足", message: message}
+	case constants.ErrCodeCancelled:
+		return &rejectedError{reason: "上传已在服务器上被取消", message: message}
+	}
+	return nil
+}
+
+// dirFile 目录上传中的单个文件
+type dirFile struct {
+	path    string
+	relPath string
+	size    int64
+	modTime time.Time
+}
+
+// dirResult 单个文件的上传结果，按收集顺序汇总输出
+type dirResult struct {
+	upload uploadResult
+	err    error
+}
+
+// uploadDirectory 上传目录（工作池并发上传文件，保留路径结构）
+func (tc *TransferClient) uploadDirectory() error {
+	// 按筛选条件遍历目录（符号链接不跟随），目录和符号链接作为条目在文件之后发送
+	scan, err := tc.scanUpload()
 	if err != nil {
 		return err
 	}
-	
-	if len(files) == 0 {
-		return fmt.Errorf("目录中没有文件")
+	files, links, dirs, err := splitTree(scan, filepath.Base(tc.filePath))
+	if err != nil {
+		return err
 	}
 	
-	fmt.Printf("📂 准备上传 %d 个文件，总大小: %s\n\n", len(files), system.FormatSize(totalSize))
+	failed := tc.uploadFiles(files, scan.size)
 	
+	// 空目录同样发送，接收端创建对应的目录；
+	// 子目录先于上级目录发送（Walk 顺序反转），目录的修改时间在其中的条目都创建之后设置
+	entries := links
+	for i := len(dirs) - 1; i >= 0; i-- {
+		entries = append(entries, dirs[i])
+	}
+	fmt.Println()
+	entryFailed := tc.uploadEntries(entries)
 	
-	// 逐个上传文件（严格串行，一次只上传一个）
-	for i, fileInfo := range files {
-		fmt.Printf("[%d/%d] 上传: %s (%s)\n", i+1, len(files), fileInfo.relPath, system.FormatSize(fileInfo.size))
-		
-		// 上传单个文件
-		err := tc.uploadSingleFile(fileInfo.path, fileInfo.relPath, fileInfo.size)
-		if err != nil {
-			return fmt.Errorf("上传失败 %s: %v", fileInfo.relPath, err)
+	if failed > 0 {
+		return fmt.Errorf("%d/%d 个文件上传失败", failed, len(files))
+	}
+	if entryFailed > 0 {
+		return fmt.Errorf("%d 个目录或符号链接创建失败", entryFailed)
+	}
+	return nil
+}
+
+// scanUpload 按筛选条件遍历要上传的目录，输出跳过的特殊文件
+func (tc *TransferClient) scanUpload() (*treeScan, error) {
+	scan, err := tc.scanTree(tc.filePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range scan.special {
+		fmt.Printf("⚠️  跳过特殊文件: %s\n", rel)
+	}
+	if scan.files == 0 && tc.filter.selective() {
+		return nil, fmt.Errorf("没有符合筛选条件的文件")
+	}
+	return scan, nil
+}
+
+// splitTree 将遍历结果分为文件、符号链接和目录（按遍历顺序），名称带上传目录名前缀、以斜杠分隔
+func splitTree(scan *treeScan, baseDir string) ([]dirFile, []dirEntry, []dirEntry, error) {
+	var files []dirFile
+	var links, dirs []dirEntry
+	for _, entry := range scan.entries {
+		uploadName := path.Join(baseDir, entry.rel)
+		switch {
+		case entry.info.IsDir():
+			dirs = append(dirs, dirEntry{kind: constants.EntryDir, relPath: uploadName, info: entry.info})
+		case entry.info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(entry.path)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			links = append(links, dirEntry{kind: constants.EntrySymlink, relPath: uploadName, target: target, info: entry.info})
+		default:
+			files = append(files, dirFile{
+				path:    entry.path,
+				relPath: uploadName,
+				size:    entry.info.Size(),
+				modTime: entry.info.ModTime(),
+			})
 		}
-		
-		fmt.Println() // 进度条后换行
 	}
+	return files, links, dirs, nil
+}
+
+// uploadFiles 以工作池并发上传文件，按顺序输出各文件的结果，返回失败数
+func (tc *TransferClient) uploadFiles(files []dirFile, totalSize int64) int {
+	workers := tc.parallel
+	if workers > len(files) {
+		workers = len(files)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	fmt.Printf("📂 准备上传 %d 个文件，总大小: %s（并发 %d）\n\n", len(files), system.FormatSize(totalSize), workers)
+	
+	// 所有文件共用一个汇总进度，每个文件的重试相互独立
+	total := progress.NewAggregateProgress(totalSize, len(files), "总进度")
+	results := make([]dirResult, len(files))
+	jobs := make(chan int)
+	
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				f := files[i]
+				result, sent, err := tc.uploadDelta(f.path, f.relPath, f.size, total)
+				if !sent {
+					result, err = tc.uploadSingleFile(f.path, f.relPath, f.size, total)
+				}
+				results[i] = dirResult{upload: result, err: err}
+				total.FileDone()
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	total.PrintProgress()
+	fmt.Println() // 进度条后换行
 	
-	return nil
+	// 按目录顺序输出汇总
+	failed, skipped := 0, 0
+	fmt.Println()
+	for i, f := range files {
+		result := results[i].upload
+		switch {
+		case results[i].err != nil:
+			failed++
+			fmt.Printf("❌ [%d/%d] %s (%s): %v\n", i+1, len(files), f.relPath, system.FormatSize(f.size), results[i].err)
+		case result.conflict == constants.ResultSkipped:
+			skipped++
+			fmt.Printf("⏭️  [%d/%d] %s (%s): 已存在，已跳过\n", i+1, len(files), f.relPath, system.FormatSize(f.size))
+		case result.conflict == constants.ResultRenamed:
+			fmt.Printf("✅ [%d/%d] %s (%s) → %s%s\n", i+1, len(files), f.relPath, system.FormatSize(f.size), result.stored, result.deltaNote())
+		default:
+			fmt.Printf("✅ [%d/%d] %s (%s)%s\n", i+1, len(files), f.relPath, system.FormatSize(f.size), result.deltaNote())
+		}
+	}
+	if skipped > 0 {
+		fmt.Printf("\n⏭️  %d 个文件在服务器上已存在，已跳过\n", skipped)
+	}
+	return failed
 }
 
-// uploadSingleFile 上传单个文件（内部方法）
-func (tc *TransferClient) uploadSingleFile(filePath, uploadName string, fileSize int64) error {
+// uploadSingleFile 上传单个文件（内部方法），返回接收端确认的上传结果。
+// total 不为 nil 时进度计入该汇总进度，不再单独显示进度条
+func (tc *TransferClient) uploadSingleFile(filePath, uploadName string, fileSize int64, total *progress.Progress) (uploadResult, error) {
 	// 重试机制
 	maxRetries := constants.MaxRetries
 	var lastErr error
@@ -213,17 +503,29 @@ func (tc *TransferClient) uploadSingleFile(filePath, uploadName string, fileSize
 		// 如果是重试，等待一段时间让系统释放端口
 		if attempt > 1 {
 			waitTime := time.Duration(attempt-1) * 2 * time.Second
-			fmt.Printf("\n⏳ 等待 %v 后重试 (第 %d/%d 次)...\n", waitTime, attempt, maxRetries)
+			fmt.Printf("\n⏳ %s: 等待 %v 后重试 (第 %d/%d 次)...\n", uploadName, waitTime, attempt, maxRetries)
 			time.Sleep(waitTime)
 		}
 		
+		// 查询接收端已提交的偏移，只发送剩余部分
+		offset, err := tc.queryUploadOffset(uploadName)
+		if err != nil || offset >= fileSize {
+			offset = 0
+		}
+		if offset > 0 && total == nil {
+			fmt.Printf("🔁 从 %s 处续传\n", system.FormatSize(offset))
+		}
+		
 		// 执行上传
-		err := tc.doUploadSingleFile(filePath, uploadName, fileSize)
+		result, err := tc.doUploadSingleFile(filePath, uploadName, fileSize, offset, total)
 		if err == nil {
-			return nil
+			return result, nil
 		}
 		
 		lastErr = err
+		if _, permanent := err.(*rejectedError); permanent {
+			return uploadResult{}, err
+		}
 		
 		// 检查是否是端口耗尽错误
 		if strings.Contains(err.Error(), "Only one usage of each socket address") ||
@@ -237,32 +539,112 @@ func (tc *TransferClient) uploadSingleFile(filePath, uploadName string, fileSize
 		}
 	}
 	
-	return fmt.Errorf("重试 %d 次后仍然失败: %v", maxRetries, lastErr)
+	return uploadResult{}, fmt.Errorf("重试 %d 次后仍然失败: %v", maxRetries, lastErr)
+}
+
+// newRequest 创建请求并附加访问令牌
+func (tc *TransferClient) newRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if tc.token != "" {
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+	}
+	return req, nil
+}
+
+// newUploadRequest 创建上传请求，要求 JSON 响应并附加冲突策略
+func (tc *TransferClient) newUploadRequest(url string, body io.Reader) (*http.Request, error) {
+	req, err := tc.newRequest(http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if tc.onConflict != "" {
+		req.Header.Set(constants.HeaderOnConflict, tc.onConflict)
+	}
+	return req, nil
+}
+
+// queryUploadOffset 查询接收端已提交的字节偏移
+func (tc *TransferClient) queryUploadOffset(uploadName string) (int64, error) {
+	queryURL := fmt.Sprintf("%s/upload?name=%s", tc.serverURL, url.QueryEscape(uploadName))
+	req, err := tc.newRequest(http.MethodHead, queryURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	
+	resp, err := tc.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("查询偏移失败: %s", resp.Status)
+	}
+	return strconv.ParseInt(resp.Header.Get(constants.HeaderUploadOffset), 10, 64)
 }
 
-// doUploadSingleFile 实际执行上传
-func (tc *TransferClient) doUploadSingleFile(filePath, uploadName string, fileSize int64) error {
+// doUploadSingleFile 实际执行上传，offset > 0 时只发送剩余部分，返回校验一致的上传结果。
+// total 不为 nil 时进度计入汇总进度，失败时撤销本次尝试的计数
+func (tc *TransferClient) doUploadSingleFile(filePath, uploadName string, fileSize, offset int64, total *progress.Progress) (_ uploadResult, err error) {
 	// 打开文件
 	file, err := os.Open(filePath)
 	if err != nil {
-		return fmt.Errorf("打开文件失败: %v", err)
+		return uploadResult{}, fmt.Errorf("打开文件失败: %v", err)
 	}
 	defer file.Close()
 	
-	// 创建进度读取器
-	reader := progress.NewProgressReader(file, fileSize, "上传进度")
+	// 摘要覆盖整个文件：续传时先补算已提交的部分（同时定位到续传偏移）
+	hasher, _ := digest.New(digest.DefaultAlgorithm)
+	if offset > 0 {
+		if _, err := io.CopyN(hasher, file, offset); err != nil {
+			return uploadResult{}, fmt.Errorf("定位续传偏移失败: %v", err)
+		}
+	}
+	
+	// 创建进度读取器，边发送边计算摘要
+	reader := progress.NewProgressReader(file, fileSize-offset, "上传进度")
+	reader.SetHasher(hasher)
+	if total != nil {
+		// 已提交的部分计入汇总进度，失败时连同本次发送的数据一起撤销
+		reader.SetParent(total)
+		reader.Add(offset)
+		defer func() {
+			if err != nil {
+				reader.Rollback()
+			}
+		}()
+	}
 	
 	// 构建上传URL
 	uploadURL := fmt.Sprintf("%s/upload?name=%s", tc.serverURL, url.QueryEscape(uploadName))
 	
-	// 创建请求
-	req, err := http.NewRequest("POST", uploadURL, reader)
+	// 创建请求，数据发送完毕后将摘要写入trailer
+	body := &trailerReader{reader: reader, eof: make(chan struct{})}
+	req, err := tc.newUploadRequest(uploadURL, body)
 	if err != nil {
-		return err
+		return uploadResult{}, err
+	}
+	localDigest := ""
+	body.onEOF = func() {
+		localDigest = digest.Format(digest.DefaultAlgorithm, hasher)
+		req.Trailer.Set(constants.HeaderContentDigest, localDigest)
 	}
 	
 	req.Header.Set("Content-Type", "application/octet-stream")
-	req.ContentLength = fileSize
+	if info, err := file.Stat(); err == nil {
+		setFileMeta(req.Header, info)
+	}
+	// trailer 只能随分块编码发送，长度改由 X-Content-Length 声明
+	req.ContentLength = -1
+	req.Header.Set(constants.HeaderContentLength, strconv.FormatInt(fileSize-offset, 10))
+	req.Trailer = http.Header{constants.HeaderContentDigest: nil}
+	if offset > 0 {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, fileSize-1, fileSize))
+	}
 	// 强制使用 HTTP/1.1 并启用 Keep-Alive
 	req.Header.Set("Connection", "keep-alive")
 	req.ProtoMajor = 1
@@ -271,45 +653,73 @@ func (tc *TransferClient) doUploadSingleFile(filePath, uploadName string, fileSi
 	// 执行上传（使用共享的客户端）
 	resp, err := tc.httpClient.Do(req)
 	if err != nil {
-		return err
+		return uploadResult{}, err
 	}
 	
-	// 读取响应体（确保连接可以被复用）
-	body, err := io.ReadAll(resp.Body)
-	resp.Body.Close() // 立即关闭响应体
+	// 同名文件已存在、服务器未接收数据
+	result, err := readUploadReply(resp)
+	if err != nil || result.conflict == constants.ResultSkipped {
+		return result, err
+	}
 	
-	if err != nil {
-		return fmt.Errorf("读取响应失败: %v", err)
+	// 比对接收端计算的摘要（经过不传递trailer的代理时仍可端到端校验）
+	remoteDigest := result.digest
+	select {
+	case <-body.eof:
+	default:
+		return uploadResult{}, fmt.Errorf("请求体未完整发送")
+	}
+	if remoteDigest != "" && !digest.Equal(remoteDigest, localDigest) {
+		return uploadResult{}, fmt.Errorf("完整性校验失败: 本地 %s, 接收端 %s", localDigest, remoteDigest)
 	}
 	
+	return result, nil
+}
+
+// readUploadReply 读取并关闭上传响应（确保连接可以被复用），返回接收端确认的上传结果
+func readUploadReply(resp *http.Response) (uploadResult, error) {
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return uploadResult{}, fmt.Errorf("读取响应失败: %v", err)
+	}
+
 	// 检查响应状态
+	if err := checkRejected(resp, respBody); err != nil {
+		return uploadResult{}, err
+	}
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("服务器返回错误: %s", string(body))
+		return uploadResult{}, statusError(resp, respBody)
 	}
-	
-	return nil
+	return readUploadResult(resp, respBody, constants.HeaderContentDigest), nil
+}
+
+// trailerReader 在读到EOF时回调，用于在请求体结束前填充trailer
+type trailerReader struct {
+	reader io.Reader
+	onEOF  func()
+	eof    chan struct{} // 回调完成后关闭
+	done   bool
+}
+
+// Read 实现 io.Reader 接口
+func (t *trailerReader) Read(b []byte) (int, error) {
+	n, err := t.reader.Read(b)
+	if err == io.EOF && !t.done {
+		t.done = true
+		t.onEOF()
+		close(t.eof)
+	}
+	return n, err
 }
 
 // 注意：进度跟踪功能已移至 progress.go 统一管理
 // 使用 NewProgressReader 创建进度跟踪器
 
-// getDirStats 获取目录统计信息
-func (tc *TransferClient) getDirStats(dirPath string) (int, int64) {
-	var fileCount int
-	var totalSize int64
-	
-	filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil
-		}
-		if !info.IsDir() {
-			fileCount++
-			totalSize += info.Size()
-		}
-		return nil
-	})
-	
-	return fileCount, totalSize
+// getDirStats 获取目录统计信息（按筛选条件，符号链接等不携带数据的条目不计入）
+func (tc *TransferClient) getDirStats(dirPath string) (int, int64, int) {
+	scan, _ := tc.scanTree(dirPath)
+	return scan.files, scan.size, scan.excluded
 }
 
 
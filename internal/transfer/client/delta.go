@@ -0,0 +1,163 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/delta"
+	"go-transfer/internal/infrastructure/digest"
+	"go-transfer/internal/infrastructure/progress"
+	"go-transfer/internal/infrastructure/system"
+)
+
+// errNoBase 接收端没有可作为差量基准的文件
+var errNoBase = errors.New("接收端没有旧版本")
+
+// uploadDelta 启用差量传输且文件不小于 DeltaMinSize 时，以接收端已有的旧版本为基准只发送变化的块。
+// sent 为 false 表示未使用差量（接收端没有旧版本、基准已变化或差量上传失败），由调用方完整上传
+func (tc *TransferClient) uploadDelta(filePath, uploadName string, fileSize int64, total *progress.Progress) (result uploadResult, sent bool, err error) {
+	if !tc.delta || fileSize < constants.DeltaMinSize {
+		return uploadResult{}, false, nil
+	}
+	sig, etag, err := tc.fetchSignature(uploadName)
+	if err == errNoBase {
+		return uploadResult{}, false, nil
+	}
+	if err != nil {
+		fmt.Printf("\n⚠️  %s: 获取块签名失败，改为完整上传: %v\n", uploadName, err)
+		return uploadResult{}, false, nil
+	}
+	if total == nil {
+		fmt.Printf("🧩 服务器上已有旧版本 (%s)，按 %s 的块发送差量\n",
+			system.FormatSize(sig.Size), system.FormatSize(int64(sig.BlockSize)))
+	}
+
+	result, err = tc.doUploadDelta(filePath, uploadName, fileSize, sig, etag, total)
+	if _, permanent := err.(*rejectedError); permanent {
+		return uploadResult{}, true, err
+	}
+	if err != nil {
+		fmt.Printf("\n⚠️  %s: 差量上传失败，改为完整上传: %v\n", uploadName, err)
+		return uploadResult{}, false, nil
+	}
+	return result, true, nil
+}
+
+// fetchSignature 获取接收端已有文件的块签名和计算签名时的 ETag，文件不存在时返回 errNoBase
+func (tc *TransferClient) fetchSignature(uploadName string) (*delta.Signature, string, error) {
+	query := url.Values{}
+	query.Set("name", uploadName)
+	req, err := tc.newRequest(http.MethodGet, tc.serverURL+constants.SignatureRoute+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := tc.httpClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, "", errNoBase
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, constants.MaxUploadResponse))
+		return nil, "", statusError(resp, body)
+	}
+
+	var parsed struct {
+		Size      int64  `json:"size"`
+		BlockSize int    `json:"block_size"`
+		ETag      string `json:"etag"`
+		Blocks    []byte `json:"blocks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, "", fmt.Errorf("解析块签名失败: %v", err)
+	}
+	sig, err := delta.Unmarshal(parsed.Size, parsed.BlockSize, parsed.Blocks)
+	if err != nil {
+		return nil, "", err
+	}
+	return sig, parsed.ETag, nil
+}
+
+// doUploadDelta 边读取本地文件边与签名比较，将差量指令流式发送到接收端，
+// 整个文件的摘要随trailer发送，由接收端对重建出的文件校验
+func (tc *TransferClient) doUploadDelta(filePath, uploadName string, fileSize int64, sig *delta.Signature, etag string, total *progress.Progress) (_ uploadResult, err error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return uploadResult{}, fmt.Errorf("打开文件失败: %v", err)
+	}
+	defer file.Close()
+
+	hasher, _ := digest.New(digest.DefaultAlgorithm)
+	reader := progress.NewProgressReader(file, fileSize, "上传进度")
+	reader.SetHasher(hasher)
+	if total != nil {
+		reader.SetParent(total)
+		defer func() {
+			if err != nil {
+				reader.Rollback()
+			}
+		}()
+	}
+
+	// 编码与发送并行，接收端提前返回时关闭管道使编码结束
+	pipeReader, pipeWriter := io.Pipe()
+	defer pipeReader.Close()
+	var stats delta.Stats
+	go func() {
+		var encodeErr error
+		stats, encodeErr = delta.Encode(pipeWriter, sig, reader)
+		pipeWriter.CloseWithError(encodeErr)
+	}()
+
+	uploadURL := fmt.Sprintf("%s/upload?name=%s", tc.serverURL, url.QueryEscape(uploadName))
+	body := &trailerReader{reader: pipeReader, eof: make(chan struct{})}
+	req, err := tc.newUploadRequest(uploadURL, body)
+	if err != nil {
+		return uploadResult{}, err
+	}
+	localDigest := ""
+	body.onEOF = func() {
+		localDigest = digest.Format(digest.DefaultAlgorithm, hasher)
+		req.Trailer.Set(constants.HeaderContentDigest, localDigest)
+	}
+
+	req.Header.Set("Content-Type", constants.ContentTypeDelta)
+	req.Header.Set(constants.HeaderDeltaBase, etag)
+	if info, err := file.Stat(); err == nil {
+		setFileMeta(req.Header, info)
+	}
+	// 请求体长度事先未知，X-Content-Length 声明重建后的文件大小
+	req.ContentLength = -1
+	req.Header.Set(constants.HeaderContentLength, strconv.FormatInt(fileSize, 10))
+	req.Trailer = http.Header{constants.HeaderContentDigest: nil}
+
+	resp, err := tc.httpClient.Do(req)
+	if err != nil {
+		return uploadResult{}, err
+	}
+	result, err := readUploadReply(resp)
+	if err != nil || result.conflict == constants.ResultSkipped {
+		return result, err
+	}
+
+	select {
+	case <-body.eof:
+	default:
+		return uploadResult{}, fmt.Errorf("请求体未完整发送")
+	}
+	if result.digest != "" && !digest.Equal(result.digest, localDigest) {
+		return uploadResult{}, fmt.Errorf("完整性校验失败: 本地 %s, 接收端 %s", localDigest, result.digest)
+	}
+	result.delta = &stats
+	return result, nil
+}
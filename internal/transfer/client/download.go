@@ -0,0 +1,180 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/progress"
+	"go-transfer/internal/infrastructure/system"
+)
+
+// SplitFileURL 将 gt get/ls 的地址拆分为服务器地址和存储目录中的相对路径（可能为空），
+// 支持 http://host:port/files/dir/a.txt 和 http://host:port/dir/a.txt 两种形式
+func SplitFileURL(rawURL string) (serverURL, remotePath string, err error) {
+	if !strings.HasPrefix(rawURL, "http://") && !strings.HasPrefix(rawURL, "https://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	p := u.Path
+	base := ""
+	if i := strings.Index(p+"/", constants.FilesRoute); i >= 0 {
+		base, p = p[:i], strings.TrimPrefix(p[i:], constants.ListRoute)
+	}
+	return u.Scheme + "://" + u.Host + base, strings.Trim(p, "/"), nil
+}
+
+// filesURL 返回服务器存储中文件的地址，路径各段分别转义
+func (tc *TransferClient) filesURL(remotePath string) string {
+	var escaped []string
+	for _, part := range strings.Split(remotePath, "/") {
+		escaped = append(escaped, url.PathEscape(part))
+	}
+	return tc.serverURL + constants.FilesRoute + strings.Join(escaped, "/")
+}
+
+// Download 下载服务器存储目录中的文件到 dest（为空或目录时使用远程文件名），
+// 未完成的下载保存在 .gtpart 文件中，重新执行时从已下载的位置续传
+func (tc *TransferClient) Download(remotePath, dest string) error {
+	fileName := path.Base(remotePath)
+	if dest == "" {
+		dest = fileName
+	} else if info, err := os.Stat(dest); err == nil && info.IsDir() {
+		dest = filepath.Join(dest, fileName)
+	}
+
+	fmt.Println()
+	system.PrintSeparator()
+	fmt.Println("⏳ 开始下载...")
+	system.PrintSeparator()
+	fmt.Printf("📄 远程: %s\n", remotePath)
+	fmt.Printf("📁 保存到: %s\n", dest)
+
+	startTime := time.Now()
+	var lastErr error
+	for attempt := 1; attempt <= constants.MaxRetries; attempt++ {
+		if attempt > 1 {
+			waitTime := time.Duration(attempt-1) * 2 * time.Second
+			fmt.Printf("\n⏳ 等待 %v 后重试 (第 %d/%d 次)...\n", waitTime, attempt, constants.MaxRetries)
+			time.Sleep(waitTime)
+		}
+
+		lastErr = tc.doDownload(remotePath, dest)
+		if lastErr == nil {
+			fmt.Printf("\n✅ 下载成功！\n")
+			fmt.Printf("   总耗时: %.1f秒\n", time.Since(startTime).Seconds())
+			return nil
+		}
+		if _, permanent := lastErr.(*downloadError); permanent {
+			break
+		}
+	}
+	return fmt.Errorf("❌ 下载失败: %v", lastErr)
+}
+
+// downloadError 服务器明确拒绝的下载（不重试）
+type downloadError struct {
+	status string
+	body   string
+}
+
+func (e *downloadError) Error() string {
+	return fmt.Sprintf("服务器返回错误: %s %s", e.status, strings.TrimSpace(e.body))
+}
+
+// doDownload 执行一次下载，已有部分数据时携带 Range 和 If-Range 续传
+func (tc *TransferClient) doDownload(remotePath, dest string) error {
+	partPath := dest + constants.PartialSuffix
+	etagPath := partPath + constants.ETagSuffix
+
+	// 已下载的部分及其对应的ETag（文件在服务器上被替换后不能拼接）
+	var offset int64
+	etag, _ := os.ReadFile(etagPath)
+	if info, err := os.Stat(partPath); err == nil && len(etag) > 0 {
+		offset = info.Size()
+	}
+
+	req, err := tc.newRequest(http.MethodGet, tc.filesURL(remotePath), nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", string(etag))
+	}
+
+	resp, err := tc.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		fmt.Printf("🔁 从 %s 处续传\n", system.FormatSize(offset))
+		flags = os.O_WRONLY | os.O_APPEND
+	case http.StatusOK:
+		offset = 0
+	case http.StatusRequestedRangeNotSatisfiable:
+		// 本地部分已不匹配，丢弃后重新下载
+		os.Remove(partPath)
+		os.Remove(etagPath)
+		return fmt.Errorf("续传范围无效，将重新下载")
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &downloadError{status: resp.Status, body: string(body)}
+	}
+
+	if dir := filepath.Dir(dest); dir != "." {
+		os.MkdirAll(dir, constants.DirPermission)
+	}
+	if value := resp.Header.Get("ETag"); value != "" {
+		os.WriteFile(etagPath, []byte(value), constants.FilePermission)
+	} else {
+		os.Remove(etagPath)
+	}
+
+	file, err := os.OpenFile(partPath, flags, constants.FilePermission)
+	if err != nil {
+		return fmt.Errorf("创建文件失败: %v", err)
+	}
+	defer file.Close()
+
+	writer := progress.NewProgressWriter(file, resp.ContentLength, "下载进度")
+	written, err := io.Copy(writer, resp.Body)
+	writer.PrintProgress()
+	fmt.Println() // 进度条后换行
+	if err != nil {
+		return fmt.Errorf("下载中断（已保存 %s，可续传）: %v", system.FormatSize(offset+written), err)
+	}
+	if resp.ContentLength >= 0 && written != resp.ContentLength {
+		return fmt.Errorf("下载不完整: %d / %d bytes", written, resp.ContentLength)
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(partPath, dest); err != nil {
+		return err
+	}
+	os.Remove(etagPath)
+
+	// 保留服务器上的修改时间
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		os.Chtimes(dest, modTime, modTime)
+	}
+	fmt.Printf("📊 大小: %s\n", system.FormatSize(offset+written))
+	return nil
+}
@@ -0,0 +1,305 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/system"
+)
+
+// globPattern 一条 doublestar 风格的模式：* 和 ? 不跨越 /，** 匹配任意多级目录
+type globPattern struct {
+	segments []string // 以 / 分隔的各段
+	dirOnly  bool     // 以 / 结尾，只匹配目录
+	negate   bool     // .gtignore 中以 ! 开头，重新包含此前排除的路径
+}
+
+// parsePattern 解析模式。不含 /（结尾的 / 除外）的模式匹配任意深度的名称，
+// 否则相对于基准目录（上传的目录或 .gtignore 所在目录）匹配
+func parsePattern(pattern string) (globPattern, error) {
+	var p globPattern
+	if strings.HasSuffix(pattern, "/") {
+		p.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return p, fmt.Errorf("模式为空")
+	}
+	if strings.Contains(pattern, "/") {
+		p.segments = strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	} else {
+		p.segments = []string{"**", pattern}
+	}
+	for _, segment := range p.segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return p, fmt.Errorf("无效的模式 %q", pattern)
+		}
+	}
+	return p, nil
+}
+
+// match 判断以 / 分隔的相对路径是否匹配
+func (p globPattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	return matchSegments(p.segments, strings.Split(rel, "/"))
+}
+
+// matchSegments 逐段匹配，** 依次尝试吞掉零到多段；结尾的 ** 至少吞掉一段，
+// 因此 a/** 只匹配 a 中的条目而不匹配 a 本身
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return len(parts) > 0
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// loadIgnoreFile 读取目录中的 .gtignore（语法同 .gitignore），文件不存在时返回 nil。
+// 无效的行输出警告后忽略
+func loadIgnoreFile(dir string) []globPattern {
+	file, err := os.Open(filepath.Join(dir, constants.IgnoreFileName))
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var rules []globPattern
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		negate := strings.HasPrefix(line, "!")
+		if negate {
+			line = line[1:]
+		}
+		// \# 和 \! 表示以该字符开头的名称
+		line = strings.TrimPrefix(line, `\`)
+		rule, err := parsePattern(line)
+		if err != nil {
+			fmt.Printf("⚠️  %s 第 %d 行: %v\n", filepath.Join(dir, constants.IgnoreFileName), lineNo, err)
+			continue
+		}
+		rule.negate = negate
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// fileFilter 目录上传的筛选条件
+type fileFilter struct {
+	include   []globPattern
+	exclude   []globPattern
+	minSize   int64     // 小于该大小的文件不上传
+	newerThan time.Time // 修改时间早于该时间的文件不上传，零值表示不限制
+	patterns  []string  // 原始的 include/exclude 模式，用于输出说明
+}
+
+// SetFilter 设置目录上传的筛选条件：include 非空时只上传匹配的文件（匹配目录时包含其中所有文件），
+// exclude 匹配的文件和目录不上传；目录中的 .gtignore 始终生效
+func (tc *TransferClient) SetFilter(include, exclude []string, minSize int64, newerThan time.Time) error {
+	filter := fileFilter{minSize: minSize, newerThan: newerThan}
+	for _, list := range []struct {
+		patterns []string
+		target   *[]globPattern
+		label    string
+	}{{include, &filter.include, "包含"}, {exclude, &filter.exclude, "排除"}} {
+		for _, pattern := range list.patterns {
+			p, err := parsePattern(strings.ReplaceAll(pattern, `\`, "/"))
+			if err != nil {
+				return fmt.Errorf("%s条件无效: %v", list.label, err)
+			}
+			*list.target = append(*list.target, p)
+		}
+		if len(list.patterns) > 0 {
+			filter.patterns = append(filter.patterns, list.label+" "+strings.Join(list.patterns, ", "))
+		}
+	}
+	tc.filter = filter
+	return nil
+}
+
+// FilterSummary 返回筛选条件的说明，未设置时为空
+func (tc *TransferClient) FilterSummary() string {
+	parts := append([]string(nil), tc.filter.patterns...)
+	if tc.filter.minSize > 0 {
+		parts = append(parts, "不小于 "+system.FormatSize(tc.filter.minSize))
+	}
+	if !tc.filter.newerThan.IsZero() {
+		parts = append(parts, "修改于 "+tc.filter.newerThan.Format("2006-01-02 15:04")+" 之后")
+	}
+	return strings.Join(parts, "；")
+}
+
+// selective 是否设置了针对文件的筛选条件（此时只发送包含选中条目的目录）
+func (f *fileFilter) selective() bool {
+	return len(f.include) > 0 || f.minSize > 0 || !f.newerThan.IsZero()
+}
+
+// included 文件本身或其上级目录匹配任一 include 模式
+func (f *fileFilter) included(rel string) bool {
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, p := range f.include {
+		if p.match(rel, false) {
+			return true
+		}
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			if p.match(dir, true) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// treeEntry 目录中选中的条目
+type treeEntry struct {
+	path string      // 本地路径
+	rel  string      // 相对于上传目录、以 / 分隔的路径，根目录为 "."
+	info os.FileInfo // Lstat 信息（符号链接不跟随）
+}
+
+// treeScan 按筛选条件遍历目录的结果
+type treeScan struct {
+	entries  []treeEntry // 按遍历顺序，目录在其中的条目之前
+	files    int         // 选中的普通文件数
+	size     int64       // 选中的普通文件总大小
+	excluded int         // 被筛选掉的条目数（排除的目录不展开计数）
+	special  []string    // 跳过的设备文件、套接字等特殊文件
+}
+
+// scanTree 按筛选条件和各级 .gtignore 遍历目录
+func (tc *TransferClient) scanTree(root string) (*treeScan, error) {
+	scan := &treeScan{}
+	ignores := map[string][]globPattern{} // 目录相对路径 -> 其 .gtignore 规则
+
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if rel != "." && tc.skipped(rel, info, ignores) {
+			scan.excluded++
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case info.IsDir():
+			if rules := loadIgnoreFile(p); rules != nil {
+				ignores[rel] = rules
+			}
+		case info.Mode().IsRegular():
+			scan.files++
+			scan.size += info.Size()
+		case info.Mode()&os.ModeSymlink == 0:
+			scan.special = append(scan.special, rel)
+			return nil
+		}
+		scan.entries = append(scan.entries, treeEntry{path: p, rel: rel, info: info})
+		return nil
+	})
+	if err != nil {
+		return scan, err
+	}
+
+	// 按文件筛选时不发送没有选中条目的目录（上传的目录本身除外）
+	if tc.filter.selective() {
+		needed := map[string]bool{".": true}
+		for _, entry := range scan.entries {
+			if !entry.info.IsDir() {
+				for dir := path.Dir(entry.rel); !needed[dir]; dir = path.Dir(dir) {
+					needed[dir] = true
+				}
+			}
+		}
+		kept := scan.entries[:0]
+		for _, entry := range scan.entries {
+			if !entry.info.IsDir() || needed[entry.rel] {
+				kept = append(kept, entry)
+			}
+		}
+		scan.entries = kept
+	}
+	return scan, nil
+}
+
+// skipped 判断条目是否被 exclude、.gtignore 或文件筛选条件排除
+func (tc *TransferClient) skipped(rel string, info os.FileInfo, ignores map[string][]globPattern) bool {
+	isDir := info.IsDir()
+	for _, p := range tc.filter.exclude {
+		if p.match(rel, isDir) {
+			return true
+		}
+	}
+
+	// 由浅到深检查各级 .gtignore，最后匹配的规则生效
+	ignored := false
+	dirs := []string{}
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	dirs = append(dirs, ".")
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dir := dirs[i]
+		sub := rel
+		if dir != "." {
+			sub = strings.TrimPrefix(rel, dir+"/")
+		}
+		for _, rule := range ignores[dir] {
+			if rule.match(sub, isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	if ignored || isDir {
+		return ignored
+	}
+
+	if !tc.filter.included(rel) {
+		return true
+	}
+	if info.Mode().IsRegular() {
+		if info.Size() < tc.filter.minSize {
+			return true
+		}
+		if !tc.filter.newerThan.IsZero() && info.ModTime().Before(tc.filter.newerThan) {
+			return true
+		}
+	}
+	return false
+}
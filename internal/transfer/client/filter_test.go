@@ -0,0 +1,150 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"go-transfer/internal/constants"
+)
+
+func TestGlobPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		isDir   bool
+		want    bool
+	}{
+		{"*.log", "a.log", false, true},
+		{"*.log", "dir/sub/a.log", false, true},
+		{"*.log", "a.log.txt", false, false},
+		{"/build", "build", true, true},
+		{"/build", "src/build", true, false},
+		{"src/*.go", "src/a.go", false, true},
+		{"src/*.go", "src/sub/a.go", false, false},
+		{"src/**/*.go", "src/a.go", false, true},
+		{"src/**/*.go", "src/x/y/a.go", false, true},
+		{"node_modules/", "web/node_modules", true, true},
+		{"node_modules/", "web/node_modules", false, false},
+		{"a/**", "a", true, false},
+		{"a/**", "a/b", false, true},
+		{"a/**", "a/b/c", false, true},
+		{"**/a", "a", false, true},
+		{"**/a", "x/y/a", false, true},
+		{"?.txt", "ab.txt", false, false},
+	}
+	for _, tt := range tests {
+		p, err := parsePattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("parsePattern(%q): %v", tt.pattern, err)
+		}
+		if got := p.match(tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("%q 匹配 %q (目录 %v) = %v, 期望 %v", tt.pattern, tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+
+	for _, pattern := range []string{"", "/", "[a"} {
+		if _, err := parsePattern(pattern); err == nil {
+			t.Errorf("parsePattern(%q) 期望返回错误", pattern)
+		}
+	}
+}
+
+func TestScanTreeFilters(t *testing.T) {
+	root := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	files := map[string]int{
+		"a.txt":            10,
+		"big.bin":          4096,
+		"keep.log":         10,
+		"debug.log":        10,
+		"old.txt":          10,
+		"build/out.o":      10,
+		"src/main.go":      10,
+		"src/gen/x.go":     10,
+		"src/gen/keep.go":  10,
+		"docs/build/a.md":  10,
+		"vendor/lib/a.go":  10,
+		"vendor/lib/b.txt": 10,
+	}
+	for name, size := range files {
+		full := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(full), 0755)
+		os.WriteFile(full, make([]byte, size), 0644)
+	}
+	os.Chtimes(filepath.Join(root, "old.txt"), old, old)
+	// 根目录排除所有日志但重新包含 keep.log；子目录的 .gtignore 在更深处，优先于上级的规则
+	os.WriteFile(filepath.Join(root, constants.IgnoreFileName), []byte("# 注释\n*.log\n!keep.log\n/build/\ngen/\n"), 0644)
+	os.WriteFile(filepath.Join(root, "src", constants.IgnoreFileName), []byte("!gen/\ngen/x.go\n"), 0644)
+
+	tests := []struct {
+		name      string
+		include   []string
+		exclude   []string
+		minSize   int64
+		newerThan time.Time
+		want      []string
+	}{
+		{
+			name: "仅 .gtignore",
+			want: []string{".gtignore", "a.txt", "big.bin", "docs/build/a.md", "keep.log", "old.txt",
+				"src/.gtignore", "src/gen/keep.go", "src/main.go", "vendor/lib/a.go", "vendor/lib/b.txt"},
+		},
+		{
+			name:    "排除目录中的内容",
+			exclude: []string{"vendor/**", "*.txt"},
+			want:    []string{".gtignore", "big.bin", "docs/build/a.md", "keep.log", "src/.gtignore", "src/gen/keep.go", "src/main.go"},
+		},
+		{
+			name:    "包含匹配的目录",
+			include: []string{"src/"},
+			want:    []string{"src/.gtignore", "src/gen/keep.go", "src/main.go"},
+		},
+		{
+			name:    "包含锚定的模式",
+			include: []string{"/*.go", "vendor/**/*.go"},
+			want:    []string{"vendor/lib/a.go"},
+		},
+		{
+			name:    "最小大小",
+			minSize: 100,
+			want:    []string{"big.bin"},
+		},
+		{
+			name:      "修改时间",
+			include:   []string{"*.txt"},
+			newerThan: time.Now().Add(-time.Hour),
+			want:      []string{"a.txt", "vendor/lib/b.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := NewTransferClient()
+			if err := tc.SetFilter(tt.include, tt.exclude, tt.minSize, tt.newerThan); err != nil {
+				t.Fatal(err)
+			}
+			scan, err := tc.scanTree(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, entry := range scan.entries {
+				if !entry.info.IsDir() {
+					got = append(got, entry.rel)
+				}
+			}
+			if !reflect.DeepEqual(sorted(got), tt.want) {
+				t.Errorf("选中的文件 = %v, 期望 %v", sorted(got), tt.want)
+			}
+		})
+	}
+}
+
+func sorted(list []string) []string {
+	result := append([]string(nil), list...)
+	sort.Strings(result)
+	return result
+}
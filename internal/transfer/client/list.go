@@ -0,0 +1,101 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/system"
+)
+
+// FileEntry 服务器文件列表中的一项
+type FileEntry struct {
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mtime"`
+	Digest     string    `json:"digest,omitempty"`
+	InProgress bool      `json:"in_progress,omitempty"`
+}
+
+// fileListing GET /files 的响应
+type fileListing struct {
+	Entries    []FileEntry `json:"entries"`
+	NextCursor string      `json:"next_cursor"`
+}
+
+// List 获取服务器存储目录中以 prefix 开头的条目（自动翻页）
+func (tc *TransferClient) List(prefix string, recursive bool) ([]FileEntry, error) {
+	var entries []FileEntry
+	cursor := ""
+	for {
+		query := url.Values{}
+		query.Set("prefix", prefix)
+		query.Set("recursive", strconv.FormatBool(recursive))
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+
+		req, err := tc.newRequest(http.MethodGet, tc.serverURL+constants.ListRoute+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := tc.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var page fileListing
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			resp.Body.Close()
+			return nil, fmt.Errorf("服务器返回错误: %s %s", resp.Status, string(body))
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("解析列表失败: %v", err)
+		}
+
+		entries = append(entries, page.Entries...)
+		if page.NextCursor == "" {
+			return entries, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// ListFiles 列出服务器存储目录中的文件并打印
+func (tc *TransferClient) ListFiles(prefix string, recursive bool) error {
+	entries, err := tc.List(prefix, recursive)
+	if err != nil {
+		return err
+	}
+
+	var totalSize int64
+	files := 0
+	for _, entry := range entries {
+		size := "-"
+		if entry.Type == "file" {
+			size = system.FormatSize(entry.Size)
+			totalSize += entry.Size
+			files++
+		}
+		flag := ""
+		if entry.InProgress {
+			flag = "  [上传中]"
+		}
+		fmt.Printf("%-12s %s  %s%s\n", size, entry.ModTime.Local().Format("2006-01-02 15:04:05"), entry.Name, flag)
+		if entry.Digest != "" {
+			fmt.Printf("%-12s %s\n", "", entry.Digest)
+		}
+	}
+
+	fmt.Printf("\n共 %d 项，%d 个文件，总大小: %s\n", len(entries), files, system.FormatSize(totalSize))
+	return nil
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"time"
+
+	"go-transfer/internal/constants"
+)
+
+// dirEntry 目录上传中的目录或符号链接条目，在文件上传完成后发送
+type dirEntry struct {
+	kind    string // constants.EntryDir 或 constants.EntrySymlink
+	relPath string
+	target  string // 符号链接的目标
+	info    os.FileInfo
+}
+
+// setFileMeta 随请求头发送权限和修改时间，接收端据此还原。
+// Windows 上的权限位不反映实际的访问控制，不发送
+func setFileMeta(h http.Header, info os.FileInfo) {
+	if runtime.GOOS != "windows" {
+		h.Set(constants.HeaderFileMode, fmt.Sprintf("%04o", info.Mode().Perm()))
+	}
+	h.Set(constants.HeaderFileMtime, info.ModTime().UTC().Format(time.RFC3339Nano))
+}
+
+// uploadEntries 依次发送符号链接和目录条目，输出未创建或失败的条目，返回失败数。
+// 目录按子目录在前的顺序传入，其修改时间不会被之后创建的条目改变
+func (tc *TransferClient) uploadEntries(entries []dirEntry) int {
+	failed, ignored, dirs := 0, 0, 0
+	for _, entry := range entries {
+		result, err := tc.uploadEntry(entry)
+		switch {
+		case err != nil:
+			failed++
+			fmt.Printf("❌ %s: %v\n", entry.relPath, err)
+		case result.conflict == constants.ResultIgnored:
+			ignored++
+			fmt.Printf("⚠️  %s\n", result.message)
+		case result.conflict == constants.ResultSkipped:
+			fmt.Printf("⏭️  %s → %s: 已存在，已跳过\n", entry.relPath, entry.target)
+		case entry.kind == constants.EntrySymlink:
+			fmt.Printf("🔗 %s → %s\n", entry.relPath, entry.target)
+		case result.conflict == constants.ResultCreated:
+			dirs++
+		}
+	}
+	if dirs > 0 {
+		fmt.Printf("📁 已在服务器上创建 %d 个目录\n", dirs)
+	}
+	if ignored > 0 {
+		fmt.Printf("⚠️  %d 个条目未在服务器上创建\n", ignored)
+	}
+	return failed
+}
+
+// uploadEntry 发送目录或符号链接条目，网络错误时重试
+func (tc *TransferClient) uploadEntry(entry dirEntry) (uploadResult, error) {
+	var lastErr error
+	for attempt := 1; attempt <= constants.MaxRetries; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * 2 * time.Second)
+		}
+
+		result, err := tc.doUploadEntry(entry)
+		if err == nil {
+			return result, nil
+		}
+		lastErr = err
+		if _, permanent := err.(*rejectedError); permanent {
+			return uploadResult{}, err
+		}
+	}
+	return uploadResult{}, fmt.Errorf("重试 %d 次后仍然失败: %v", constants.MaxRetries, lastErr)
+}
+
+// doUploadEntry 以空请求体发送条目，目录携带权限和修改时间，符号链接携带目标
+func (tc *TransferClient) doUploadEntry(entry dirEntry) (uploadResult, error) {
+	uploadURL := fmt.Sprintf("%s/upload?name=%s", tc.serverURL, url.QueryEscape(entry.relPath))
+	req, err := tc.newUploadRequest(uploadURL, http.NoBody)
+	if err != nil {
+		return uploadResult{}, err
+	}
+	req.Header.Set(constants.HeaderEntryType, entry.kind)
+	if entry.kind == constants.EntrySymlink {
+		req.Header.Set(constants.HeaderLinkTarget, url.PathEscape(entry.target))
+	} else {
+		setFileMeta(req.Header, entry.info)
+	}
+
+	resp, err := tc.httpClient.Do(req)
+	if err != nil {
+		return uploadResult{}, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return uploadResult{}, fmt.Errorf("读取响应失败: %v", err)
+	}
+
+	if err := checkRejected(resp, respBody); err != nil {
+		return uploadResult{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return uploadResult{}, statusError(resp, respBody)
+	}
+	return readUploadResult(resp, respBody, constants.HeaderContentDigest), nil
+}
@@ -0,0 +1,321 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/system"
+)
+
+// remoteEntry 接收端目录清单中的一项
+type remoteEntry struct {
+	Name    string    `json:"name"`
+	Type    string    `json:"type"` // file、dir 或 symlink
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Digest  string    `json:"digest,omitempty"`
+	Target  string    `json:"target,omitempty"`
+}
+
+// SyncPlan 增量同步计划：与接收端的目录清单比较后需要上传、创建和删除的条目
+type SyncPlan struct {
+	upload    []dirFile       // 新增或内容变化的文件（按遍历顺序）
+	changed   map[string]bool // upload 中接收端已有旧版本的文件
+	size      int64           // 需要上传的字节数
+	links     []dirEntry      // 新增或目标变化的符号链接
+	dirs      []dirEntry      // 需要创建或重新设置修改时间的目录（按遍历顺序）
+	newDirs   int             // dirs 中接收端不存在的目录数
+	remove    []string        // 接收端多余的条目（子项在前）
+	unchanged int             // 未变化的文件数
+}
+
+// Empty 接收端已与本地一致
+func (p *SyncPlan) Empty() bool {
+	return len(p.upload) == 0 && len(p.links) == 0 && len(p.dirs) == 0 && len(p.remove) == 0
+}
+
+// Removals 计划删除的条目数
+func (p *SyncPlan) Removals() int {
+	return len(p.remove)
+}
+
+// Print 输出计划摘要，verbose 为 true 时逐项列出（dry-run）
+func (p *SyncPlan) Print(verbose bool) {
+	fmt.Printf("📋 新增 %d 个文件，更新 %d 个文件（共 %s），%d 个文件未变化\n",
+		len(p.upload)-len(p.changed), len(p.changed), system.FormatSize(p.size), p.unchanged)
+	if len(p.links) > 0 || p.newDirs > 0 {
+		fmt.Printf("   创建 %d 个符号链接，%d 个目录\n", len(p.links), p.newDirs)
+	}
+	if len(p.remove) > 0 {
+		fmt.Printf("   删除接收端多余的 %d 项\n", len(p.remove))
+	}
+	if !verbose {
+		return
+	}
+
+	fmt.Println()
+	for _, f := range p.upload {
+		mark := "+"
+		if p.changed[f.relPath] {
+			mark = "~"
+		}
+		fmt.Printf("%s %s (%s)\n", mark, f.relPath, system.FormatSize(f.size))
+	}
+	for _, link := range p.links {
+		fmt.Printf("+ %s → %s\n", link.relPath, link.target)
+	}
+	for _, name := range p.remove {
+		fmt.Printf("- %s\n", name)
+	}
+}
+
+// PlanSync 遍历本地目录（按筛选条件）并获取接收端清单，生成同步计划。
+// 大小和修改时间都相同的文件视为未变化；checksum 为 true 时大小相同的文件改为比较摘要。
+// deleteExtra 为 true 时删除接收端存在、本地已不存在的条目（被筛选条件排除的本地条目不删除）
+func (tc *TransferClient) PlanSync(deleteExtra, checksum bool) (*SyncPlan, error) {
+	baseDir := filepath.Base(tc.filePath)
+	scan, err := tc.scanUpload()
+	if err != nil {
+		return nil, err
+	}
+	files, links, dirs, err := splitTree(scan, baseDir)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := tc.fetchManifest(baseDir, checksum)
+	if err != nil {
+		return nil, fmt.Errorf("获取接收端清单失败: %v", err)
+	}
+
+	plan := &SyncPlan{changed: make(map[string]bool)}
+	touched := make(map[string]bool) // 其中有条目变化的目录，需要重新设置修改时间
+	for _, f := range files {
+		r, ok := remote[f.relPath]
+		if ok && r.Type == "file" && r.Size == f.size {
+			same, err := sameContent(f, r, checksum)
+			if err != nil {
+				return nil, err
+			}
+			if same {
+				plan.unchanged++
+				continue
+			}
+		}
+		if ok && r.Type == "file" {
+			plan.changed[f.relPath] = true
+		}
+		plan.upload = append(plan.upload, f)
+		plan.size += f.size
+		touched[path.Dir(f.relPath)] = true
+	}
+	for _, link := range links {
+		if r, ok := remote[link.relPath]; ok && r.Type == "symlink" && r.Target == link.target {
+			continue
+		}
+		plan.links = append(plan.links, link)
+		touched[path.Dir(link.relPath)] = true
+	}
+
+	if deleteExtra {
+		local := make(map[string]string, len(scan.entries))
+		for _, f := range files {
+			local[f.relPath] = "file"
+		}
+		for _, link := range links {
+			local[link.relPath] = "symlink"
+		}
+		for _, dir := range dirs {
+			local[dir.relPath] = "dir"
+		}
+		for name, r := range remote {
+			if local[name] == r.Type || tc.existsLocally(strings.TrimPrefix(name, baseDir+"/"), r.Type) {
+				continue
+			}
+			plan.remove = append(plan.remove, name)
+			touched[path.Dir(name)] = true
+		}
+		// 逆序排列使子项先于所在目录删除
+		sort.Sort(sort.Reverse(sort.StringSlice(plan.remove)))
+	}
+
+	// 子目录先于上级目录检查，新建的目录使上级目录的修改时间变化
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dir := dirs[i]
+		r, ok := remote[dir.relPath]
+		if dir.relPath == baseDir {
+			// 清单不含目录本身，接收端有任何条目即视为已存在
+			r, ok = remoteEntry{Type: "dir", ModTime: dir.info.ModTime()}, len(remote) > 0
+		}
+		missing := !ok || r.Type != "dir"
+		if !missing && !touched[dir.relPath] && sameModTime(dir.info.ModTime(), r.ModTime) {
+			continue
+		}
+		if missing {
+			plan.newDirs++
+			touched[path.Dir(dir.relPath)] = true
+		}
+		plan.dirs = append([]dirEntry{dir}, plan.dirs...)
+	}
+	return plan, nil
+}
+
+// sameContent 判断大小相同的本地文件与接收端文件内容是否一致：
+// 修改时间相同即视为一致（checksum 时除外），否则在接收端摘要已知时比较摘要
+func sameContent(f dirFile, r remoteEntry, checksum bool) (bool, error) {
+	if !checksum && sameModTime(f.modTime, r.ModTime) {
+		return true, nil
+	}
+	if r.Digest == "" {
+		return false, nil
+	}
+	local, err := hashLocalFile(f.path)
+	if err != nil {
+		return false, fmt.Errorf("计算 %s 的摘要失败: %v", f.relPath, err)
+	}
+	return local == r.Digest, nil
+}
+
+// sameModTime 按 SyncMtimeSlop 的精度比较修改时间
+func sameModTime(a, b time.Time) bool {
+	return a.Truncate(constants.SyncMtimeSlop).Equal(b.Truncate(constants.SyncMtimeSlop))
+}
+
+// existsLocally 判断本地目录中是否存在同类型的条目（被筛选条件排除但仍存在的条目不删除）
+func (tc *TransferClient) existsLocally(rel, kind string) bool {
+	info, err := os.Lstat(filepath.Join(tc.filePath, filepath.FromSlash(rel)))
+	if err != nil {
+		return false
+	}
+	switch {
+	case info.IsDir():
+		return kind == "dir"
+	case info.Mode()&os.ModeSymlink != 0:
+		return kind == "symlink"
+	default:
+		return kind == "file"
+	}
+}
+
+// fetchManifest 获取接收端目录的清单，键为去掉目录结尾 / 的相对路径
+func (tc *TransferClient) fetchManifest(dir string, checksum bool) (map[string]remoteEntry, error) {
+	query := url.Values{}
+	query.Set("prefix", dir)
+	query.Set("checksum", strconv.FormatBool(checksum))
+	req, err := tc.newRequest(http.MethodGet, tc.serverURL+constants.ManifestRoute+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := tc.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("服务器返回错误: %s %s", resp.Status, string(body))
+	}
+
+	var manifest struct {
+		Entries []remoteEntry `json:"entries"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("解析清单失败: %v", err)
+	}
+	entries := make(map[string]remoteEntry, len(manifest.Entries))
+	for _, entry := range manifest.Entries {
+		entries[strings.TrimSuffix(entry.Name, "/")] = entry
+	}
+	return entries, nil
+}
+
+// ApplySync 执行同步计划：先删除多余的条目（类型改变的条目随之让位），再上传文件，
+// 最后发送符号链接和目录条目。未指定冲突策略时按覆盖处理，变化的文件替换接收端的旧版本
+func (tc *TransferClient) ApplySync(plan *SyncPlan) error {
+	if tc.onConflict == "" {
+		tc.onConflict = constants.ConflictOverwrite
+	}
+
+	removeFailed := 0
+	if len(plan.remove) > 0 {
+		removeFailed = tc.removeRemote(plan.remove)
+		fmt.Println()
+	}
+	failed := 0
+	if len(plan.upload) > 0 {
+		failed = tc.uploadFiles(plan.upload, plan.size)
+		fmt.Println()
+	}
+	entries := plan.links
+	for i := len(plan.dirs) - 1; i >= 0; i-- {
+		entries = append(entries, plan.dirs[i])
+	}
+	entryFailed := tc.uploadEntries(entries)
+
+	switch {
+	case removeFailed > 0:
+		return fmt.Errorf("%d/%d 个条目删除失败", removeFailed, len(plan.remove))
+	case failed > 0:
+		return fmt.Errorf("%d/%d 个文件上传失败", failed, len(plan.upload))
+	case entryFailed > 0:
+		return fmt.Errorf("%d 个目录或符号链接创建失败", entryFailed)
+	}
+	return nil
+}
+
+// removeRemote 依次删除接收端的条目，已不存在的忽略，非空目录（如含有上传中的文件）保留并提示，返回失败数
+func (tc *TransferClient) removeRemote(names []string) int {
+	failed, removed := 0, 0
+	for _, name := range names {
+		err := tc.deleteRemote(name)
+		switch {
+		case err == nil:
+			removed++
+			fmt.Printf("🗑️  %s\n", name)
+		case err == errRemoteNotEmpty:
+			fmt.Printf("⚠️  %s: 目录非空，未删除\n", name)
+		default:
+			failed++
+			fmt.Printf("❌ %s: %v\n", name, err)
+		}
+	}
+	fmt.Printf("🗑️  已删除接收端 %d 项\n", removed)
+	return failed
+}
+
+// errRemoteNotEmpty 要删除的目录在接收端非空
+var errRemoteNotEmpty = errors.New("目录非空")
+
+// deleteRemote 删除接收端存储中的文件、符号链接或空目录
+func (tc *TransferClient) deleteRemote(name string) error {
+	req, err := tc.newRequest(http.MethodDelete, tc.filesURL(name), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := tc.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, constants.MaxUploadResponse))
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNotFound:
+		return nil
+	case http.StatusConflict:
+		return errRemoteNotEmpty
+	}
+	return statusError(resp, body)
+}
@@ -0,0 +1,443 @@
+package server
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/digest"
+	"go-transfer/internal/infrastructure/logger"
+	"go-transfer/internal/infrastructure/progress"
+	"go-transfer/internal/infrastructure/system"
+)
+
+// archiveStats 归档上传的解压统计
+type archiveStats struct {
+	Files   int      `json:"files"`             // 已保存的文件数
+	Dirs    int      `json:"dirs"`              // 目录数（含空目录）
+	Links   int      `json:"links"`             // 符号链接和硬链接数
+	Skipped int      `json:"skipped"`           // 同名文件已存在而跳过的条目数
+	Ignored []string `json:"ignored,omitempty"` // 未解压的条目及原因（不支持的类型、指向目标目录外的链接）
+}
+
+// entryError 解压某个条目失败，中止整个归档
+type entryError struct {
+	name string
+	err  error
+}
+
+func (e *entryError) Error() string {
+	return fmt.Sprintf("%s: %v", e.name, e.err)
+}
+
+func (e *entryError) Unwrap() error {
+	return e.err
+}
+
+// dirMeta 解压结束后再设置的目录权限和修改时间（写入子项会改变目录的修改时间）
+type dirMeta struct {
+	path    string
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// isArchiveUpload 判断请求体是否为目录的 tar 归档
+func isArchiveUpload(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == constants.ContentTypeTar
+}
+
+// handleArchiveUpload 处理目录归档上传（Content-Type: application/x-tar，可选 Content-Encoding: gzip）：
+// 接收模式边接收边解压到 name 指定的目录，转发模式原样转发归档流
+func handleArchiveUpload(ft *FileTransfer, w http.ResponseWriter, r *http.Request) {
+	dirName := r.URL.Query().Get("name")
+	if dirName == "" {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "归档上传需要 name 参数指定目标目录")
+		return
+	}
+
+	switch ft.Mode {
+	case "receiver":
+		ft.receiveArchive(w, r, dirName)
+	case "forward":
+		handleForward(ft, w, r, r.Body, dirName, declaredLength(r), false)
+	default:
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "未知服务模式")
+	}
+}
+
+// archiveExtractor 将归档中的条目解压到目标目录，路径安全检查与单个文件上传相同。
+// 链接只能指向目标目录之内，经过链接的写入也不会离开目标目录（令牌的路径前缀同样有效）
+type archiveExtractor struct {
+	ft      *FileTransfer
+	root    string // 存储目录
+	base    string // 目标目录的绝对路径
+	dirName string // 目标目录的相对路径
+	policy  string // 同名文件冲突策略
+	bytes   int64  // 已保存的文件数据字节数
+	stats   archiveStats
+	dirs    []dirMeta
+}
+
+// receiveArchive 接收并解压目录归档，请求体的摘要（请求头或trailer）覆盖传输的原始字节
+func (ft *FileTransfer) receiveArchive(w http.ResponseWriter, r *http.Request, dirName string) {
+	baseDir, err := resolveStoragePath(ft, dirName)
+	if err != nil {
+		logger.LogWarn("拒绝上传: %v", err)
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeInvalidPath, "%v", err)
+		return
+	}
+	if !allowPath(w, r, dirName) {
+		return
+	}
+	policy, err := ft.conflictPolicy(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "%v", err)
+		return
+	}
+	encoding := r.Header.Get("Content-Encoding")
+	if encoding != "" && encoding != constants.ArchiveGzip {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "不支持的 Content-Encoding: %s", encoding)
+		return
+	}
+
+	expected := r.Header.Get(constants.HeaderContentDigest)
+	algorithm := digest.DefaultAlgorithm
+	if expected != "" {
+		if algorithm, _, err = digest.Parse(expected); err != nil {
+			writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "%v", err)
+			return
+		}
+	}
+	hasher, _ := digest.New(algorithm)
+
+	size := declaredLength(r)
+	body := progress.NewProgressReader(r.Body, size, "接收进度")
+	body.SetHasher(hasher)
+	transferFrom(r).attach(dirName, body)
+
+	if encoding != "" {
+		logger.LogInfo("📦 开始接收目录: %s [tar+%s]", dirName, encoding)
+	} else {
+		logger.LogInfo("📦 开始接收目录: %s [tar]", dirName)
+	}
+
+	cleanName, _ := sanitizeFileName(dirName)
+	x := &archiveExtractor{
+		ft:      ft,
+		root:    system.ExpandPath(ft.StoragePath),
+		base:    baseDir,
+		dirName: cleanName,
+		policy:  policy,
+	}
+	err = x.extract(body, encoding)
+	x.finishDirs()
+	received, _, _ := body.GetProgress()
+	ft.stats().received.Add(float64(received))
+	if err != nil {
+		x.respondError(w, r, err)
+		return
+	}
+
+	// 读完归档之后的填充数据，使trailer可用
+	io.Copy(io.Discard, body)
+	body.PrintProgress()
+	fmt.Println()
+
+	if expected == "" {
+		expected = r.Trailer.Get(constants.HeaderContentDigest)
+	}
+	actual := digest.Format(algorithm, hasher)
+	w.Header().Set(constants.HeaderContentDigest, actual)
+	if expected != "" {
+		if err := verifyDigest(expected, actual); err != nil {
+			logger.LogError("归档校验失败: %s (%v)", dirName, err)
+			writeError(w, r, http.StatusUnprocessableEntity, constants.ErrCodeDigestMismatch, "完整性校验失败，已解压的文件可能不完整: %v", err)
+			return
+		}
+	}
+
+	message := fmt.Sprintf("目录上传成功: %s (%d 个文件, %d 个目录, %d 个链接, %d bytes)",
+		x.dirName, x.stats.Files, x.stats.Dirs, x.stats.Links, x.bytes)
+	if x.stats.Skipped > 0 {
+		message += fmt.Sprintf("，%d 个同名条目已跳过", x.stats.Skipped)
+	}
+	if len(x.stats.Ignored) > 0 {
+		message += fmt.Sprintf("，%d 个条目未解压", len(x.stats.Ignored))
+	}
+	logger.LogSuccess("%s", message)
+
+	resp := &uploadResponse{
+		Status:  constants.UploadStatusOK,
+		Name:    dirName,
+		Stored:  x.dirName,
+		Bytes:   x.bytes,
+		Digest:  actual,
+		Archive: &x.stats,
+		Message: message,
+	}
+	resp.setTiming(requestStart(r), received)
+	ft.stats().observeUpload(requestStart(r), received)
+	ft.writeUpload(w, r, http.StatusOK, resp)
+}
+
+// respondError 按失败原因返回错误响应
+func (x *archiveExtractor) respondError(w http.ResponseWriter, r *http.Request, err error) {
+	name := x.dirName
+	var ee *entryError
+	if errors.As(err, &ee) {
+		name = ee.name
+	}
+	if respondCancelled(w, r, x.dirName) {
+		return
+	}
+	if x.ft.discardAborted() {
+		logger.LogWarn("服务停止，目录上传已中止: %s", x.dirName)
+		writeError(w, r, http.StatusServiceUnavailable, constants.ErrCodeShuttingDown, "服务正在停止，上传已中止")
+		return
+	}
+	switch {
+	case respondLimit(w, r, name, err):
+	case errors.Is(err, errFileExists):
+		respondExists(w, r, name)
+	case errors.Is(err, errUnsafePath):
+		logger.LogWarn("拒绝上传: %v", err)
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeInvalidPath, "%v", err)
+	default:
+		logger.LogError("解压归档失败: %s (%v)", x.dirName, err)
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "解压归档失败: %v", err)
+	}
+	logger.LogWarn("目录上传中止，已解压 %d 个文件: %s", x.stats.Files, x.dirName)
+}
+
+// extract 逐个解压归档中的条目
+func (x *archiveExtractor) extract(body io.Reader, encoding string) error {
+	if encoding == constants.ArchiveGzip {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	if err := os.MkdirAll(x.root, constants.DirPermission); err != nil {
+		return err
+	}
+	if err := ensureDir(x.root, x.base); err != nil {
+		return &entryError{name: x.dirName, err: err}
+	}
+	tr := tar.NewReader(body)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := x.extractEntry(tr, hdr); err != nil {
+			return err
+		}
+	}
+}
+
+// extractEntry 解压单个条目，条目名按单个文件上传的规则校验
+func (x *archiveExtractor) extractEntry(tr *tar.Reader, hdr *tar.Header) error {
+	if hdr.Typeflag == tar.TypeXGlobalHeader {
+		return nil
+	}
+	trimmed := strings.Trim(strings.ReplaceAll(hdr.Name, `\`, "/"), "/")
+	if trimmed == "" || trimmed == "." {
+		// 归档根目录即目标目录
+		if hdr.Typeflag == tar.TypeDir {
+			x.dirs = append(x.dirs, dirMeta{path: x.base, mode: hdr.FileInfo().Mode().Perm(), modTime: hdr.ModTime})
+		}
+		return nil
+	}
+	rel, err := sanitizeFileName(hdr.Name)
+	if err != nil {
+		return &entryError{name: hdr.Name, err: err}
+	}
+	name := x.dirName + "/" + rel
+	finalPath := filepath.Join(x.base, filepath.FromSlash(rel))
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := ensureDir(x.base, finalPath); err != nil {
+			return &entryError{name: name, err: err}
+		}
+		x.dirs = append(x.dirs, dirMeta{path: finalPath, mode: hdr.FileInfo().Mode().Perm(), modTime: hdr.ModTime})
+		x.stats.Dirs++
+	case tar.TypeReg:
+		if err := x.extractFile(tr, hdr, name, finalPath); err != nil {
+			return &entryError{name: name, err: err}
+		}
+	case tar.TypeSymlink, tar.TypeLink:
+		if err := x.extractLink(hdr, name, finalPath); err != nil {
+			return &entryError{name: name, err: err}
+		}
+	default:
+		x.ignore(name, fmt.Sprintf("不支持的条目类型 %q", hdr.Typeflag))
+	}
+	return nil
+}
+
+// ignore 记录未解压的条目
+func (x *archiveExtractor) ignore(name, reason string) {
+	logger.LogWarn("跳过归档条目: %s (%s)", name, reason)
+	if len(x.stats.Ignored) < constants.MaxArchiveIgnored {
+		x.stats.Ignored = append(x.stats.Ignored, name+": "+reason)
+	}
+}
+
+// extractFile 将文件数据写入暂存文件，设置权限和修改时间后按冲突策略提交
+func (x *archiveExtractor) extractFile(reader io.Reader, hdr *tar.Header, name, finalPath string) error {
+	if err := ensureDir(x.base, filepath.Dir(finalPath)); err != nil {
+		return err
+	}
+	if proceed, err := x.checkExisting(finalPath); !proceed {
+		return err
+	}
+
+	res, err := x.ft.admitUpload(hdr.Size, hdr.Size)
+	if err != nil {
+		return err
+	}
+	defer res.release()
+
+	tempPath := stagingPath(finalPath)
+	outFile, err := os.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, constants.FilePermission)
+	if err != nil {
+		return fmt.Errorf("创建文件失败: %v", err)
+	}
+	defer outFile.Close()
+
+	hasher, _ := digest.New(digest.DefaultAlgorithm)
+	written, err := io.Copy(io.MultiWriter(outFile, hasher), &guardReader{reader: reader, max: x.ft.MaxFileSize, res: res})
+	if err != nil {
+		// 归档无法从中间续传，不保留暂存文件
+		outFile.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	x.ft.chunks.discard(finalPath)
+
+	// 提交（重命名）不改变权限和修改时间，在提交前设置
+	if !x.ft.IgnoreMetadata {
+		outFile.Chmod(hdr.FileInfo().Mode().Perm())
+		os.Chtimes(tempPath, hdr.ModTime, hdr.ModTime)
+	}
+
+	target, result, err := x.ft.commitUpload(outFile, finalPath, x.policy)
+	if err != nil {
+		return err
+	}
+	if result == constants.ResultSkipped {
+		x.stats.Skipped++
+		return nil
+	}
+	x.ft.rememberDigest(target, digest.Format(digest.DefaultAlgorithm, hasher))
+	if result == constants.ResultRenamed {
+		if stored, err := filepath.Rel(x.root, target); err == nil {
+			logger.LogInfo("📝 同名文件已存在，另存为: %s", filepath.ToSlash(stored))
+		}
+	}
+	logger.LogDebug("⬇️  已解压: %s (%s)", name, system.FormatSize(written))
+	x.stats.Files++
+	x.bytes += written
+	return nil
+}
+
+// extractLink 创建符号链接或硬链接。指向目标目录之外（或无法确认）的链接不创建，记录为未解压；
+// 链接不另存、不保留旧版本，rename 和 version 策略下按覆盖处理
+func (x *archiveExtractor) extractLink(hdr *tar.Header, name, finalPath string) error {
+	if err := ensureDir(x.base, filepath.Dir(finalPath)); err != nil {
+		return err
+	}
+	if x.ft.IgnoreMetadata && hdr.Typeflag == tar.TypeSymlink {
+		x.ignore(name, "接收端忽略元数据，不创建符号链接")
+		return nil
+	}
+
+	var source string
+	if hdr.Typeflag == tar.TypeLink {
+		// 硬链接指向归档中此前的文件
+		rel, err := sanitizeFileName(hdr.Linkname)
+		if err != nil {
+			x.ignore(name, err.Error())
+			return nil
+		}
+		source = filepath.Join(x.base, filepath.FromSlash(rel))
+		if info, err := os.Lstat(source); err != nil || !info.Mode().IsRegular() || !resolvesInside(x.base, filepath.Dir(source)) {
+			x.ignore(name, fmt.Sprintf("硬链接目标不是已解压的文件 %q", hdr.Linkname))
+			return nil
+		}
+	} else if err := safeLinkTarget(x.base, finalPath, hdr.Linkname); err != nil {
+		x.ignore(name, err.Error())
+		return nil
+	}
+
+	if proceed, err := x.checkExisting(finalPath); !proceed {
+		return err
+	}
+	if _, err := os.Lstat(finalPath); err == nil {
+		if err := os.Remove(finalPath); err != nil {
+			return err
+		}
+	}
+
+	if hdr.Typeflag == tar.TypeLink {
+		if err := os.Link(source, finalPath); err != nil {
+			x.ignore(name, fmt.Sprintf("创建硬链接失败: %v", err))
+			return nil
+		}
+	} else if err := os.Symlink(hdr.Linkname, finalPath); err != nil {
+		x.ignore(name, fmt.Sprintf("创建符号链接失败: %v", err))
+		return nil
+	}
+	x.stats.Links++
+	return nil
+}
+
+// checkExisting 按冲突策略处理已存在的同名条目，返回是否继续解压该条目。
+// 同名目录无法被文件或链接替换
+func (x *archiveExtractor) checkExisting(finalPath string) (bool, error) {
+	info, err := os.Lstat(finalPath)
+	if err != nil {
+		return true, nil
+	}
+	if info.IsDir() {
+		return false, fmt.Errorf("已存在同名目录")
+	}
+	switch x.policy {
+	case constants.ConflictSkip:
+		x.stats.Skipped++
+		return false, nil
+	case constants.ConflictFail:
+		return false, errFileExists
+	}
+	return true, nil
+}
+
+// finishDirs 设置目录的权限和修改时间，子目录先于上级目录。
+// 目录始终保留属主的读写执行权限，以便服务继续管理其中的文件
+func (x *archiveExtractor) finishDirs() {
+	if x.ft.IgnoreMetadata {
+		return
+	}
+	for i := len(x.dirs) - 1; i >= 0; i-- {
+		dir := x.dirs[i]
+		os.Chmod(dir.path, dir.mode|0700)
+		os.Chtimes(dir.path, dir.modTime, dir.modTime)
+	}
+}
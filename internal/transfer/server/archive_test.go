@@ -0,0 +1,162 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+)
+
+// buildArchive 生成 tar 归档，compress 为 true 时以 gzip 压缩
+func buildArchive(t *testing.T, compress bool, headers []*tar.Header, contents map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var gz *gzip.Writer
+	tw := tar.NewWriter(&buf)
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gz)
+	}
+	for _, hdr := range headers {
+		data := contents[hdr.Name]
+		hdr.Size = int64(len(data))
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(data))
+	}
+	tw.Close()
+	if gz != nil {
+		gz.Close()
+	}
+	return buf.Bytes()
+}
+
+// postArchive 上传目录归档并解析 JSON 响应
+func postArchive(t *testing.T, handler http.Handler, name string, data []byte, encoding string) (int, uploadResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/upload?name="+name, bytes.NewReader(data))
+	req.Header.Set("Content-Type", constants.ContentTypeTar)
+	req.Header.Set("Accept", "application/json")
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var resp uploadResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v: %s", err, rec.Body.String())
+	}
+	return rec.Code, resp
+}
+
+func TestArchiveUploadThroughForward(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	receiver := &FileTransfer{Mode: "receiver", StoragePath: storage}
+	next := httptest.NewServer(receiver.routes())
+	defer next.Close()
+	forward := &FileTransfer{Mode: "forward", TargetURL: next.URL, MaxFileSize: 10}
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	headers := []*tar.Header{
+		{Name: "./", Typeflag: tar.TypeDir, Mode: 0755, ModTime: mtime},
+		{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0750, ModTime: mtime},
+		{Name: "bin/run.sh", Typeflag: tar.TypeReg, Mode: 0700, ModTime: mtime},
+		{Name: "empty/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: mtime},
+		{Name: "docs/readme.txt", Typeflag: tar.TypeReg, Mode: 0644, ModTime: mtime},
+		{Name: "docs/latest", Typeflag: tar.TypeSymlink, Linkname: "readme.txt"},
+		{Name: "docs/copy.txt", Typeflag: tar.TypeLink, Linkname: "docs/readme.txt"},
+		{Name: "escape", Typeflag: tar.TypeSymlink, Linkname: "../../etc/passwd"},
+	}
+	contents := map[string]string{"bin/run.sh": "#!/bin/sh\necho hi\n", "docs/readme.txt": "hello"}
+	archive := buildArchive(t, true, headers, contents)
+
+	// 转发节点原样转发归档，单文件大小上限不作用于整个归档
+	code, resp := postArchive(t, StreamUploadHandler(forward), "project", archive, constants.ArchiveGzip)
+	if code != http.StatusOK || resp.Archive == nil || resp.Stored != "project" {
+		t.Fatalf("上传结果 = %d %+v", code, resp)
+	}
+	if resp.Archive.Files != 2 || resp.Archive.Dirs != 2 || resp.Archive.Links != 2 || len(resp.Archive.Ignored) != 1 {
+		t.Errorf("解压统计 = %+v", resp.Archive)
+	}
+	if len(resp.Hops) != 2 {
+		t.Errorf("经过节点 = %+v", resp.Hops)
+	}
+
+	base := filepath.Join(storage, "project")
+	info, err := os.Stat(filepath.Join(base, "bin", "run.sh"))
+	if err != nil || info.Mode().Perm() != 0700 || !info.ModTime().Equal(mtime) {
+		t.Errorf("文件元数据 = %v %v", info, err)
+	}
+	if info, err := os.Stat(filepath.Join(base, "bin")); err != nil || info.Mode().Perm() != 0750 || !info.ModTime().Equal(mtime) {
+		t.Errorf("目录元数据 = %v %v", info, err)
+	}
+	if info, err := os.Stat(filepath.Join(base, "empty")); err != nil || !info.IsDir() {
+		t.Errorf("空目录未创建: %v", err)
+	}
+	if target, err := os.Readlink(filepath.Join(base, "docs", "latest")); err != nil || target != "readme.txt" {
+		t.Errorf("符号链接 = %q %v", target, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(base, "docs", "copy.txt")); string(data) != "hello" {
+		t.Errorf("硬链接内容 = %q", data)
+	}
+	if _, err := os.Lstat(filepath.Join(base, "escape")); !os.IsNotExist(err) {
+		t.Errorf("指向目标目录外的链接不应创建: %v", err)
+	}
+}
+
+func TestArchiveUploadRejectsUnsafeEntries(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	ft := &FileTransfer{Mode: "receiver", StoragePath: filepath.Join(storage, "root")}
+
+	archive := buildArchive(t, false, []*tar.Header{
+		{Name: "../evil.txt", Typeflag: tar.TypeReg, Mode: 0644},
+	}, map[string]string{"../evil.txt": "x"})
+	if code, resp := postArchive(t, StreamUploadHandler(ft), "dir", archive, ""); code != http.StatusBadRequest || resp.Error == nil || resp.Error.Code != constants.ErrCodeInvalidPath {
+		t.Errorf("目录穿越条目 = %d %+v", code, resp)
+	}
+
+	// 指向目标目录之外的链接不创建，同名路径按普通目录解压
+	archive = buildArchive(t, false, []*tar.Header{
+		{Name: "sub/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "sub/up", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		{Name: "sub/out", Typeflag: tar.TypeSymlink, Linkname: "../.."},
+		{Name: "sub/out/x", Typeflag: tar.TypeReg, Mode: 0644},
+	}, map[string]string{"sub/out/x": "x"})
+	code, resp := postArchive(t, StreamUploadHandler(ft), "dir", archive, "")
+	if code != http.StatusOK || resp.Archive.Links != 1 || len(resp.Archive.Ignored) != 1 {
+		t.Errorf("指向目录外的链接 = %d %+v", code, resp.Archive)
+	}
+	if _, err := os.Stat(filepath.Join(storage, "root", "x")); !os.IsNotExist(err) {
+		t.Errorf("文件写到了目标目录之外: %v", err)
+	}
+	if info, err := os.Lstat(filepath.Join(storage, "root", "dir", "sub", "out")); err != nil || !info.IsDir() {
+		t.Errorf("sub/out 应为普通目录: %v %v", info, err)
+	}
+
+	// 同名文件按冲突策略处理
+	ft.OnConflict = constants.ConflictSkip
+	archive = buildArchive(t, false, []*tar.Header{
+		{Name: "sub/up/a.txt", Typeflag: tar.TypeReg, Mode: 0644},
+	}, map[string]string{"sub/up/a.txt": "first"})
+	postArchive(t, StreamUploadHandler(ft), "dir", archive, "")
+	code, resp = postArchive(t, StreamUploadHandler(ft), "dir", archive, "")
+	if code != http.StatusOK || resp.Archive.Skipped != 1 || resp.Archive.Files != 0 {
+		t.Errorf("跳过同名文件 = %d %+v", code, resp.Archive)
+	}
+	if data, _ := os.ReadFile(filepath.Join(storage, "root", "dir", "a.txt")); string(data) != "first" {
+		t.Errorf("经过目录树内链接写入的文件 = %q", data)
+	}
+}
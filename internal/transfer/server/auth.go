@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"go-transfer/internal/config"
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+)
+
+// 访问权限
+const (
+	scopeRead  = "read"
+	scopeWrite = "write"
+)
+
+// tokenContextKey 请求上下文中保存已认证令牌的键
+type tokenContextKey struct{}
+
+// bearerToken 从 Authorization 请求头中提取令牌
+func bearerToken(r *http.Request) string {
+	value := r.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(value, "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// lookupToken 查找匹配的令牌（常量时间比较）
+func (ft *FileTransfer) lookupToken(value string) *config.APIToken {
+	if value == "" {
+		return nil
+	}
+	for i := range ft.Tokens {
+		if subtle.ConstantTimeCompare([]byte(ft.Tokens[i].Token), []byte(value)) == 1 {
+			return &ft.Tokens[i]
+		}
+	}
+	return nil
+}
+
+// withAuth 认证中间件：未配置令牌时直接放行，否则校验令牌和权限
+func (ft *FileTransfer) withAuth(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(ft.Tokens) == 0 {
+			next(w, r)
+			return
+		}
+
+		token := ft.lookupToken(bearerToken(r))
+		if token == nil {
+			logger.LogWarn("认证失败: %s %s (来自 %s)", r.Method, r.URL.Path, r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="go-transfer"`)
+			writeError(w, r, http.StatusUnauthorized, constants.ErrCodeUnauthorized, "未授权: 缺少或无效的访问令牌")
+			return
+		}
+		if !token.HasScope(scope) {
+			writeError(w, r, http.StatusForbidden, constants.ErrCodeForbidden, "禁止访问: 令牌没有 %s 权限", scope)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), tokenContextKey{}, token)))
+	}
+}
+
+// allowPath 判断请求的令牌是否允许访问指定的相对路径，不允许时写入403响应
+func allowPath(w http.ResponseWriter, r *http.Request, name string) bool {
+	if _, err := sanitizeFileName(name); err != nil {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeInvalidPath, "%v", err)
+		return false
+	}
+	if pathAllowed(r, name, false) {
+		return true
+	}
+
+	writeError(w, r, http.StatusForbidden, constants.ErrCodeForbidden, "禁止访问: 路径不在令牌允许的范围内")
+	return false
+}
+
+// pathAllowed 判断请求的令牌是否允许访问指定的相对路径；
+// ancestor 为 true 时，令牌前缀的上级目录也视为允许（用于在列表中展示通往前缀的目录）
+func pathAllowed(r *http.Request, name string, ancestor bool) bool {
+	token, _ := r.Context().Value(tokenContextKey{}).(*config.APIToken)
+	if token == nil || token.PathPrefix == "" {
+		return true
+	}
+
+	prefix := strings.Trim(strings.ReplaceAll(token.PathPrefix, `\`, "/"), "/")
+	clean, err := sanitizeFileName(name)
+	if err != nil {
+		return false
+	}
+	if prefix == "" || clean == prefix || strings.HasPrefix(clean, prefix+"/") {
+		return true
+	}
+	return ancestor && strings.HasPrefix(prefix, clean+"/")
+}
+
+// setUpstreamAuth 为发往下一跳的请求附加本节点配置的令牌
+func (ft *FileTransfer) setUpstreamAuth(req *http.Request) {
+	if ft.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+ft.Token)
+	}
+}
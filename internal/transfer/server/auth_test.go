@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-transfer/internal/config"
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+)
+
+func TestTokenScopeAndPathPrefix(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	routes := (&FileTransfer{Mode: "receiver", StoragePath: storage, Tokens: []config.APIToken{
+		{Token: "admin"},
+		{Token: "reader", Scopes: []string{scopeRead}},
+		{Token: "team", PathPrefix: "team/", Scopes: []string{scopeRead, scopeWrite}},
+	}}).routes()
+
+	serve := func(method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader("hello"))
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("Accept", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		desc, method, target, token string
+		want                        int
+		code                        string
+	}{
+		{"缺少令牌", http.MethodPost, "/upload?name=a.txt", "", http.StatusUnauthorized, constants.ErrCodeUnauthorized},
+		{"无效令牌", http.MethodPost, "/upload?name=a.txt", "wrong", http.StatusUnauthorized, constants.ErrCodeUnauthorized},
+		{"只读令牌上传", http.MethodPost, "/upload?name=a.txt", "reader", http.StatusForbidden, constants.ErrCodeForbidden},
+		{"前缀外上传", http.MethodPost, "/upload?name=other/a.txt", "team", http.StatusForbidden, constants.ErrCodeForbidden},
+		{"前缀相似的路径", http.MethodPost, "/upload?name=teammate/a.txt", "team", http.StatusForbidden, constants.ErrCodeForbidden},
+		{"前缀外查询偏移", http.MethodHead, "/upload?name=other/a.txt", "team", http.StatusForbidden, ""},
+		{"前缀内上传", http.MethodPost, "/upload?name=team/a.txt", "team", http.StatusOK, ""},
+		{"前缀内查询偏移", http.MethodHead, "/upload?name=team/a.txt", "team", http.StatusOK, ""},
+		{"全部权限上传", http.MethodPost, "/upload?name=a.txt", "admin", http.StatusOK, ""},
+		{"只读令牌查询状态", http.MethodGet, "/status", "reader", http.StatusOK, ""},
+		{"未认证查询状态", http.MethodGet, "/status", "", http.StatusUnauthorized, constants.ErrCodeUnauthorized},
+	}
+	for _, tt := range tests {
+		rec := serve(tt.method, tt.target, tt.token)
+		if rec.Code != tt.want {
+			t.Errorf("%s: 状态码 = %d, 期望 %d: %s", tt.desc, rec.Code, tt.want, rec.Body.String())
+			continue
+		}
+		if tt.code != "" && !strings.Contains(rec.Body.String(), tt.code) {
+			t.Errorf("%s: 错误码不符: %s", tt.desc, rec.Body.String())
+		}
+		if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: 401 响应缺少 WWW-Authenticate", tt.desc)
+		}
+	}
+
+	// 被拒绝的上传不写入任何文件
+	for _, name := range []string{"other/a.txt", "teammate/a.txt"} {
+		if _, err := os.Stat(filepath.Join(storage, name)); !os.IsNotExist(err) {
+			t.Errorf("被拒绝的上传写入了 %s: %v", name, err)
+		}
+	}
+	if got, _ := os.ReadFile(filepath.Join(storage, "team", "a.txt")); string(got) != "hello" {
+		t.Errorf("前缀内上传的文件内容 = %q", got)
+	}
+}
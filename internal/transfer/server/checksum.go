@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/digest"
+)
+
+// declaredLength 返回请求声明的数据长度，分块编码时读取 X-Content-Length
+func declaredLength(r *http.Request) int64 {
+	if r.ContentLength >= 0 {
+		return r.ContentLength
+	}
+	if size, err := strconv.ParseInt(r.Header.Get(constants.HeaderContentLength), 10, 64); err == nil && size >= 0 {
+		return size
+	}
+	return -1
+}
+
+// expectsDigestTrailer 判断请求是否声明了摘要trailer
+func expectsDigestTrailer(r *http.Request) bool {
+	_, ok := r.Trailer[http.CanonicalHeaderKey(constants.HeaderContentDigest)]
+	return ok
+}
+
+// hashFile 将已有文件内容写入摘要计算器（续传时补算已提交部分）
+func hashFile(h hash.Hash, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	buffer := make([]byte, constants.LargeBufferSize)
+	_, err = io.CopyBuffer(h, file, buffer)
+	return err
+}
+
+// verifyDigest 比较客户端声明的摘要与实际摘要
+func verifyDigest(expected, actual string) error {
+	algorithm, _, err := digest.Parse(expected)
+	if err != nil {
+		return err
+	}
+	actualAlgorithm, _, _ := digest.Parse(actual)
+	if algorithm != actualAlgorithm {
+		return fmt.Errorf("摘要算法不一致: 期望 %s, 实际 %s", algorithm, actualAlgorithm)
+	}
+	if !digest.Equal(expected, actual) {
+		return fmt.Errorf("摘要不匹配: 期望 %s, 实际 %s", expected, actual)
+	}
+	return nil
+}
+
+// quarantine 将校验失败的暂存文件移入隔离目录，返回隔离后的路径
+func quarantine(root, tempPath, finalPath string) (string, error) {
+	rel, err := filepath.Rel(root, finalPath)
+	if err != nil {
+		return "", err
+	}
+
+	target := filepath.Join(root, constants.QuarantineDir, rel) + "." + time.Now().Format("20060102150405")
+	if err := os.MkdirAll(filepath.Dir(target), constants.DirPermission); err != nil {
+		return "", err
+	}
+	return target, os.Rename(tempPath, target)
+}
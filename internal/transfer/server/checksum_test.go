@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+)
+
+// quarantined 返回隔离目录中 name 的所有副本
+func quarantined(t *testing.T, storage, name string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(storage, constants.QuarantineDir, name+".*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+// postTrailer 经真实连接上传，摘要随trailer在请求体之后发送
+func postTrailer(t *testing.T, serverURL, name, body, contentDigest string) (int, uploadResponse) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, serverURL+"/upload?name="+name, io.NopCloser(strings.NewReader(body)))
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Accept", "application/json")
+	req.Trailer = http.Header{constants.HeaderContentDigest: {contentDigest}}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var resp uploadResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	return res.StatusCode, resp
+}
+
+func TestDigestMismatchQuarantines(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	receiver := &FileTransfer{Mode: "receiver", StoragePath: storage}
+	srv := httptest.NewServer(receiver.routes())
+	defer srv.Close()
+	routes := receiver.routes()
+
+	// 请求头中的摘要不一致
+	headers := map[string]string{constants.HeaderContentDigest: sha256Digest([]byte("other"))}
+	code, resp := postJSON(t, routes, "dir/a.txt", strings.NewReader("hello"), headers)
+	if code != http.StatusUnprocessableEntity || resp.Error == nil || resp.Error.Code != constants.ErrCodeDigestMismatch {
+		t.Fatalf("请求头摘要不一致 = %d %+v", code, resp)
+	}
+	if _, err := os.Stat(filepath.Join(storage, "dir", "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("校验失败的文件不应提交: %v", err)
+	}
+	if _, err := os.Stat(stagingPath(filepath.Join(storage, "dir", "a.txt"))); !os.IsNotExist(err) {
+		t.Errorf("校验失败后暂存文件仍存在: %v", err)
+	}
+	matches := quarantined(t, storage, "dir/a.txt")
+	if len(matches) != 1 {
+		t.Fatalf("隔离的文件 = %v", matches)
+	}
+	if got, _ := os.ReadFile(matches[0]); string(got) != "hello" {
+		t.Errorf("隔离的文件内容 = %q", got)
+	}
+
+	// trailer 中的摘要不一致
+	code, resp = postTrailer(t, srv.URL, "b.txt", "hello", sha256Digest([]byte("other")))
+	if code != http.StatusUnprocessableEntity || resp.Error == nil || resp.Error.Code != constants.ErrCodeDigestMismatch {
+		t.Fatalf("trailer摘要不一致 = %d %+v", code, resp)
+	}
+	if _, err := os.Stat(filepath.Join(storage, "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("校验失败的文件不应提交: %v", err)
+	}
+	if matches := quarantined(t, storage, "b.txt"); len(matches) != 1 {
+		t.Errorf("隔离的文件 = %v", matches)
+	}
+
+	// 摘要一致时正常提交
+	code, resp = postTrailer(t, srv.URL, "b.txt", "hello", sha256Digest([]byte("hello")))
+	if code != http.StatusOK || resp.Digest != sha256Digest([]byte("hello")) {
+		t.Fatalf("trailer摘要一致 = %d %+v", code, resp)
+	}
+	headers[constants.HeaderContentDigest] = sha256Digest([]byte("hello"))
+	if code, resp = postJSON(t, routes, "dir/a.txt", strings.NewReader("hello"), headers); code != http.StatusOK {
+		t.Errorf("请求头摘要一致 = %d %+v", code, resp)
+	}
+
+	// 不支持的摘要算法
+	headers[constants.HeaderContentDigest] = "crc32=00000000"
+	if code, _ = postJSON(t, routes, "c.txt", strings.NewReader("hello"), headers); code != http.StatusBadRequest {
+		t.Errorf("不支持的摘要算法状态码 = %d", code)
+	}
+}
@@ -0,0 +1,514 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/digest"
+	"go-transfer/internal/infrastructure/logger"
+	"go-transfer/internal/infrastructure/progress"
+	"go-transfer/internal/infrastructure/system"
+)
+
+// chunkState 分块上传的持久化状态，保存在暂存文件旁的状态文件中
+type chunkState struct {
+	UploadID   string     `json:"upload_id"`
+	Total      int64      `json:"total"`
+	FileDigest string     `json:"file_digest,omitempty"` // 客户端声明的整个文件摘要
+	Ranges     [][2]int64 `json:"ranges"`                // 已写入的区间 [起始, 结束]（包含），按起始排序并已合并
+}
+
+// chunkAssembly 正在拼装的文件，同一文件的各分块共享
+type chunkAssembly struct {
+	mu        sync.Mutex
+	finalPath string
+	state     chunkState
+	done      bool         // 已完成拼装（或已失败），后续分块不再写入
+	started   time.Time    // 本进程开始拼装的时间
+	space     *reservation // 为整个文件预留的空间，从状态文件恢复时为 nil（已计入存储目录的占用）
+}
+
+// chunkResult 已完成拼装的上传，分块在拼装后重发（如响应丢失）时据此返回结果
+type chunkResult struct {
+	finalPath string // 拼装时的最终路径
+	target    string // 实际保存的路径
+	result    string // 冲突处理结果
+	digest    string // 整个文件的摘要
+}
+
+// chunkRegistry 按最终路径索引正在拼装的文件
+type chunkRegistry struct {
+	mu       sync.Mutex
+	items    map[string]*chunkAssembly
+	finished map[string]chunkResult // 上传ID -> 最近完成拼装的结果
+}
+
+// open 获取指定上传ID的拼装状态，不存在时从状态文件恢复或创建预分配的暂存文件（创建前调用 admit 预留空间）。
+// 同一路径出现新的上传ID时，旧的拼装被丢弃
+func (cr *chunkRegistry) open(finalPath, uploadID string, total int64, fileDigest string, admit func() (*reservation, error)) (*chunkAssembly, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if cr.items == nil {
+		cr.items = make(map[string]*chunkAssembly)
+	}
+	if asm, ok := cr.items[finalPath]; ok && asm.state.UploadID == uploadID {
+		if asm.state.Total != total {
+			return nil, fmt.Errorf("分块总大小不一致: %d != %d", total, asm.state.Total)
+		}
+		return asm, nil
+	}
+
+	asm := &chunkAssembly{finalPath: finalPath, started: time.Now()}
+	if state, err := loadChunkState(finalPath); err == nil && state.UploadID == uploadID && state.Total == total {
+		asm.state = *state
+	} else {
+		asm.state = chunkState{UploadID: uploadID, Total: total, FileDigest: fileDigest}
+		res, err := admit()
+		if err != nil {
+			return nil, err
+		}
+		if err := preallocate(stagingPath(finalPath), total); err != nil {
+			res.cancel()
+			return nil, err
+		}
+		res.allocate(total)
+		if err := saveChunkState(finalPath, &asm.state); err != nil {
+			res.cancel()
+			return nil, err
+		}
+		asm.space = res
+	}
+
+	// 被替换的拼装共用同一暂存文件，其预留随之释放
+	if old, ok := cr.items[finalPath]; ok {
+		old.space.cancel()
+	}
+	cr.items[finalPath] = asm
+	return asm, nil
+}
+
+// discard 丢弃指定路径的拼装状态并释放其预留的空间（普通上传覆盖同名文件或分块上传中止时调用）
+func (cr *chunkRegistry) discard(finalPath string) {
+	cr.mu.Lock()
+	if asm, ok := cr.items[finalPath]; ok {
+		asm.space.cancel()
+		delete(cr.items, finalPath)
+	}
+	cr.mu.Unlock()
+	os.Remove(chunkStatePath(finalPath))
+}
+
+// finish 记录完成拼装的上传，只保留最近的 RecentTransfers 个
+func (cr *chunkRegistry) finish(uploadID string, res chunkResult) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if cr.finished == nil {
+		cr.finished = make(map[string]chunkResult)
+	}
+	for id := range cr.finished {
+		if len(cr.finished) < constants.RecentTransfers {
+			break
+		}
+		delete(cr.finished, id)
+	}
+	cr.finished[uploadID] = res
+}
+
+// completed 返回该上传ID已完成拼装的结果
+func (cr *chunkRegistry) completed(uploadID string) (chunkResult, bool) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	res, ok := cr.finished[uploadID]
+	return res, ok
+}
+
+// remove 拼装结束后移除状态，已写入的数据计入占用（暂存文件被删除时调用方先取消预留）
+func (cr *chunkRegistry) remove(asm *chunkAssembly) {
+	asm.space.release()
+	cr.mu.Lock()
+	if cr.items[asm.finalPath] == asm {
+		delete(cr.items, asm.finalPath)
+	}
+	cr.mu.Unlock()
+	os.Remove(chunkStatePath(asm.finalPath))
+}
+
+// preallocate 创建指定大小的暂存文件，各分块按偏移写入
+func preallocate(path string, size int64) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, constants.FilePermission)
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// loadChunkState 读取分块状态文件
+func loadChunkState(finalPath string) (*chunkState, error) {
+	data, err := os.ReadFile(chunkStatePath(finalPath))
+	if err != nil {
+		return nil, err
+	}
+	var state chunkState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// saveChunkState 写入分块状态文件（先写临时文件再重命名，避免中断时损坏）
+func saveChunkState(finalPath string, state *chunkState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	path := chunkStatePath(finalPath)
+	if err := os.WriteFile(path+".tmp", data, constants.FilePermission); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// addRange 记录新写入的区间并合并相邻/重叠区间
+func (s *chunkState) addRange(start, end int64) {
+	ranges := append(s.Ranges, [2]int64{start, end})
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r[0] <= last[1]+1 {
+			if r[1] > last[1] {
+				last[1] = r[1]
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	s.Ranges = merged
+}
+
+// received 返回已写入的字节数
+func (s *chunkState) received() int64 {
+	var n int64
+	for _, r := range s.Ranges {
+		n += r[1] - r[0] + 1
+	}
+	return n
+}
+
+// complete 判断所有分块是否都已到达
+func (s *chunkState) complete() bool {
+	return len(s.Ranges) == 1 && s.Ranges[0][0] == 0 && s.Ranges[0][1] == s.Total-1
+}
+
+// validUploadID 上传ID只允许字母数字、连字符和下划线
+func validUploadID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// handleChunkReceive 接收分块上传的一个分块，按 Content-Range 写入预分配暂存文件的对应偏移，
+// 所有分块到达后校验整个文件并原子地替换为最终文件
+func handleChunkReceive(ft *FileTransfer, w http.ResponseWriter, r *http.Request, reader io.Reader, fileName string, size int64) {
+	uploadID := r.Header.Get(constants.HeaderUploadID)
+	if !validUploadID(uploadID) {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "上传ID无效")
+		return
+	}
+
+	finalPath, err := resolveStoragePath(ft, fileName)
+	if err != nil {
+		logger.LogWarn("拒绝上传: %v", err)
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeInvalidPath, "%v", err)
+		return
+	}
+	if !allowPath(w, r, fileName) {
+		return
+	}
+	policy, err := ft.conflictPolicy(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "%v", err)
+		return
+	}
+
+	cr, err := parseContentRange(r.Header.Get("Content-Range"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeInvalidRange, "分块上传需要 Content-Range: %v", err)
+		return
+	}
+	length := cr.End - cr.Start + 1
+	if size >= 0 && size != length {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeInvalidRange, "Content-Range 与 Content-Length 不一致")
+		return
+	}
+	if ft.MaxFileSize > 0 && cr.Total > ft.MaxFileSize {
+		respondLimit(w, r, fileName, errTooLarge(cr.Total, ft.MaxFileSize))
+		return
+	}
+
+	// 整个文件的摘要在拼装完成后校验
+	fileDigest := r.Header.Get(constants.HeaderFileDigest)
+	if fileDigest != "" {
+		if _, _, err := digest.Parse(fileDigest); err != nil {
+			writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "%v", err)
+			return
+		}
+	}
+
+	// 拼装完成后重发的分块（客户端未收到最后的响应）直接返回已完成的结果
+	if done, ok := ft.chunks.completed(uploadID); ok && ft.stillAssembled(done, finalPath, cr.Total, fileDigest) {
+		ft.respondAssembled(w, r, reader, length, fileName, done)
+		return
+	}
+
+	// 创建所在目录（不经过指向存储目录外的链接）
+	if err := ensureDir(system.ExpandPath(ft.StoragePath), filepath.Dir(finalPath)); err != nil {
+		respondPathError(w, r, "创建目录失败", err)
+		return
+	}
+
+	// 尚未开始拼装时按冲突策略处理同名文件
+	if _, err := os.Stat(chunkStatePath(finalPath)); os.IsNotExist(err) && ft.rejectExisting(w, r, finalPath, fileName, policy) {
+		return
+	}
+
+	asm, err := ft.chunks.open(finalPath, uploadID, cr.Total, fileDigest, func() (*reservation, error) {
+		return ft.admitUpload(cr.Total, cr.Total)
+	})
+	if respondLimit(w, r, fileName, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusConflict, constants.ErrCodeUploadConflict, "分块上传状态错误: %v", err)
+		return
+	}
+
+	logger.LogDebug("⬇️  接收分块: %s [%d-%d/%d]", fileName, cr.Start, cr.End, cr.Total)
+
+	// 本分块的摘要（请求头或trailer）
+	expected := r.Header.Get(constants.HeaderContentDigest)
+	algorithm := digest.DefaultAlgorithm
+	if expected != "" {
+		if algorithm, _, err = digest.Parse(expected); err != nil {
+			writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "%v", err)
+			return
+		}
+	}
+	hasher, _ := digest.New(algorithm)
+
+	outFile, err := os.OpenFile(stagingPath(finalPath), os.O_WRONLY, constants.FilePermission)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "打开暂存文件失败: %v", err)
+		return
+	}
+	defer outFile.Close()
+
+	// 写入分块对应的偏移（多个分块并发写入，不单独显示进度条）
+	writer := progress.NewProgressWriter(io.MultiWriter(io.NewOffsetWriter(outFile, cr.Start), hasher), length, "")
+	writer.SetQuiet()
+	transferFrom(r).attach(fileName, writer)
+	written, err := io.Copy(writer, io.LimitReader(reader, length))
+	ft.stats().received.Add(float64(written))
+	asm.space.wrote(written)
+	if err != nil {
+		cancelled := transferFrom(r).isCancelled()
+		if cancelled || ft.discardAborted() {
+			outFile.Close()
+			ft.chunks.discard(finalPath)
+			os.Remove(stagingPath(finalPath))
+		}
+		if cancelled {
+			respondCancelled(w, r, fileName)
+			return
+		}
+		if ft.discardAborted() {
+			logger.LogWarn("服务停止，已删除未完成的分块上传: %s", fileName)
+		}
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "写入分块失败: %v", err)
+		return
+	}
+	if written != length {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeIncomplete, "分块数据不完整: 已接收 %d / %d bytes", written, length)
+		return
+	}
+	if n, _ := io.Copy(io.Discard, io.LimitReader(reader, 1)); n > 0 {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeInvalidRange, "数据超出 Content-Range 声明的范围")
+		return
+	}
+
+	if expected == "" {
+		expected = r.Trailer.Get(constants.HeaderContentDigest)
+	}
+	actual := digest.Format(algorithm, hasher)
+	w.Header().Set(constants.HeaderContentDigest, actual)
+	if expected != "" {
+		if err := verifyDigest(expected, actual); err != nil {
+			// 不记录该分块，客户端重传即可
+			writeError(w, r, http.StatusUnprocessableEntity, constants.ErrCodeDigestMismatch, "分块校验失败: %v", err)
+			return
+		}
+	}
+	if err := outFile.Sync(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "保存分块失败: %v", err)
+		return
+	}
+
+	asm.mu.Lock()
+	defer asm.mu.Unlock()
+	if asm.done {
+		writeError(w, r, http.StatusConflict, constants.ErrCodeUploadConflict, "上传已结束")
+		return
+	}
+
+	asm.state.addRange(cr.Start, cr.End)
+	if !asm.state.complete() {
+		if err := saveChunkState(finalPath, &asm.state); err != nil {
+			writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "保存分块状态失败: %v", err)
+			return
+		}
+		resp := &uploadResponse{
+			Status:  constants.UploadStatusPartial,
+			Name:    fileName,
+			Bytes:   asm.state.received(),
+			Total:   cr.Total,
+			Message: fmt.Sprintf("已接收分块: %s [%d-%d] (%d/%d bytes)", fileName, cr.Start, cr.End, asm.state.received(), cr.Total),
+		}
+		resp.setTiming(requestStart(r), written)
+		ft.writeUpload(w, r, http.StatusAccepted, resp)
+		return
+	}
+
+	// 最后一个分块到达：校验整个文件并落盘
+	asm.done = true
+	defer ft.chunks.remove(asm)
+	outFile.Close()
+	finalizeChunks(ft, w, r, asm, fileName, policy)
+}
+
+// finalizeChunks 校验拼装完成的文件并原子地替换为最终文件
+func finalizeChunks(ft *FileTransfer, w http.ResponseWriter, r *http.Request, asm *chunkAssembly, fileName, policy string) {
+	tempPath := stagingPath(asm.finalPath)
+
+	algorithm := digest.DefaultAlgorithm
+	if asm.state.FileDigest != "" {
+		algorithm, _, _ = digest.Parse(asm.state.FileDigest)
+	}
+	hasher, _ := digest.New(algorithm)
+	if err := hashFile(hasher, tempPath); err != nil {
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "读取暂存文件失败: %v", err)
+		return
+	}
+	actual := digest.Format(algorithm, hasher)
+	w.Header().Set(constants.HeaderFileDigest, actual)
+
+	if asm.state.FileDigest != "" {
+		if err := verifyDigest(asm.state.FileDigest, actual); err != nil {
+			expandedPath := system.ExpandPath(ft.StoragePath)
+			if target, qerr := quarantine(expandedPath, tempPath, asm.finalPath); qerr == nil {
+				logger.LogError("校验失败，文件已隔离: %s → %s (%v)", fileName, target, err)
+			} else {
+				asm.space.cancel()
+				os.Remove(tempPath)
+				logger.LogError("校验失败，文件已删除: %s (%v)", fileName, err)
+			}
+			writeError(w, r, http.StatusUnprocessableEntity, constants.ErrCodeDigestMismatch, "完整性校验失败: %v", err)
+			return
+		}
+	}
+
+	file, err := os.OpenFile(tempPath, os.O_RDWR, constants.FilePermission)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "保存文件失败: %v", err)
+		return
+	}
+	// 元数据随每个分块发送，已在 handleReceive 中校验
+	meta, _ := ft.fileMeta(r)
+	meta.apply(tempPath, false)
+	target, result, err := ft.commitUpload(file, asm.finalPath, policy)
+	if err == errFileExists {
+		asm.space.cancel()
+		respondExists(w, r, fileName)
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "保存文件失败: %v", err)
+		return
+	}
+	if result == constants.ResultSkipped {
+		asm.space.cancel()
+		ft.respondSkipped(w, r, fileName)
+		return
+	}
+	ft.rememberDigest(target, actual)
+	ft.chunks.finish(asm.state.UploadID, chunkResult{finalPath: asm.finalPath, target: target, result: result, digest: actual})
+	stored := ft.setStoreResult(w, target, result)
+
+	logger.LogSuccess("文件已保存: %s (%.2f MB, 分块拼装, %s)", stored, float64(asm.state.Total)/1024/1024, actual)
+	resp := &uploadResponse{
+		Status:  constants.UploadStatusOK,
+		Name:    fileName,
+		Stored:  stored,
+		Bytes:   asm.state.Total,
+		Digest:  actual,
+		Result:  result,
+		Message: fmt.Sprintf("文件上传成功: %s (%d bytes, %s, %s)", stored, asm.state.Total, actual, result),
+	}
+	resp.setTiming(asm.started, asm.state.Total)
+	ft.stats().observeUpload(asm.started, asm.state.Total)
+	ft.writeUpload(w, r, http.StatusOK, resp)
+}
+
+// stillAssembled 判断已完成的拼装是否对应本次请求：最终路径和声明的摘要一致，
+// 且保存的文件仍是拼装结果（大小和记录的摘要未变）
+func (ft *FileTransfer) stillAssembled(done chunkResult, finalPath string, total int64, fileDigest string) bool {
+	if done.finalPath != finalPath || (fileDigest != "" && !digest.Equal(fileDigest, done.digest)) {
+		return false
+	}
+	info, err := os.Stat(done.target)
+	if err != nil || info.Size() != total {
+		return false
+	}
+	return digest.Equal(ft.knownDigest(done.target, info), done.digest)
+}
+
+// respondAssembled 丢弃重发的分块数据，返回已完成拼装的结果
+func (ft *FileTransfer) respondAssembled(w http.ResponseWriter, r *http.Request, reader io.Reader, length int64, fileName string, done chunkResult) {
+	// 读完请求体，客户端据此确认分块已完整发送
+	io.Copy(io.Discard, io.LimitReader(reader, length+1))
+	logger.LogInfo("分块上传已完成拼装，返回已保存的结果: %s", fileName)
+
+	w.Header().Set(constants.HeaderFileDigest, done.digest)
+	stored := ft.setStoreResult(w, done.target, done.result)
+	info, _ := os.Stat(done.target)
+	resp := &uploadResponse{
+		Status:  constants.UploadStatusOK,
+		Name:    fileName,
+		Stored:  stored,
+		Bytes:   info.Size(),
+		Digest:  done.digest,
+		Result:  done.result,
+		Message: fmt.Sprintf("文件上传成功: %s (%d bytes, %s, %s)", stored, info.Size(), done.digest, done.result),
+	}
+	resp.setTiming(requestStart(r), 0)
+	ft.writeUpload(w, r, http.StatusOK, resp)
+}
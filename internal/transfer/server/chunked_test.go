@@ -0,0 +1,158 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+)
+
+// sendChunk 以分块上传方式发送 data[start:end+1]
+func sendChunk(ft *FileTransfer, name, uploadID, fileDigest string, data []byte, start, end int64) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/upload?name="+name, bytes.NewReader(data[start:end+1]))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+	req.Header.Set(constants.HeaderUploadID, uploadID)
+	if fileDigest != "" {
+		req.Header.Set(constants.HeaderFileDigest, fileDigest)
+	}
+	rec := httptest.NewRecorder()
+	StreamUploadHandler(ft)(rec, req)
+	return rec
+}
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256=" + hex.EncodeToString(sum[:])
+}
+
+func TestChunkedUploadAssemblesOutOfOrder(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	ft := &FileTransfer{Mode: "receiver", StoragePath: storage}
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1000)
+	fileDigest := sha256Digest(data)
+	chunks := [][2]int64{{8000, 15999}, {0, 3999}, {4000, 7999}}
+
+	for i, c := range chunks {
+		rec := sendChunk(ft, "dir/big.bin", "id1", fileDigest, data, c[0], c[1])
+		want := http.StatusAccepted
+		if i == len(chunks)-1 {
+			want = http.StatusOK
+		}
+		if rec.Code != want {
+			t.Fatalf("分块 %v 状态码 = %d, 期望 %d: %s", c, rec.Code, want, rec.Body.String())
+		}
+		if i == len(chunks)-1 && rec.Header().Get(constants.HeaderFileDigest) != fileDigest {
+			t.Fatalf("文件摘要 = %q, 期望 %q", rec.Header().Get(constants.HeaderFileDigest), fileDigest)
+		}
+	}
+
+	got, err := os.ReadFile(filepath.Join(storage, "dir", "big.bin"))
+	if err != nil {
+		t.Fatalf("读取拼装结果失败: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("拼装结果与原文件不一致")
+	}
+	for _, leftover := range []string{".big.bin" + constants.PartialSuffix, ".big.bin" + constants.ChunkStateSuffix} {
+		if _, err := os.Stat(filepath.Join(storage, "dir", leftover)); err == nil {
+			t.Errorf("拼装完成后仍残留 %s", leftover)
+		}
+	}
+}
+
+func TestChunkedUploadResumesFromStateFile(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	data := bytes.Repeat([]byte("x"), 1000)
+
+	// 服务重启后，已到达的分块从状态文件恢复
+	first := &FileTransfer{Mode: "receiver", StoragePath: storage}
+	if rec := sendChunk(first, "a.bin", "id2", "", data, 0, 499); rec.Code != http.StatusAccepted {
+		t.Fatalf("状态码 = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	restarted := &FileTransfer{Mode: "receiver", StoragePath: storage}
+	if rec := sendChunk(restarted, "a.bin", "id2", "", data, 500, 999); rec.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d: %s", rec.Code, rec.Body.String())
+	}
+	if got, _ := os.ReadFile(filepath.Join(storage, "a.bin")); !bytes.Equal(got, data) {
+		t.Fatal("拼装结果与原文件不一致")
+	}
+}
+
+func TestChunkedUploadRejectsFileDigestMismatch(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	ft := &FileTransfer{Mode: "receiver", StoragePath: storage}
+
+	data := []byte("hello chunked world")
+	wrong := sha256Digest([]byte("something else"))
+
+	sendChunk(ft, "c.txt", "id3", wrong, data, 0, 9)
+	rec := sendChunk(ft, "c.txt", "id3", wrong, data, 10, int64(len(data)-1))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("状态码 = %d, 期望 %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if _, err := os.Stat(filepath.Join(storage, "c.txt")); err == nil {
+		t.Fatal("校验失败的文件不应出现在最终路径")
+	}
+}
+
+func TestChunkedUploadRetriedAfterAssembly(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	ft := &FileTransfer{Mode: "receiver", StoragePath: storage}
+	data := bytes.Repeat([]byte("y"), 2000)
+	fileDigest := sha256Digest(data)
+
+	sendChunk(ft, "r.bin", "id3", fileDigest, data, 0, 999)
+	if rec := sendChunk(ft, "r.bin", "id3", fileDigest, data, 1000, 1999); rec.Code != http.StatusOK {
+		t.Fatalf("最后一块状态码 = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// 最后一块的响应丢失，客户端重发：返回已完成的结果，不重新开始拼装
+	rec := sendChunk(ft, "r.bin", "id3", fileDigest, data, 1000, 1999)
+	if rec.Code != http.StatusOK || rec.Header().Get(constants.HeaderFileDigest) != fileDigest {
+		t.Fatalf("重发状态码 = %d, 摘要 %q: %s", rec.Code, rec.Header().Get(constants.HeaderFileDigest), rec.Body.String())
+	}
+	for _, leftover := range []string{".r.bin" + constants.PartialSuffix, ".r.bin" + constants.ChunkStateSuffix} {
+		if _, err := os.Stat(filepath.Join(storage, leftover)); err == nil {
+			t.Errorf("重发后残留 %s", leftover)
+		}
+	}
+
+	// 文件已被其他上传替换时不再视为已完成
+	os.WriteFile(filepath.Join(storage, "r.bin"), bytes.Repeat([]byte("z"), 2000), 0644)
+	if rec := sendChunk(ft, "r.bin", "id3", fileDigest, data, 1000, 1999); rec.Code == http.StatusOK {
+		t.Fatalf("文件被替换后重发仍返回完成: %s", rec.Body.String())
+	}
+}
+
+func TestChunkedUploadRejectsSymlinkEscape(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(storage, "link")); err != nil {
+		t.Skipf("无法创建符号链接: %v", err)
+	}
+	ft := &FileTransfer{Mode: "receiver", StoragePath: storage}
+	data := bytes.Repeat([]byte("x"), 1000)
+
+	if rec := sendChunk(ft, "link/sub/a.bin", "id4", "", data, 0, 499); rec.Code != http.StatusBadRequest {
+		t.Fatalf("经链接逃逸的分块状态码 = %d: %s", rec.Code, rec.Body.String())
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("存储目录外被写入了 %d 项", len(entries))
+	}
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go-transfer/internal/config"
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+	"go-transfer/internal/infrastructure/system"
+)
+
+// errFileExists fail 策略下同名文件已存在
+var errFileExists = errors.New("文件已存在")
+
+// conflictPolicy 返回本次上传的冲突策略：请求头（或 on_conflict 参数）优先，其次为服务器默认策略
+func (ft *FileTransfer) conflictPolicy(r *http.Request) (string, error) {
+	value := r.Header.Get(constants.HeaderOnConflict)
+	if value == "" {
+		value = r.URL.Query().Get("on_conflict")
+	}
+	policy, err := config.ParseConflictPolicy(value)
+	if err != nil {
+		return "", err
+	}
+	if policy == "" {
+		policy = ft.OnConflict
+	}
+	if policy == "" {
+		policy = constants.ConflictOverwrite
+	}
+	return policy, nil
+}
+
+// rejectExisting 新上传开始前检查同名文件，skip/fail 策略下直接响应（不接收数据）并返回 true
+func (ft *FileTransfer) rejectExisting(w http.ResponseWriter, r *http.Request, finalPath, fileName, policy string) bool {
+	if _, err := os.Stat(finalPath); err != nil {
+		return false
+	}
+	switch policy {
+	case constants.ConflictSkip:
+		ft.respondSkipped(w, r, fileName)
+		return true
+	case constants.ConflictFail:
+		respondExists(w, r, fileName)
+		return true
+	}
+	return false
+}
+
+// respondSkipped 告知客户端已保留同名文件、跳过本次上传
+func (ft *FileTransfer) respondSkipped(w http.ResponseWriter, r *http.Request, fileName string) {
+	logger.LogInfo("⏭️  文件已存在，跳过: %s", fileName)
+	w.Header().Set(constants.HeaderConflictResult, constants.ResultSkipped)
+	w.Header().Set(constants.HeaderStoredName, fileName)
+	ft.writeUpload(w, r, http.StatusOK, &uploadResponse{
+		Status:  constants.UploadStatusSkipped,
+		Name:    fileName,
+		Stored:  fileName,
+		Result:  constants.ResultSkipped,
+		Message: fmt.Sprintf("文件已存在，已跳过: %s", fileName),
+	})
+}
+
+// respondExists 以 409 拒绝覆盖同名文件
+func respondExists(w http.ResponseWriter, r *http.Request, fileName string) {
+	logger.LogWarn("文件已存在，拒绝上传: %s", fileName)
+	w.Header().Set(constants.HeaderConflictResult, constants.ResultExists)
+	writeError(w, r, http.StatusConflict, constants.ErrCodeFileExists, "%v: %s", errFileExists, fileName)
+}
+
+// commitUpload 按冲突策略将暂存文件提交到最终位置，返回实际保存的路径和处理结果。
+// 传输期间出现同名文件时，skip 策略丢弃暂存文件并返回 ResultSkipped，fail 策略返回 errFileExists
+func (ft *FileTransfer) commitUpload(file *os.File, finalPath, policy string) (string, string, error) {
+	// 串行化提交，避免并发上传选中同一个另存名称
+	ft.commitMu.Lock()
+	defer ft.commitMu.Unlock()
+
+	if _, err := os.Stat(finalPath); err != nil {
+		return finalPath, constants.ResultCreated, commitStaging(file, finalPath)
+	}
+
+	switch policy {
+	case constants.ConflictSkip, constants.ConflictFail:
+		file.Close()
+		os.Remove(file.Name())
+		if policy == constants.ConflictFail {
+			return finalPath, "", errFileExists
+		}
+		return finalPath, constants.ResultSkipped, nil
+	case constants.ConflictRename:
+		target := nextFreeName(finalPath)
+		return target, constants.ResultRenamed, commitStaging(file, target)
+	case constants.ConflictVersion:
+		version, err := ft.archiveVersion(finalPath)
+		if err != nil {
+			return finalPath, "", fmt.Errorf("保存旧版本失败: %v", err)
+		}
+		logger.LogInfo("🗂️  旧版本已保存: %s", version)
+		return finalPath, constants.ResultVersioned, commitStaging(file, finalPath)
+	default:
+		return finalPath, constants.ResultOverwritten, commitStaging(file, finalPath)
+	}
+}
+
+// nextFreeName 返回带数字后缀的可用路径，例如 a.txt → a_1.txt
+func nextFreeName(finalPath string) string {
+	dir, base := filepath.Split(finalPath)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	if stem == "" {
+		// 以点开头且没有其他扩展名的文件（如 .env）整体作为名称
+		stem, ext = base, ""
+	}
+
+	for i := 1; ; i++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s_%d%s", stem, i, ext))
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			if _, err := os.Stat(stagingPath(candidate)); os.IsNotExist(err) {
+				return candidate
+			}
+		}
+	}
+}
+
+// archiveVersion 将已有文件移入版本目录（保留相对路径，追加时间戳），返回版本文件的相对路径
+func (ft *FileTransfer) archiveVersion(finalPath string) (string, error) {
+	root := system.ExpandPath(ft.StoragePath)
+	rel, err := filepath.Rel(root, finalPath)
+	if err != nil {
+		return "", err
+	}
+
+	base := filepath.Join(root, constants.VersionsDir, rel) + "." + time.Now().Format("20060102150405")
+	target := base
+	for i := 1; ; i++ {
+		if _, err := os.Stat(target); os.IsNotExist(err) {
+			break
+		}
+		target = fmt.Sprintf("%s-%d", base, i)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), constants.DirPermission); err != nil {
+		return "", err
+	}
+	if err := os.Rename(finalPath, target); err != nil {
+		return "", err
+	}
+	versionRel, _ := filepath.Rel(root, target)
+	return filepath.ToSlash(versionRel), nil
+}
+
+// setStoreResult 在响应头中报告处理结果和实际保存的相对路径
+func (ft *FileTransfer) setStoreResult(w http.ResponseWriter, target, result string) string {
+	stored := target
+	if rel, err := filepath.Rel(system.ExpandPath(ft.StoragePath), target); err == nil {
+		stored = filepath.ToSlash(rel)
+	}
+	w.Header().Set(constants.HeaderConflictResult, result)
+	w.Header().Set(constants.HeaderStoredName, stored)
+	return stored
+}
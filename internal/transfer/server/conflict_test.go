@@ -0,0 +1,99 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+)
+
+// upload 以二进制流上传 data，policy 为空时使用服务器默认策略
+func upload(ft *FileTransfer, name, data, policy string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/upload?name="+name, strings.NewReader(data))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if policy != "" {
+		req.Header.Set(constants.HeaderOnConflict, policy)
+	}
+	rec := httptest.NewRecorder()
+	StreamUploadHandler(ft)(rec, req)
+	return rec
+}
+
+func TestConflictPolicies(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	ft := &FileTransfer{Mode: "receiver", StoragePath: storage, OnConflict: constants.ConflictFail}
+
+	read := func(name string) string {
+		data, _ := os.ReadFile(filepath.Join(storage, name))
+		return string(data)
+	}
+
+	tests := []struct {
+		policy string
+		data   string
+		status int
+		result string
+		stored string
+	}{
+		{"", "v1", http.StatusOK, constants.ResultCreated, "dir/a.txt"},
+		{"", "v2", http.StatusConflict, constants.ResultExists, ""},
+		{constants.ConflictSkip, "v3", http.StatusOK, constants.ResultSkipped, "dir/a.txt"},
+		{constants.ConflictRename, "v4", http.StatusOK, constants.ResultRenamed, "dir/a_1.txt"},
+		{constants.ConflictRename, "v5", http.StatusOK, constants.ResultRenamed, "dir/a_2.txt"},
+		{constants.ConflictVersion, "v6", http.StatusOK, constants.ResultVersioned, "dir/a.txt"},
+		{constants.ConflictOverwrite, "v7", http.StatusOK, constants.ResultOverwritten, "dir/a.txt"},
+	}
+	for _, tt := range tests {
+		rec := upload(ft, "dir/a.txt", tt.data, tt.policy)
+		if rec.Code != tt.status {
+			t.Fatalf("%q: 状态码 = %d, 期望 %d: %s", tt.policy, rec.Code, tt.status, rec.Body.String())
+		}
+		if got := rec.Header().Get(constants.HeaderConflictResult); got != tt.result {
+			t.Errorf("%q: 处理结果 = %q, 期望 %q", tt.policy, got, tt.result)
+		}
+		if got := rec.Header().Get(constants.HeaderStoredName); got != tt.stored {
+			t.Errorf("%q: 保存路径 = %q, 期望 %q", tt.policy, got, tt.stored)
+		}
+	}
+
+	if got := read("dir/a.txt"); got != "v7" {
+		t.Errorf("a.txt = %q, 期望 v7", got)
+	}
+	if got, want := read("dir/a_1.txt")+read("dir/a_2.txt"), "v4v5"; got != want {
+		t.Errorf("另存的文件 = %q, 期望 %q", got, want)
+	}
+	versions, _ := filepath.Glob(filepath.Join(storage, constants.VersionsDir, "dir", "a.txt.*"))
+	if len(versions) != 1 {
+		t.Fatalf("版本文件 = %v, 期望 1 个", versions)
+	}
+	if data, _ := os.ReadFile(versions[0]); string(data) != "v1" {
+		t.Errorf("版本文件内容 = %q, 期望 v1", data)
+	}
+
+	if rec := upload(ft, "b.txt", "x", "bogus"); rec.Code != http.StatusBadRequest {
+		t.Errorf("未知策略状态码 = %d, 期望 %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestNextFreeName(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.tar.gz", "a.tar_1.gz", ".env", "noext"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	tests := map[string]string{
+		"a.tar.gz": "a.tar_2.gz",
+		".env":     ".env_1",
+		"noext":    "noext_1",
+	}
+	for name, want := range tests {
+		if got := filepath.Base(nextFreeName(filepath.Join(dir, name))); got != want {
+			t.Errorf("nextFreeName(%q) = %q, 期望 %q", name, got, want)
+		}
+	}
+}
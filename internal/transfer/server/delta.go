@@ -0,0 +1,155 @@
+package server
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/delta"
+	"go-transfer/internal/infrastructure/logger"
+	"go-transfer/internal/infrastructure/system"
+)
+
+// signature GET /signature 的响应
+type signature struct {
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	BlockSize int    `json:"block_size"`
+	ETag      string `json:"etag"`   // 计算签名时文件的 ETag，差量上传时以 X-Delta-Base 发回
+	Blocks    []byte `json:"blocks"` // 各块的 4 字节弱校验和 16 字节强校验（base64）
+}
+
+// handleSignature 处理 GET /signature?name=：返回接收端已有文件的块签名，供客户端计算差量
+func (ft *FileTransfer) handleSignature(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, constants.ErrCodeMethodNotAllowed, "仅支持GET方法")
+		return
+	}
+	if ft.Mode == "forward" {
+		ft.proxyGet(w, r, []string{"Accept"}, []string{"Content-Type"})
+		return
+	}
+	if ft.Mode != "receiver" {
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "未知服务模式")
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "缺少 name 参数")
+		return
+	}
+	if !allowPath(w, r, name) {
+		return
+	}
+	finalPath, err := resolveStoragePath(ft, name)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeInvalidPath, "%v", err)
+		return
+	}
+	file, err := os.Open(finalPath)
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, constants.ErrCodeNotFound, "文件不存在: %s", name)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		writeError(w, r, http.StatusNotFound, constants.ErrCodeNotFound, "文件不存在: %s", name)
+		return
+	}
+
+	start := time.Now()
+	sig, err := delta.Compute(file, delta.BlockSize(info.Size()))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "计算块签名失败: %v", err)
+		return
+	}
+	blocks, _ := sig.MarshalBinary()
+	logger.LogInfo("🧩 已计算块签名: %s (%s, %d 块, 耗时 %.1fs)",
+		name, system.FormatSize(sig.Size), sig.Blocks(), time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(signature{
+		Name:      name,
+		Size:      sig.Size,
+		BlockSize: sig.BlockSize,
+		ETag:      fileETag(info),
+		Blocks:    blocks,
+	})
+}
+
+// isDeltaUpload 判断请求体是否为差量指令流
+func isDeltaUpload(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == constants.ContentTypeDelta
+}
+
+// handleDeltaUpload 处理差量上传（Content-Type: application/x-gt-delta）：
+// 接收模式以已有文件为基准重建新文件，转发模式原样转发差量流
+func handleDeltaUpload(ft *FileTransfer, w http.ResponseWriter, r *http.Request) {
+	fileName := r.URL.Query().Get("name")
+	if fileName == "" || r.Header.Get(constants.HeaderDeltaBase) == "" {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "差量上传需要 name 参数和 %s 请求头", constants.HeaderDeltaBase)
+		return
+	}
+
+	switch ft.Mode {
+	case "receiver":
+		ft.receiveDelta(w, r, fileName)
+	case "forward":
+		handleForward(ft, w, r, r.Body, fileName, deltaLength(r), false)
+	default:
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "未知服务模式")
+	}
+}
+
+// deltaLength 差量上传声明的重建后文件大小（X-Content-Length），请求体本身的长度与之无关
+func deltaLength(r *http.Request) int64 {
+	if size, err := strconv.ParseInt(r.Header.Get(constants.HeaderContentLength), 10, 64); err == nil && size >= 0 {
+		return size
+	}
+	return -1
+}
+
+// receiveDelta 打开基准文件并确认其与客户端计算差量时一致（ETag 相同），
+// 重建出的数据与普通上传一样写入暂存文件、校验整个文件的摘要，再按冲突策略原子地替换
+func (ft *FileTransfer) receiveDelta(w http.ResponseWriter, r *http.Request, fileName string) {
+	if r.Header.Get("Content-Range") != "" || r.Header.Get(constants.HeaderUploadID) != "" {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "差量上传不支持续传和分块")
+		return
+	}
+	if !allowPath(w, r, fileName) {
+		return
+	}
+	finalPath, err := resolveStoragePath(ft, fileName)
+	if err != nil {
+		logger.LogWarn("拒绝上传: %v", err)
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeInvalidPath, "%v", err)
+		return
+	}
+
+	// 基准文件保持打开，提交时即使被替换也仍读取原内容
+	base, err := os.Open(finalPath)
+	if err != nil {
+		writeError(w, r, http.StatusPreconditionFailed, constants.ErrCodeBaseChanged, "差量基准不存在: %s", fileName)
+		return
+	}
+	defer base.Close()
+	info, err := base.Stat()
+	if err != nil || !info.Mode().IsRegular() || fileETag(info) != r.Header.Get(constants.HeaderDeltaBase) {
+		writeError(w, r, http.StatusPreconditionFailed, constants.ErrCodeBaseChanged, "差量基准已变化: %s", fileName)
+		return
+	}
+
+	logger.LogInfo("🧩 差量接收: %s (基准 %s)", fileName, system.FormatSize(info.Size()))
+	reader := delta.NewReader(base, info.Size(), delta.BlockSize(info.Size()), r.Body)
+	handleReceive(ft, w, r, reader, fileName, deltaLength(r), false)
+	if stats := reader.Stats(); stats.Copied+stats.Literal > 0 {
+		logger.LogInfo("🧩 差量: 复用 %s，接收新数据 %s", system.FormatSize(stats.Copied), system.FormatSize(stats.Literal))
+	}
+}
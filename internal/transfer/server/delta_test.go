@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/delta"
+	"go-transfer/internal/infrastructure/logger"
+)
+
+// fetchSignature 经 handler 获取块签名
+func fetchSignature(t *testing.T, handler http.Handler, name string) (int, signature) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, constants.SignatureRoute+"?name="+name, nil))
+	var sig signature
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &sig); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+	}
+	return rec.Code, sig
+}
+
+// postDelta 以 base 为基准上传差量，摘要覆盖重建后的整个文件
+func postDelta(t *testing.T, handler http.Handler, name, base string, body []byte, content []byte) (int, uploadResponse) {
+	t.Helper()
+	sum := sha256.Sum256(content)
+	req := httptest.NewRequest(http.MethodPost, "/upload?name="+name, bytes.NewReader(body))
+	req.Header.Set("Content-Type", constants.ContentTypeDelta)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set(constants.HeaderDeltaBase, base)
+	req.Header.Set(constants.HeaderContentLength, strconv.Itoa(len(content)))
+	req.Header.Set(constants.HeaderContentDigest, "sha256="+hex.EncodeToString(sum[:]))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var resp uploadResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v: %s", err, rec.Body.String())
+	}
+	return rec.Code, resp
+}
+
+func TestDeltaUploadThroughForward(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	receiver := &FileTransfer{Mode: "receiver", StoragePath: storage}
+	next := httptest.NewServer(receiver.routes())
+	defer next.Close()
+	forward := (&FileTransfer{Mode: "forward", TargetURL: next.URL}).routes()
+
+	old := make([]byte, 300*1024)
+	rand.New(rand.NewSource(1)).Read(old)
+	os.MkdirAll(filepath.Join(storage, "img"), 0755)
+	os.WriteFile(filepath.Join(storage, "img", "disk.raw"), old, 0644)
+
+	if code, _ := fetchSignature(t, forward, "img/missing.raw"); code != http.StatusNotFound {
+		t.Fatalf("不存在的文件签名状态码 = %d", code)
+	}
+	code, remote := fetchSignature(t, forward, "img/disk.raw")
+	if code != http.StatusOK {
+		t.Fatalf("签名状态码 = %d", code)
+	}
+	sig, err := delta.Unmarshal(remote.Size, remote.BlockSize, remote.Blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 中间插入数据、改写一处并截去结尾：只有变化附近的块需要发送
+	content := append([]byte{}, old[:100*1024]...)
+	content = append(content, []byte("inserted")...)
+	content = append(content, old[100*1024:250*1024]...)
+	copy(content[200*1024:], "patched")
+	var body bytes.Buffer
+	stats, err := delta.Encode(&body, sig, bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Copied+stats.Literal != int64(len(content)) || stats.Literal > 3*int64(sig.BlockSize) {
+		t.Errorf("差量统计 = %+v (块大小 %d)", stats, sig.BlockSize)
+	}
+
+	code, resp := postDelta(t, forward, "img/disk.raw", remote.ETag, body.Bytes(), content)
+	if code != http.StatusOK || resp.Result != constants.ResultOverwritten {
+		t.Fatalf("差量上传 = %d %+v", code, resp)
+	}
+	got, _ := os.ReadFile(filepath.Join(storage, "img", "disk.raw"))
+	if !bytes.Equal(got, content) {
+		t.Fatalf("重建的文件不一致: %d bytes, 期望 %d", len(got), len(content))
+	}
+
+	// 基准已被替换，旧签名计算的差量被拒绝
+	code, resp = postDelta(t, forward, "img/disk.raw", remote.ETag, body.Bytes(), content)
+	if code != http.StatusPreconditionFailed || resp.Error == nil || resp.Error.Code != constants.ErrCodeBaseChanged {
+		t.Fatalf("基准变化后上传 = %d %+v", code, resp)
+	}
+}
+
+func TestDeltaRejectsInvalidStream(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	routes := (&FileTransfer{Mode: "receiver", StoragePath: storage}).routes()
+	os.WriteFile(filepath.Join(storage, "a.bin"), bytes.Repeat([]byte("x"), 20*1024), 0644)
+	_, remote := fetchSignature(t, routes, "a.bin")
+
+	// 复制超出基准文件范围的块
+	body := append([]byte("GTD1\x00\x00\x20\x00C"), 0, 0, 0, 0, 0, 0, 0, 9, 0, 0, 0, 1, 'E')
+	if code, _ := postDelta(t, routes, "a.bin", remote.ETag, body, make([]byte, 8192)); code < http.StatusBadRequest {
+		t.Errorf("越界的复制指令状态码 = %d", code)
+	}
+	// 块大小与签名不同的差量流（按块序号复制会取到错误的数据）
+	body = append([]byte("GTD1\x00\x00\x40\x00C"), 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 'E')
+	if code, resp := postDelta(t, routes, "a.bin", remote.ETag, body, bytes.Repeat([]byte("x"), 16384)); code < http.StatusBadRequest {
+		t.Errorf("块大小不符的差量状态码 = %d %+v", code, resp)
+	}
+	got, _ := os.ReadFile(filepath.Join(storage, "a.bin"))
+	if len(got) != 20*1024 {
+		t.Errorf("失败的差量上传不应替换原文件: %d bytes", len(got))
+	}
+}
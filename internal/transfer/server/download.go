@@ -0,0 +1,174 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+	"go-transfer/internal/infrastructure/progress"
+	"go-transfer/internal/infrastructure/system"
+)
+
+// 下载时在接收端与下一跳之间透传的请求头和响应头
+var (
+	downloadRequestHeaders  = []string{"Range", "If-Range", "If-None-Match", "If-Modified-Since"}
+	downloadResponseHeaders = []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "ETag", "Last-Modified"}
+)
+
+// handleFiles 处理 /files/{path}：DELETE 删除条目（需要写权限），其余为下载
+func (ft *FileTransfer) handleFiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		ft.withAuth(scopeWrite, ft.handleDelete)(w, r)
+		return
+	}
+	ft.withAuth(scopeRead, ft.handleDownload)(w, r)
+}
+
+// handleDownload 处理 GET/HEAD /files/{path}：接收模式读取存储目录，转发模式代理到下一跳
+func (ft *FileTransfer) handleDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "仅支持GET/HEAD/DELETE方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, constants.FilesRoute)
+	if name == "" {
+		ft.handleList(w, r)
+		return
+	}
+	if !allowPath(w, r, name) {
+		return
+	}
+
+	switch ft.Mode {
+	case "receiver":
+		ft.serveFile(w, r, name)
+	case "forward":
+		ft.proxyGet(w, r, downloadRequestHeaders, downloadResponseHeaders)
+	default:
+		http.Error(w, "未知服务模式", http.StatusInternalServerError)
+	}
+}
+
+// serveFile 从存储目录发送文件，支持 Range、ETag 和 Last-Modified 条件请求
+func (ft *FileTransfer) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	filePath, err := resolveStoragePath(ft, name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		http.Error(w, "文件不存在", http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		http.Error(w, "文件不存在", http.StatusNotFound)
+		return
+	}
+
+	// 文件被覆盖后续传请求（If-Range）会退回完整下载
+	w.Header().Set("ETag", fileETag(info))
+
+	if r.Method == http.MethodGet {
+		logger.LogInfo("⬆️  开始发送: %s (%s)", name, system.FormatSize(info.Size()))
+	}
+	pw := newProgressResponseWriter(w, "发送进度")
+	http.ServeContent(pw, r, info.Name(), info.ModTime(), file)
+	if r.Method == http.MethodGet && pw.status < http.StatusMultipleChoices {
+		pw.finish()
+		logger.LogSuccess("发送完成: %s (%s)", name, system.FormatSize(pw.written()))
+	}
+}
+
+// fileETag 以修改时间和大小构造文件的ETag
+func fileETag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+// proxyGet 将GET/HEAD请求代理到下一跳，透传指定的请求头和响应头，响应体流式返回
+func (ft *FileTransfer) proxyGet(w http.ResponseWriter, r *http.Request, requestHeaders, responseHeaders []string) {
+	req, err := http.NewRequest(r.Method, ft.TargetURL+r.URL.RequestURI(), nil)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("创建转发请求失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	copyHeaders(req.Header, r.Header, requestHeaders...)
+	ft.setUpstreamAuth(req)
+
+	client, err := ft.forwardClient()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("创建转发客户端失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.LogError("转发失败: %v", err)
+		http.Error(w, fmt.Sprintf("转发失败: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	copyHeaders(w.Header(), resp.Header, responseHeaders...)
+	pw := newProgressResponseWriter(w, "转发进度")
+	pw.WriteHeader(resp.StatusCode)
+	buffer := make([]byte, constants.LargeBufferSize)
+	if _, err := io.CopyBuffer(pw, resp.Body, buffer); err != nil {
+		logger.LogError("转发失败: %v", err)
+		return
+	}
+	if r.Method == http.MethodGet && resp.ContentLength > 0 {
+		pw.finish()
+	}
+}
+
+// progressResponseWriter 带进度跟踪的响应，写入响应头时按 Content-Length 设置总大小
+type progressResponseWriter struct {
+	http.ResponseWriter
+	progress *progress.Progress
+	status   int
+}
+
+// newProgressResponseWriter 创建带进度跟踪的响应
+func newProgressResponseWriter(w http.ResponseWriter, prefix string) *progressResponseWriter {
+	return &progressResponseWriter{
+		ResponseWriter: w,
+		progress:       progress.NewProgressWriter(w, -1, prefix),
+		status:         http.StatusOK,
+	}
+}
+
+// WriteHeader 记录状态码并设置进度总大小
+func (p *progressResponseWriter) WriteHeader(code int) {
+	p.status = code
+	if size, err := strconv.ParseInt(p.Header().Get("Content-Length"), 10, 64); err == nil {
+		p.progress.SetTotal(size)
+	}
+	p.ResponseWriter.WriteHeader(code)
+}
+
+// Write 经进度跟踪写入响应体
+func (p *progressResponseWriter) Write(b []byte) (int, error) {
+	return p.progress.Write(b)
+}
+
+// written 返回已发送的字节数
+func (p *progressResponseWriter) written() int64 {
+	current, _, _ := p.progress.GetProgress()
+	return current
+}
+
+// finish 刷新最终进度并换行
+func (p *progressResponseWriter) finish() {
+	p.progress.PrintProgress()
+	fmt.Println()
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-transfer/internal/infrastructure/logger"
+)
+
+func TestDownloadRangeAndETag(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	os.MkdirAll(filepath.Join(storage, "dir"), 0755)
+	os.WriteFile(filepath.Join(storage, "dir", "a.txt"), []byte("0123456789"), 0644)
+	ft := &FileTransfer{Mode: "receiver", StoragePath: storage}
+
+	rec := httptest.NewRecorder()
+	ft.handleDownload(rec, httptest.NewRequest(http.MethodGet, "/files/dir/a.txt", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" {
+		t.Fatalf("完整下载: 状态码 %d, 内容 %q", rec.Code, rec.Body.String())
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" || rec.Header().Get("Last-Modified") == "" {
+		t.Fatal("缺少 ETag 或 Last-Modified")
+	}
+
+	// ETag 一致时按 Range 续传
+	req := httptest.NewRequest(http.MethodGet, "/files/dir/a.txt", nil)
+	req.Header.Set("Range", "bytes=4-")
+	req.Header.Set("If-Range", etag)
+	rec = httptest.NewRecorder()
+	ft.handleDownload(rec, req)
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "456789" {
+		t.Fatalf("续传: 状态码 %d, 内容 %q", rec.Code, rec.Body.String())
+	}
+
+	// ETag 不一致时返回完整文件
+	req.Header.Set("If-Range", `"stale"`)
+	rec = httptest.NewRecorder()
+	ft.handleDownload(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" {
+		t.Fatalf("ETag 过期: 状态码 %d, 内容 %q", rec.Code, rec.Body.String())
+	}
+
+	for _, path := range []string{"/files/missing.txt", "/files/dir", "/files/dir/.a.txt.gtpart"} {
+		rec = httptest.NewRecorder()
+		ft.handleDownload(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound && rec.Code != http.StatusBadRequest {
+			t.Errorf("%s 状态码 = %d, 期望 404 或 400", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-transfer/internal/constants"
+)
+
+// handleEvents 处理 GET /transfers/{id}/events：以 SSE 推送传输进度，结束时发送 complete 或 error 事件后关闭。
+// 传输尚未开始时最多等待 EventWaitTimeout；转发节点转发下一跳的事件，使客户端看到最终接收端的确认
+func (ft *FileTransfer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	t := ft.waitTransfer(r, transferID(r))
+	if t == nil || !pathAllowed(r, t.snapshot().Name, false) {
+		http.Error(w, "传输不存在", http.StatusNotFound)
+		return
+	}
+
+	if ft.Mode == "forward" {
+		if upstream := ft.openUpstreamEvents(r, t); upstream != nil {
+			defer upstream.Body.Close()
+			startEvents(w)
+			if ft.relayEvents(w, r, t, upstream.Body) {
+				return
+			}
+			// 下一跳的事件流中断，继续推送本节点的进度
+			streamEvents(w, r, t)
+			return
+		}
+	}
+
+	startEvents(w)
+	streamEvents(w, r, t)
+}
+
+// waitTransfer 查找传输，尚未开始时等待其出现（客户端可能先订阅再上传）
+func (ft *FileTransfer) waitTransfer(r *http.Request, id string) *transfer {
+	deadline := time.Now().Add(constants.EventWaitTimeout)
+	for {
+		if t := ft.transfers.get(id); t != nil || !validUploadID(id) {
+			return t
+		}
+		if time.Now().After(deadline) {
+			return nil
+		}
+		select {
+		case <-time.After(constants.EventInterval):
+		case <-r.Context().Done():
+			return nil
+		}
+	}
+}
+
+// startEvents 写入 SSE 响应头。事件流可能超过服务器的写超时，取消本连接的写超时
+func startEvents(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+}
+
+// writeEvent 写入一个 SSE 事件并立即发送
+func writeEvent(w http.ResponseWriter, event string, info transferInfo) error {
+	data, _ := json.Marshal(info)
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	return http.NewResponseController(w).Flush()
+}
+
+// finalEvent 返回已结束传输的事件类型
+func finalEvent(info transferInfo) string {
+	if info.State == constants.TransferCompleted {
+		return constants.EventComplete
+	}
+	return constants.EventError
+}
+
+// streamEvents 按 EventInterval 推送本节点的进度，传输结束时发送最终事件
+func streamEvents(w http.ResponseWriter, r *http.Request, t *transfer) {
+	ticker := time.NewTicker(constants.EventInterval)
+	defer ticker.Stop()
+
+	for {
+		info := t.snapshot()
+		if info.State != constants.TransferRunning {
+			writeEvent(w, finalEvent(info), info)
+			return
+		}
+		if writeEvent(w, constants.EventProgress, info) != nil {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-t.done:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// openUpstreamEvents 订阅下一跳上同一传输的事件流。下一跳不支持、出错，或本节点的传输在下一跳响应前失败
+// （数据可能从未转发，下一跳会一直等待）时返回 nil
+func (ft *FileTransfer) openUpstreamEvents(r *http.Request, t *transfer) *http.Response {
+	if info := t.snapshot(); info.State != constants.TransferRunning && info.State != constants.TransferCompleted {
+		return nil
+	}
+	client, err := ft.eventsClient()
+	if err != nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ft.TargetURL+constants.TransfersRoute+"/"+t.info.ID+constants.EventsSuffix, nil)
+	if err != nil {
+		cancel()
+		return nil
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	ft.setUpstreamAuth(req)
+
+	result := make(chan *http.Response, 1)
+	go func() {
+		resp, err := client.Do(req)
+		if err != nil {
+			result <- nil
+			return
+		}
+		if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+			resp.Body.Close()
+			result <- nil
+			return
+		}
+		result <- resp
+	}()
+
+	done := t.done
+	for {
+		select {
+		case resp := <-result:
+			if resp == nil {
+				cancel()
+				return nil
+			}
+			resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+			return resp
+		case <-done:
+			if t.snapshot().State != constants.TransferCompleted {
+				cancel()
+				if resp := <-result; resp != nil {
+					resp.Body.Close()
+				}
+				return nil
+			}
+			done = nil
+		}
+	}
+}
+
+// cancelOnClose 关闭响应体时释放请求的上下文
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// relayEvents 原样转发下一跳的事件，直到收到最终事件；本节点先于下一跳失败（例如超过大小上限未转发）时发送本节点的错误事件。
+// 下一跳的事件流提前结束时返回 false
+func (ft *FileTransfer) relayEvents(w http.ResponseWriter, r *http.Request, t *transfer, upstream io.Reader) bool {
+	events := make(chan string)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(upstream)
+		var block strings.Builder
+		for scanner.Scan() {
+			line := scanner.Text()
+			block.WriteString(line + "\n")
+			if line != "" {
+				continue
+			}
+			select {
+			case events <- block.String():
+			case <-r.Context().Done():
+				return
+			}
+			block.Reset()
+		}
+	}()
+
+	done := t.done
+	for {
+		select {
+		case block, ok := <-events:
+			if !ok {
+				return false
+			}
+			if _, err := io.WriteString(w, block); err != nil {
+				return true
+			}
+			http.NewResponseController(w).Flush()
+			if event := eventType(block); event == constants.EventComplete || event == constants.EventError {
+				return true
+			}
+		case <-done:
+			// 本节点已结束：失败时下一跳可能从未收到该传输，直接发送本节点的错误事件
+			if info := t.snapshot(); info.State != constants.TransferCompleted {
+				writeEvent(w, constants.EventError, info)
+				return true
+			}
+			done = nil
+		case <-r.Context().Done():
+			return true
+		}
+	}
+}
+
+// eventType 返回 SSE 事件块的事件类型
+func eventType(block string) string {
+	for _, line := range strings.Split(block, "\n") {
+		if event, ok := strings.CutPrefix(line, "event:"); ok {
+			return strings.TrimSpace(event)
+		}
+	}
+	return ""
+}
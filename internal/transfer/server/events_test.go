@@ -0,0 +1,158 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+)
+
+// sseEvent 读取到的 SSE 事件
+type sseEvent struct {
+	name string
+	info transferInfo
+}
+
+// readEvents 读取事件流直到连接关闭
+func readEvents(t *testing.T, body io.Reader) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var current sseEvent
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			current.name = name
+		} else if data, ok := strings.CutPrefix(line, "data: "); ok {
+			if err := json.Unmarshal([]byte(data), &current.info); err != nil {
+				t.Fatalf("解析事件数据失败: %v: %s", err, data)
+			}
+		} else if line == "" && current.name != "" {
+			events = append(events, current)
+			current = sseEvent{}
+		}
+	}
+	return events
+}
+
+func TestEventsRelayedThroughForward(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	receiver := &FileTransfer{Mode: "receiver", StoragePath: t.TempDir()}
+	next := httptest.NewServer(receiver.routes())
+	defer next.Close()
+	forward := &FileTransfer{Mode: "forward", TargetURL: next.URL}
+	front := httptest.NewServer(forward.routes())
+	defer front.Close()
+
+	// 先订阅再上传：转发节点等待传输出现，再转发接收端的事件
+	subscribed := make(chan []sseEvent, 1)
+	go func() {
+		resp, err := http.Get(front.URL + constants.TransfersRoute + "/job-1" + constants.EventsSuffix)
+		if err != nil {
+			subscribed <- nil
+			return
+		}
+		defer resp.Body.Close()
+		subscribed <- readEvents(t, resp.Body)
+	}()
+
+	body, writer := io.Pipe()
+	req, _ := http.NewRequest(http.MethodPost, front.URL+"/upload?name=a.bin", body)
+	req.ContentLength = 2048
+	req.Header.Set(constants.HeaderTransferID, "job-1")
+	result := make(chan *http.Response, 1)
+	go func() {
+		resp, _ := http.DefaultClient.Do(req)
+		result <- resp
+	}()
+	writer.Write([]byte(strings.Repeat("x", 1024)))
+	time.Sleep(2 * constants.EventInterval)
+	writer.Write([]byte(strings.Repeat("x", 1024)))
+	writer.Close()
+
+	resp := <-result
+	if resp == nil || resp.StatusCode != http.StatusOK || resp.Header.Get(constants.HeaderTransferID) != "job-1" {
+		t.Fatalf("上传结果 = %+v", resp)
+	}
+	resp.Body.Close()
+
+	var events []sseEvent
+	select {
+	case events = <-subscribed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("事件流未结束")
+	}
+	if len(events) < 2 {
+		t.Fatalf("事件数 = %d, 期望至少 2", len(events))
+	}
+	for _, event := range events[:len(events)-1] {
+		if event.name != constants.EventProgress || event.info.Mode != "receiver" {
+			t.Errorf("进度事件 = %+v", event)
+		}
+	}
+	last := events[len(events)-1]
+	if last.name != constants.EventComplete || last.info.Mode != "receiver" || last.info.Bytes != 2048 ||
+		last.info.Stored != "a.bin" || !strings.HasPrefix(last.info.Digest, "sha256=") {
+		t.Errorf("完成事件 = %+v", last)
+	}
+}
+
+func TestEventsForwardFailure(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	receiver := &FileTransfer{Mode: "receiver", StoragePath: t.TempDir()}
+	next := httptest.NewServer(receiver.routes())
+	defer next.Close()
+	forward := &FileTransfer{Mode: "forward", TargetURL: next.URL, MaxFileSize: 10}
+	front := httptest.NewServer(forward.routes())
+	defer front.Close()
+
+	// 转发节点拒绝的上传不会到达接收端，事件流以本节点的错误结束
+	req, _ := http.NewRequest(http.MethodPost, front.URL+"/upload?name=big.bin", strings.NewReader(strings.Repeat("x", 100)))
+	req.Header.Set(constants.HeaderTransferID, "job-2")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	stream, err := http.Get(front.URL + constants.TransfersRoute + "/job-2" + constants.EventsSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+	events := readEvents(t, stream.Body)
+	if len(events) != 1 || events[0].name != constants.EventError || events[0].info.Error != constants.ErrCodeTooLarge {
+		t.Errorf("事件 = %+v", events)
+	}
+
+	// 无效的ID返回 404
+	if resp, err := http.Get(front.URL + constants.TransfersRoute + "/bad%20id" + constants.EventsSuffix); err == nil {
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("未知传输状态码 = %d, 期望 %d", resp.StatusCode, http.StatusNotFound)
+		}
+		resp.Body.Close()
+	}
+}
+
+func TestEventsClientSeparateFromForward(t *testing.T) {
+	ft := &FileTransfer{Mode: "forward", TargetURL: "http://127.0.0.1:1"}
+	data, err := ft.forwardClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := ft.eventsClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 事件流持续到传输结束，不受转发数据的整体超时和连接数限制
+	if events.Timeout != 0 || events.Transport == data.Transport {
+		t.Errorf("事件流客户端 Timeout = %v, 与转发共用连接池 = %v", events.Timeout, events.Transport == data.Transport)
+	}
+}
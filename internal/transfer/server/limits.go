@@ -0,0 +1,249 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+	"go-transfer/internal/infrastructure/system"
+)
+
+// limitError 超过单文件大小上限（413）或存储空间不足（507）
+type limitError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *limitError) Error() string {
+	return e.message
+}
+
+// errTooLarge 文件超过大小上限
+func errTooLarge(size, max int64) error {
+	return &limitError{
+		status:  http.StatusRequestEntityTooLarge,
+		code:    constants.ErrCodeTooLarge,
+		message: fmt.Sprintf("文件大小 %s 超过上限 %s", system.FormatSize(size), system.FormatSize(max)),
+	}
+}
+
+// errNoSpace 超出存储配额或磁盘剩余空间不足
+func errNoSpace(format string, v ...interface{}) error {
+	return &limitError{
+		status:  http.StatusInsufficientStorage,
+		code:    constants.ErrCodeInsufficientStorage,
+		message: fmt.Sprintf(format, v...),
+	}
+}
+
+// respondLimit err 为 limitError 时返回对应状态码并返回 true
+func respondLimit(w http.ResponseWriter, r *http.Request, fileName string, err error) bool {
+	var le *limitError
+	if !errors.As(err, &le) {
+		return false
+	}
+	logger.LogWarn("拒绝上传: %s (%s)", fileName, le.message)
+	writeError(w, r, le.status, le.code, "%s", le.message)
+	return true
+}
+
+// spaceTracker 跟踪存储目录的占用和进行中上传预留的空间
+type spaceTracker struct {
+	mu        sync.Mutex
+	used      int64 // 最近一次统计的占用（不含进行中上传已写入的部分），加上此后完成的上传
+	scannedAt time.Time
+	scanning  bool  // 正在重新统计（不持有锁）
+	reserved  int64 // 进行中的上传预留的字节数
+	written   int64 // 预留中已写入磁盘的字节数（已反映在磁盘剩余空间中）
+	staged    int64 // 进行中上传的暂存文件大小（统计占用时已计入预留，需扣除）
+}
+
+// refreshUsage 定期重新统计存储目录的占用（含暂存文件和版本文件）。
+// 遍历目录时不持有锁，避免阻塞进行中上传的写入记录
+func (ft *FileTransfer) refreshUsage() {
+	ft.space.mu.Lock()
+	if ft.Quota <= 0 || ft.space.scanning || time.Since(ft.space.scannedAt) < constants.SpaceScanInterval {
+		ft.space.mu.Unlock()
+		return
+	}
+	ft.space.scanning = true
+	ft.space.mu.Unlock()
+
+	var used int64
+	filepath.Walk(system.ExpandPath(ft.StoragePath), func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			used += info.Size()
+		}
+		return nil
+	})
+
+	// 进行中上传的暂存文件计入其预留，不重复计入占用
+	ft.space.mu.Lock()
+	used -= ft.space.staged
+	if used < 0 {
+		used = 0
+	}
+	ft.space.used = used
+	ft.space.scannedAt = time.Now()
+	ft.space.scanning = false
+	ft.space.mu.Unlock()
+}
+
+// checkSpaceLocked 检查能否再写入 n 字节（配额和磁盘保留空间），调用方需持有锁
+func (ft *FileTransfer) checkSpaceLocked(n int64) error {
+	if ft.Quota > 0 {
+		used := ft.space.used + ft.space.reserved
+		if used+n > ft.Quota {
+			return errNoSpace("超出存储配额: 已用 %s / %s，本次需要 %s",
+				system.FormatSize(used), system.FormatSize(ft.Quota), system.FormatSize(n))
+		}
+	}
+
+	// 进行中的上传尚未写入的预留部分也会占用磁盘，无法查询剩余空间的平台跳过检查
+	free, err := system.DiskFree(system.ExpandPath(ft.StoragePath))
+	pending := ft.space.reserved - ft.space.written
+	if pending < 0 {
+		pending = 0
+	}
+	if err == nil && free-pending-n < ft.DiskReserve {
+		return errNoSpace("磁盘空间不足: 剩余 %s（进行中的上传还需 %s），本次需要 %s，需保留 %s",
+			system.FormatSize(free), system.FormatSize(pending), system.FormatSize(n), system.FormatSize(ft.DiskReserve))
+	}
+	return nil
+}
+
+// reservation 已接纳的上传预留的空间，结束后须调用 release
+type reservation struct {
+	ft     *FileTransfer
+	bytes  int64 // 已预留的字节数
+	used   int64 // 实际写入的字节数
+	staged int64 // 暂存文件的大小（分块上传预先扩展到文件总大小）
+}
+
+// admitUpload 接收数据前检查大小上限、配额和磁盘剩余空间。
+// total 为文件总大小，incoming 为本次将写入的字节数，未知时为 -1
+func (ft *FileTransfer) admitUpload(total, incoming int64) (*reservation, error) {
+	if ft.MaxFileSize > 0 && total > ft.MaxFileSize {
+		return nil, errTooLarge(total, ft.MaxFileSize)
+	}
+	if incoming < 0 {
+		incoming = 0
+	}
+	res := &reservation{ft: ft}
+	if err := res.grow(incoming); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// grow 追加预留 n 字节
+func (res *reservation) grow(n int64) error {
+	ft := res.ft
+	ft.refreshUsage()
+	ft.space.mu.Lock()
+	defer ft.space.mu.Unlock()
+	if err := ft.checkSpaceLocked(n); err != nil {
+		return err
+	}
+	ft.space.reserved += n
+	res.bytes += n
+	return nil
+}
+
+// wrote 记录已写入的 n 字节（多个分块可能并发写入同一预留）
+func (res *reservation) wrote(n int64) {
+	if res == nil {
+		return
+	}
+	ft := res.ft
+	ft.space.mu.Lock()
+	res.used += n
+	ft.space.written += n
+	res.stageLocked(res.used)
+	ft.space.mu.Unlock()
+}
+
+// allocate 记录暂存文件已预先扩展到 size 字节
+func (res *reservation) allocate(size int64) {
+	if res == nil {
+		return
+	}
+	res.ft.space.mu.Lock()
+	res.stageLocked(size)
+	res.ft.space.mu.Unlock()
+}
+
+// stageLocked 暂存文件增长到 size 字节时更新统计，调用方需持有锁
+func (res *reservation) stageLocked(size int64) {
+	if size > res.staged {
+		res.ft.space.staged += size - res.staged
+		res.staged = size
+	}
+}
+
+// release 释放预留，已写入的数据计入占用（下次统计时校正）
+func (res *reservation) release() {
+	res.finish(true)
+}
+
+// cancel 释放预留，已写入的数据随暂存文件删除，不计入占用
+func (res *reservation) cancel() {
+	res.finish(false)
+}
+
+// finish 释放预留，keep 表示写入的数据保留在存储目录中
+func (res *reservation) finish(keep bool) {
+	if res == nil {
+		return
+	}
+	ft := res.ft
+	ft.space.mu.Lock()
+	ft.space.reserved -= res.bytes
+	ft.space.written -= res.used
+	ft.space.staged -= res.staged
+	if keep {
+		ft.space.used += res.used
+	}
+	ft.space.mu.Unlock()
+	res.bytes, res.used, res.staged = 0, 0, 0
+}
+
+// guardReader 传输中按实际数据量检查大小上限（对未声明或谎报长度的上传生效），并按需追加预留空间
+type guardReader struct {
+	reader io.Reader
+	max    int64        // 单文件大小上限，0 表示不限制
+	offset int64        // 续传时已提交的字节数（计入大小上限）
+	res    *reservation // 为 nil 时不检查存储空间（转发模式）
+}
+
+// Read 实现 io.Reader 接口
+func (g *guardReader) Read(b []byte) (int, error) {
+	n, err := g.reader.Read(b)
+	if n == 0 {
+		return n, err
+	}
+	g.offset += int64(n)
+	if g.max > 0 && g.offset > g.max {
+		return n, errTooLarge(g.offset, g.max)
+	}
+	if g.res != nil {
+		g.res.wrote(int64(n))
+		if need := g.res.used - g.res.bytes; need > 0 {
+			// 按步长预留，空间不足一个步长时只预留实际需要的部分
+			if g.res.grow(need+constants.SpaceReserveStep) != nil {
+				if gerr := g.res.grow(need); gerr != nil {
+					return n, gerr
+				}
+			}
+		}
+	}
+	return n, err
+}
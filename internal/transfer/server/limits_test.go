@@ -0,0 +1,130 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-transfer/internal/infrastructure/logger"
+	"go-transfer/internal/infrastructure/system"
+)
+
+func TestUploadLimits(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	ft := &FileTransfer{Mode: "receiver", StoragePath: storage, MaxFileSize: 100, Quota: 150}
+
+	// 声明的长度超过上限时不接收数据
+	if rec := upload(ft, "big.bin", strings.Repeat("x", 101), ""); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("超过上限状态码 = %d, 期望 %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	// 未声明长度时在传输中检查，并清理暂存文件
+	req := httptest.NewRequest(http.MethodPost, "/upload?name=stream.bin", strings.NewReader(strings.Repeat("x", 101)))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.ContentLength = -1
+	rec := httptest.NewRecorder()
+	StreamUploadHandler(ft)(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("未声明长度状态码 = %d, 期望 %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+	if _, err := os.Stat(stagingPath(filepath.Join(storage, "stream.bin"))); !os.IsNotExist(err) {
+		t.Errorf("暂存文件未清理: %v", err)
+	}
+
+	// 配额内的上传成功，超出配额的返回 507
+	if rec := upload(ft, "a.bin", strings.Repeat("x", 100), ""); rec.Code != http.StatusOK {
+		t.Fatalf("配额内上传状态码 = %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := upload(ft, "b.bin", strings.Repeat("x", 60), ""); rec.Code != http.StatusInsufficientStorage {
+		t.Errorf("超出配额状态码 = %d, 期望 %d", rec.Code, http.StatusInsufficientStorage)
+	}
+	if rec := upload(ft, "c.bin", strings.Repeat("x", 50), ""); rec.Code != http.StatusOK {
+		t.Errorf("剩余配额内上传状态码 = %d: %s", rec.Code, rec.Body.String())
+	}
+	if entries, _ := os.ReadDir(storage); len(entries) != 2 {
+		t.Errorf("存储目录文件数 = %d, 期望 2", len(entries))
+	}
+}
+
+func TestChunkReservationReleased(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	ft := &FileTransfer{Mode: "receiver", StoragePath: storage, Quota: 1500}
+	data := []byte(strings.Repeat("x", 1000))
+
+	// 未完成的分块上传为整个文件预留空间
+	if rec := sendChunk(ft, "big.bin", "id1", "", data, 0, 499); rec.Code != http.StatusAccepted {
+		t.Fatalf("分块状态码 = %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := upload(ft, "b.bin", strings.Repeat("x", 600), ""); rec.Code != http.StatusInsufficientStorage {
+		t.Errorf("预留后超出配额状态码 = %d, 期望 %d", rec.Code, http.StatusInsufficientStorage)
+	}
+
+	// 同名文件重新上传时放弃分块上传，其预留立即释放而不是等到重新统计
+	if rec := upload(ft, "big.bin", strings.Repeat("x", 100), ""); rec.Code != http.StatusOK {
+		t.Fatalf("覆盖上传状态码 = %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := upload(ft, "b.bin", strings.Repeat("x", 600), ""); rec.Code != http.StatusOK {
+		t.Errorf("释放预留后上传状态码 = %d: %s", rec.Code, rec.Body.String())
+	}
+	if ft.space.reserved != 0 || ft.space.written != 0 {
+		t.Errorf("上传结束后仍有预留: %d / 已写入 %d", ft.space.reserved, ft.space.written)
+	}
+}
+
+func TestQuotaRescanDuringUpload(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	ft := &FileTransfer{Mode: "receiver", StoragePath: storage, Quota: 1100}
+	data := []byte(strings.Repeat("x", 500))
+
+	// 重新统计时分块上传的暂存文件已计入其预留，不重复计入占用
+	if rec := sendChunk(ft, "big.bin", "id1", "", data, 0, 249); rec.Code != http.StatusAccepted {
+		t.Fatalf("分块状态码 = %d: %s", rec.Code, rec.Body.String())
+	}
+	ft.space.scannedAt = time.Time{}
+	if rec := upload(ft, "a.bin", strings.Repeat("x", 500), ""); rec.Code != http.StatusOK {
+		t.Fatalf("配额内上传状态码 = %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := sendChunk(ft, "big.bin", "id1", "", data, 250, 499); rec.Code != http.StatusOK {
+		t.Fatalf("最后一个分块状态码 = %d: %s", rec.Code, rec.Body.String())
+	}
+	if ft.space.reserved != 0 || ft.space.staged != 0 {
+		t.Errorf("上传结束后预留 = %d，暂存 %d", ft.space.reserved, ft.space.staged)
+	}
+	ft.space.scannedAt = time.Time{}
+	ft.refreshUsage()
+	if ft.space.used != 1000 {
+		t.Errorf("重新统计的占用 = %d, 期望 1000", ft.space.used)
+	}
+	if rec := upload(ft, "b.bin", strings.Repeat("x", 200), ""); rec.Code != http.StatusInsufficientStorage {
+		t.Errorf("配额用尽后状态码 = %d, 期望 %d", rec.Code, http.StatusInsufficientStorage)
+	}
+}
+
+func TestDiskReserveCountsPending(t *testing.T) {
+	storage := t.TempDir()
+	free, err := system.DiskFree(storage)
+	if err != nil {
+		t.Skipf("无法查询剩余空间: %v", err)
+	}
+	ft := &FileTransfer{Mode: "receiver", StoragePath: storage}
+
+	// 进行中的上传尚未写入的部分已占满剩余空间
+	ft.space.reserved = free
+	if _, err := ft.admitUpload(1, 1); err == nil {
+		t.Error("预留占满剩余空间时应拒绝上传")
+	}
+	// 已写入的部分反映在剩余空间中，不重复扣除
+	ft.space.written = free
+	res, err := ft.admitUpload(1, 1)
+	if err != nil {
+		t.Fatalf("预留已全部写入时上传被拒绝: %v", err)
+	}
+	res.cancel()
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/system"
+)
+
+// fileEntry 目录列表中的一项
+type fileEntry struct {
+	Name       string    `json:"name"`                  // 相对存储目录的路径，目录以 / 结尾
+	Type       string    `json:"type"`                  // file 或 dir
+	Size       int64     `json:"size"`                  // 文件大小，仅有暂存文件时为暂存文件大小
+	ModTime    time.Time `json:"mtime"`                 // 修改时间
+	Digest     string    `json:"digest,omitempty"`      // 接收时计算的摘要（已知时）
+	InProgress bool      `json:"in_progress,omitempty"` // 是否有未完成的上传
+}
+
+// fileListing GET /files 的响应
+type fileListing struct {
+	Prefix     string      `json:"prefix"`
+	Recursive  bool        `json:"recursive"`
+	Entries    []fileEntry `json:"entries"`
+	NextCursor string      `json:"next_cursor,omitempty"` // 存在更多结果时，作为下一页的 cursor 参数
+}
+
+// digestRecord 已接收文件的摘要，大小或修改时间变化后失效
+type digestRecord struct {
+	size    int64
+	modTime time.Time
+	digest  string
+}
+
+// rememberDigest 记录文件落盘后的摘要，供列表接口返回
+func (ft *FileTransfer) rememberDigest(finalPath, sum string) {
+	info, err := os.Stat(finalPath)
+	if err != nil {
+		return
+	}
+	ft.digests.Store(finalPath, digestRecord{size: info.Size(), modTime: info.ModTime(), digest: sum})
+}
+
+// knownDigest 返回文件仍然有效的摘要
+func (ft *FileTransfer) knownDigest(finalPath string, info os.FileInfo) string {
+	value, ok := ft.digests.Load(finalPath)
+	if !ok {
+		return ""
+	}
+	record := value.(digestRecord)
+	if record.size != info.Size() || !record.modTime.Equal(info.ModTime()) {
+		return ""
+	}
+	return record.digest
+}
+
+// handleList 处理 GET /files?prefix=&recursive=&limit=&cursor=：接收模式列出存储目录，转发模式代理到下一跳。
+// prefix 按路径前缀匹配（"dir/" 列出目录内容，"dir/a" 列出 dir 下以 a 开头的条目），
+// 非递归模式只列出直接子项，子目录以 / 结尾的目录项表示
+func (ft *FileTransfer) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "仅支持GET方法", http.StatusMethodNotAllowed)
+		return
+	}
+	if ft.Mode == "forward" {
+		ft.proxyGet(w, r, nil, []string{"Content-Type"})
+		return
+	}
+	if ft.Mode != "receiver" {
+		http.Error(w, "未知服务模式", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	prefix := strings.TrimLeft(strings.ReplaceAll(query.Get("prefix"), `\`, "/"), "/")
+	recursive, _ := strconv.ParseBool(query.Get("recursive"))
+	cursor := query.Get("cursor")
+	limit := constants.DefaultListLimit
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit 参数无效", http.StatusBadRequest)
+			return
+		}
+		if n > constants.MaxListLimit {
+			n = constants.MaxListLimit
+		}
+		limit = n
+	}
+
+	// prefix 中最后一个 / 之前的部分为需要遍历的目录
+	root := system.ExpandPath(ft.StoragePath)
+	baseDir := root
+	if dir := path.Dir(prefix); dir != "." && dir != "/" {
+		joined, err := safeJoin(root, dir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		baseDir = joined
+	}
+
+	entries, err := ft.collectEntries(r, root, baseDir, prefix, recursive)
+	if err != nil && !os.IsNotExist(err) {
+		http.Error(w, "读取目录失败: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	start := sort.Search(len(entries), func(i int) bool { return entries[i].Name > cursor })
+	listing := fileListing{Prefix: prefix, Recursive: recursive, Entries: entries[start:]}
+	if len(listing.Entries) > limit {
+		listing.Entries = listing.Entries[:limit]
+		listing.NextCursor = listing.Entries[limit-1].Name
+	}
+	if listing.Entries == nil {
+		listing.Entries = []fileEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(listing)
+}
+
+// collectEntries 遍历 baseDir，收集名称以 prefix 开头且令牌允许访问的条目
+func (ft *FileTransfer) collectEntries(r *http.Request, root, baseDir, prefix string, recursive bool) ([]fileEntry, error) {
+	files := make(map[string]*fileEntry)
+	var dirs []fileEntry
+
+	add := func(fullPath string, info os.FileInfo) {
+		rel, err := filepath.Rel(root, fullPath)
+		if err != nil {
+			return
+		}
+		rel = filepath.ToSlash(rel)
+
+		// 未完成的上传以最终文件名展示
+		inProgress := false
+		if isStagingFile(info.Name()) {
+			if !strings.HasSuffix(info.Name(), constants.PartialSuffix) {
+				return
+			}
+			base := strings.TrimSuffix(strings.TrimPrefix(info.Name(), "."), constants.PartialSuffix)
+			rel = path.Join(path.Dir(rel), base)
+			inProgress = true
+		}
+		if !strings.HasPrefix(rel, prefix) || !pathAllowed(r, rel, false) {
+			return
+		}
+
+		entry := files[rel]
+		if entry == nil {
+			entry = &fileEntry{Name: rel, Type: "file"}
+			files[rel] = entry
+		}
+		if inProgress {
+			entry.InProgress = true
+			if entry.ModTime.IsZero() {
+				entry.Size, entry.ModTime = info.Size(), info.ModTime()
+			}
+			return
+		}
+		entry.Size, entry.ModTime = info.Size(), info.ModTime()
+		entry.Digest = ft.knownDigest(fullPath, info)
+	}
+
+	err := filepath.Walk(baseDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if p == baseDir {
+				return err
+			}
+			return nil
+		}
+		if info.IsDir() {
+			if p == baseDir {
+				return nil
+			}
+			rel, _ := filepath.Rel(root, p)
+			rel = filepath.ToSlash(rel)
+			if isReservedDir(rel) {
+				return filepath.SkipDir
+			}
+			rel += "/"
+			if !recursive {
+				// 只需要 baseDir 下的直接子目录
+				if strings.HasPrefix(rel, prefix) && pathAllowed(r, rel, true) {
+					dirs = append(dirs, fileEntry{Name: rel, Type: "dir", ModTime: info.ModTime()})
+				}
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		add(p, info)
+		return nil
+	})
+
+	entries := dirs
+	for _, entry := range files {
+		entries = append(entries, *entry)
+	}
+	return entries, err
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go-transfer/internal/infrastructure/logger"
+)
+
+// listEntries 调用列表接口并返回条目和下一页游标
+func listEntries(t *testing.T, ft *FileTransfer, query string) ([]fileEntry, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	ft.handleList(rec, httptest.NewRequest(http.MethodGet, "/files?"+query, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s 状态码 = %d: %s", query, rec.Code, rec.Body.String())
+	}
+	var listing fileListing
+	if err := json.Unmarshal(rec.Body.Bytes(), &listing); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	return listing.Entries, listing.NextCursor
+}
+
+func names(entries []fileEntry) []string {
+	result := make([]string, len(entries))
+	for i, entry := range entries {
+		result[i] = entry.Name
+	}
+	return result
+}
+
+func TestListFiles(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	for _, name := range []string{"a.txt", "dir/b.txt", "dir/c.txt", "dir/sub/d.txt", ".gtquarantine/x.txt"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(storage, name)), 0755)
+		os.WriteFile(filepath.Join(storage, name), []byte("data"), 0644)
+	}
+	os.WriteFile(filepath.Join(storage, "dir", ".e.txt.gtpart"), []byte("da"), 0644)
+	ft := &FileTransfer{Mode: "receiver", StoragePath: storage}
+
+	entries, _ := listEntries(t, ft, "")
+	if got, want := names(entries), []string{"a.txt", "dir/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("根目录 = %v, 期望 %v", got, want)
+	}
+
+	entries, _ = listEntries(t, ft, "prefix=dir/")
+	if got, want := names(entries), []string{"dir/b.txt", "dir/c.txt", "dir/e.txt", "dir/sub/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dir/ = %v, 期望 %v", got, want)
+	}
+	if !entries[2].InProgress || entries[2].Size != 2 {
+		t.Errorf("暂存文件应显示为上传中: %+v", entries[2])
+	}
+
+	entries, _ = listEntries(t, ft, "prefix=dir/&recursive=true")
+	if got, want := names(entries), []string{"dir/b.txt", "dir/c.txt", "dir/e.txt", "dir/sub/d.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("递归 dir/ = %v, 期望 %v", got, want)
+	}
+
+	rec := httptest.NewRecorder()
+	ft.handleList(rec, httptest.NewRequest(http.MethodGet, "/files?prefix=.gtquarantine/", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("列出隔离目录的状态码 = %d", rec.Code)
+	}
+
+	// 分页
+	entries, cursor := listEntries(t, ft, "recursive=true&limit=2")
+	if got, want := names(entries), []string{"a.txt", "dir/b.txt"}; !reflect.DeepEqual(got, want) || cursor != "dir/b.txt" {
+		t.Fatalf("第一页 = %v (cursor %q)", got, cursor)
+	}
+	entries, cursor = listEntries(t, ft, "recursive=true&limit=3&cursor="+cursor)
+	if got, want := names(entries), []string{"dir/c.txt", "dir/e.txt", "dir/sub/d.txt"}; !reflect.DeepEqual(got, want) || cursor != "" {
+		t.Fatalf("第二页 = %v (cursor %q)", got, cursor)
+	}
+}
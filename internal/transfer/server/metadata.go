@@ -0,0 +1,253 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+	"go-transfer/internal/infrastructure/system"
+)
+
+// fileMeta 客户端随上传发送的权限和修改时间
+type fileMeta struct {
+	mode    os.FileMode // 权限位，hasMode 为 false 时不设置
+	hasMode bool
+	modTime time.Time // 修改时间，零值时不设置
+}
+
+// fileMeta 解析 X-File-Mode 和 X-File-Mtime 请求头，接收端忽略元数据时返回空值
+func (ft *FileTransfer) fileMeta(r *http.Request) (fileMeta, error) {
+	var meta fileMeta
+	if ft.IgnoreMetadata {
+		return meta, nil
+	}
+	if value := r.Header.Get(constants.HeaderFileMode); value != "" {
+		mode, err := strconv.ParseUint(value, 8, 32)
+		if err != nil {
+			return meta, fmt.Errorf("%s 无效: %q", constants.HeaderFileMode, value)
+		}
+		// 只保留读写执行权限，不接受 setuid 等特殊权限位
+		meta.mode = os.FileMode(mode) & os.ModePerm
+		meta.hasMode = true
+	}
+	if value := r.Header.Get(constants.HeaderFileMtime); value != "" {
+		modTime, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return meta, fmt.Errorf("%s 无效: %q", constants.HeaderFileMtime, value)
+		}
+		meta.modTime = modTime
+	}
+	return meta, nil
+}
+
+// apply 设置权限和修改时间。文件在提交前对暂存文件设置（重命名不改变二者）；
+// 目录始终保留属主的读写执行权限，以便服务继续管理其中的文件
+func (m fileMeta) apply(path string, dir bool) {
+	if m.hasMode {
+		mode := m.mode
+		if dir {
+			mode |= 0700
+		}
+		os.Chmod(path, mode)
+	}
+	if !m.modTime.IsZero() {
+		os.Chtimes(path, m.modTime, m.modTime)
+	}
+}
+
+// handleEntryUpload 处理目录和符号链接条目（X-Entry-Type，请求体为空）：
+// 接收模式创建条目，转发模式原样转发
+func handleEntryUpload(ft *FileTransfer, w http.ResponseWriter, r *http.Request) {
+	fileName := r.URL.Query().Get("name")
+	if fileName == "" {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "条目上传需要 name 参数")
+		return
+	}
+
+	switch ft.Mode {
+	case "receiver":
+		ft.receiveEntry(w, r, fileName)
+	case "forward":
+		handleForward(ft, w, r, r.Body, fileName, 0, false)
+	default:
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "未知服务模式")
+	}
+}
+
+// receiveEntry 创建目录或符号链接条目
+func (ft *FileTransfer) receiveEntry(w http.ResponseWriter, r *http.Request, fileName string) {
+	finalPath, err := resolveStoragePath(ft, fileName)
+	if err != nil {
+		logger.LogWarn("拒绝上传: %v", err)
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeInvalidPath, "%v", err)
+		return
+	}
+	if !allowPath(w, r, fileName) {
+		return
+	}
+	meta, err := ft.fileMeta(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "%v", err)
+		return
+	}
+
+	switch entryType := r.Header.Get(constants.HeaderEntryType); entryType {
+	case constants.EntryDir:
+		ft.receiveDir(w, r, fileName, finalPath, meta)
+	case constants.EntrySymlink:
+		ft.receiveSymlink(w, r, fileName, finalPath)
+	default:
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "不支持的条目类型: %s", entryType)
+	}
+}
+
+// receiveDir 创建目录（已存在时合并）并设置权限和修改时间。
+// 客户端在目录中的文件都上传之后再发送目录条目，修改时间才不会被随后的写入改变
+func (ft *FileTransfer) receiveDir(w http.ResponseWriter, r *http.Request, fileName, finalPath string, meta fileMeta) {
+	info, err := os.Lstat(finalPath)
+	if err == nil && !info.IsDir() && info.Mode()&os.ModeSymlink == 0 {
+		respondExists(w, r, fileName)
+		return
+	}
+	created := os.IsNotExist(err)
+	if err := ensureDir(system.ExpandPath(ft.StoragePath), finalPath); err != nil {
+		respondPathError(w, r, "创建目录失败", err)
+		return
+	}
+	meta.apply(finalPath, true)
+
+	resp := &uploadResponse{Status: constants.UploadStatusOK, Name: fileName}
+	resp.Stored = ft.setStoreResult(w, finalPath, constants.ResultCreated)
+	if created {
+		logger.LogInfo("📁 已创建目录: %s", resp.Stored)
+		resp.Result = constants.ResultCreated
+		resp.Message = fmt.Sprintf("目录已创建: %s", resp.Stored)
+	} else {
+		w.Header().Del(constants.HeaderConflictResult)
+		resp.Message = fmt.Sprintf("目录已存在: %s", resp.Stored)
+	}
+	resp.setTiming(requestStart(r), 0)
+	ft.writeUpload(w, r, http.StatusOK, resp)
+}
+
+// receiveSymlink 创建符号链接。链接须位于上传的目录中，目标须解析到该目录（名称的顶层目录）之内
+// 且在令牌允许的路径范围内，否则不创建并告知客户端。链接不另存、不保留旧版本，rename 和 version 策略下按覆盖处理
+func (ft *FileTransfer) receiveSymlink(w http.ResponseWriter, r *http.Request, fileName, finalPath string) {
+	if ft.IgnoreMetadata {
+		ft.respondIgnored(w, r, fileName, "接收端忽略元数据，不创建符号链接")
+		return
+	}
+	target, err := url.PathUnescape(r.Header.Get(constants.HeaderLinkTarget))
+	if err != nil || target == "" {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "%s 无效", constants.HeaderLinkTarget)
+		return
+	}
+	policy, err := ft.conflictPolicy(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "%v", err)
+		return
+	}
+
+	clean, _ := sanitizeFileName(fileName)
+	top, _, nested := strings.Cut(clean, "/")
+	if !nested {
+		ft.respondIgnored(w, r, fileName, "符号链接须位于上传的目录中")
+		return
+	}
+	root := system.ExpandPath(ft.StoragePath)
+	if err := ensureDir(root, filepath.Dir(finalPath)); err != nil {
+		respondPathError(w, r, "创建目录失败", err)
+		return
+	}
+	if err := checkLink(r, root, filepath.Join(root, top), finalPath, target); err != nil {
+		ft.respondIgnored(w, r, fileName, err.Error())
+		return
+	}
+
+	result := constants.ResultCreated
+	if info, err := os.Lstat(finalPath); err == nil {
+		if info.IsDir() {
+			respondExists(w, r, fileName)
+			return
+		}
+		switch policy {
+		case constants.ConflictSkip:
+			ft.respondSkipped(w, r, fileName)
+			return
+		case constants.ConflictFail:
+			respondExists(w, r, fileName)
+			return
+		}
+		if err := os.Remove(finalPath); err != nil {
+			writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "替换同名文件失败: %v", err)
+			return
+		}
+		result = constants.ResultOverwritten
+	}
+	if err := os.Symlink(target, finalPath); err != nil {
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "创建符号链接失败: %v", err)
+		return
+	}
+
+	stored := ft.setStoreResult(w, finalPath, result)
+	logger.LogInfo("🔗 已创建符号链接: %s → %s", stored, target)
+	resp := &uploadResponse{
+		Status:  constants.UploadStatusOK,
+		Name:    fileName,
+		Stored:  stored,
+		Result:  result,
+		Message: fmt.Sprintf("符号链接已创建: %s → %s (%s)", stored, target, result),
+	}
+	resp.setTiming(requestStart(r), 0)
+	ft.writeUpload(w, r, http.StatusOK, resp)
+}
+
+// checkLink 校验符号链接目标：须解析到目录树 tree 之内，且解析后的路径在令牌允许的范围内
+func checkLink(r *http.Request, root, tree, linkPath, target string) error {
+	if err := safeLinkTarget(tree, linkPath, target); err != nil {
+		return err
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	realDir, err := filepath.EvalSymlinks(filepath.Dir(linkPath))
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(realRoot, filepath.Join(realDir, filepath.FromSlash(target)))
+	if err != nil || !pathAllowed(r, filepath.ToSlash(rel), false) {
+		return fmt.Errorf("链接指向令牌允许的范围之外 %q", target)
+	}
+	return nil
+}
+
+// respondIgnored 告知客户端条目未创建及原因
+func (ft *FileTransfer) respondIgnored(w http.ResponseWriter, r *http.Request, fileName, reason string) {
+	logger.LogWarn("未创建: %s (%s)", fileName, reason)
+	w.Header().Set(constants.HeaderConflictResult, constants.ResultIgnored)
+	ft.writeUpload(w, r, http.StatusOK, &uploadResponse{
+		Status:  constants.UploadStatusSkipped,
+		Name:    fileName,
+		Result:  constants.ResultIgnored,
+		Message: fmt.Sprintf("条目未创建: %s (%s)", fileName, reason),
+	})
+}
+
+// respondPathError 创建目录失败：经过不安全的链接时返回 400，否则返回 500
+func respondPathError(w http.ResponseWriter, r *http.Request, action string, err error) {
+	if errors.Is(err, errUnsafePath) {
+		logger.LogWarn("拒绝上传: %v", err)
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeInvalidPath, "%v", err)
+		return
+	}
+	writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "%s: %v", action, err)
+}
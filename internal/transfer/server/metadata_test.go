@@ -0,0 +1,99 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+)
+
+func TestMetadataThroughForward(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	receiver := &FileTransfer{Mode: "receiver", StoragePath: storage}
+	next := httptest.NewServer(receiver.routes())
+	defer next.Close()
+	forward := StreamUploadHandler(&FileTransfer{Mode: "forward", TargetURL: next.URL})
+
+	mtime := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	meta := map[string]string{
+		constants.HeaderFileMode:  "0600",
+		constants.HeaderFileMtime: mtime.Format(time.RFC3339Nano),
+	}
+	if code, resp := postJSON(t, forward, "proj/a.txt", strings.NewReader("hello"), meta); code != http.StatusOK {
+		t.Fatalf("上传文件 = %d %+v", code, resp)
+	}
+	info, err := os.Stat(filepath.Join(storage, "proj", "a.txt"))
+	if err != nil || info.Mode().Perm() != 0600 || !info.ModTime().Equal(mtime) {
+		t.Errorf("文件元数据 = %v %v", info, err)
+	}
+
+	// 空目录
+	meta[constants.HeaderEntryType] = constants.EntryDir
+	meta[constants.HeaderFileMode] = "0750"
+	if code, resp := postJSON(t, forward, "proj/empty", strings.NewReader(""), meta); code != http.StatusOK || resp.Result != constants.ResultCreated {
+		t.Errorf("创建目录 = %d %+v", code, resp)
+	}
+	if info, err := os.Stat(filepath.Join(storage, "proj", "empty")); err != nil || !info.IsDir() || info.Mode().Perm() != 0750 || !info.ModTime().Equal(mtime) {
+		t.Errorf("目录元数据 = %v %v", info, err)
+	}
+
+	// 符号链接：目录树内的创建，指向目录树外或不在目录中的不创建
+	link := func(name, target string) uploadResponse {
+		_, resp := postJSON(t, forward, name, strings.NewReader(""), map[string]string{
+			constants.HeaderEntryType:  constants.EntrySymlink,
+			constants.HeaderLinkTarget: url.PathEscape(target),
+		})
+		return resp
+	}
+	if resp := link("proj/sub/latest", "../a.txt"); resp.Status != constants.UploadStatusOK {
+		t.Errorf("目录树内的链接 = %+v", resp)
+	}
+	if target, err := os.Readlink(filepath.Join(storage, "proj", "sub", "latest")); err != nil || target != "../a.txt" {
+		t.Errorf("符号链接 = %q %v", target, err)
+	}
+	for name, target := range map[string]string{"proj/up": "..", "proj/etc": "/etc/passwd", "proj/mid": "sub/../../x", "top": "proj"} {
+		if resp := link(name, target); resp.Result != constants.ResultIgnored {
+			t.Errorf("链接 %s → %s = %+v", name, target, resp)
+		}
+		if _, err := os.Lstat(filepath.Join(storage, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Errorf("链接 %s 不应创建: %v", name, err)
+		}
+	}
+}
+
+func TestIgnoreMetadata(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	ft := &FileTransfer{Mode: "receiver", StoragePath: storage}
+
+	if code, _ := postJSON(t, StreamUploadHandler(ft), "a.txt", strings.NewReader("x"), map[string]string{constants.HeaderFileMode: "rwx"}); code != http.StatusBadRequest {
+		t.Errorf("无效权限状态码 = %d, 期望 %d", code, http.StatusBadRequest)
+	}
+
+	ft.IgnoreMetadata = true
+	mtime := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	postJSON(t, StreamUploadHandler(ft), "dir/a.txt", strings.NewReader("x"), map[string]string{
+		constants.HeaderFileMode:  "0777",
+		constants.HeaderFileMtime: mtime.Format(time.RFC3339Nano),
+	})
+	info, err := os.Stat(filepath.Join(storage, "dir", "a.txt"))
+	if err != nil || info.Mode().Perm()&0022 != 0 || info.ModTime().Equal(mtime) {
+		t.Errorf("忽略元数据时的文件 = %v %v", info, err)
+	}
+
+	_, resp := postJSON(t, StreamUploadHandler(ft), "dir/link", strings.NewReader(""), map[string]string{
+		constants.HeaderEntryType:  constants.EntrySymlink,
+		constants.HeaderLinkTarget: "a.txt",
+	})
+	if resp.Result != constants.ResultIgnored {
+		t.Errorf("忽略元数据时的符号链接 = %+v", resp)
+	}
+}
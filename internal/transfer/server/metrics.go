@@ -0,0 +1,100 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-transfer/internal/infrastructure/metrics"
+	"go-transfer/internal/infrastructure/system"
+)
+
+var (
+	// durationBuckets 上传耗时直方图的桶上界（秒）
+	durationBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600}
+	// throughputBuckets 上传速度直方图的桶上界（字节/秒）
+	throughputBuckets = []float64{1 << 20, 10 << 20, 50 << 20, 100 << 20, 250 << 20, 500 << 20, 1 << 30}
+)
+
+// serverMetrics 服务的运行指标，由 /metrics 以 Prometheus 文本格式输出
+type serverMetrics struct {
+	registry      *metrics.Registry
+	received      *metrics.Counter   // 接收写入存储的字节数
+	forwarded     *metrics.Counter   // 转发到下一跳的字节数
+	uploads       *metrics.Counter   // 按响应状态码统计的上传请求数
+	forwardErrors *metrics.Counter   // 按下一跳状态码统计的转发失败数，未收到响应时为 network
+	active        *metrics.Gauge     // 进行中的上传请求数
+	duration      *metrics.Histogram // 成功上传的耗时
+	throughput    *metrics.Histogram // 成功上传的平均速度
+}
+
+// stats 返回服务的运行指标，首次调用时创建
+func (ft *FileTransfer) stats() *serverMetrics {
+	ft.metricsOnce.Do(func() {
+		r := metrics.NewRegistry()
+		ft.metrics = &serverMetrics{
+			registry:      r,
+			received:      r.NewCounter("gt_received_bytes_total", "Bytes written to storage by uploads."),
+			forwarded:     r.NewCounter("gt_forwarded_bytes_total", "Bytes forwarded to the next hop."),
+			uploads:       r.NewCounter("gt_uploads_total", "Upload requests by HTTP status code.", "code"),
+			forwardErrors: r.NewCounter("gt_forward_errors_total", "Failed forwards by upstream status code (network when no response).", "code"),
+			active:        r.NewGauge("gt_active_uploads", "Upload requests in progress."),
+			duration:      r.NewHistogram("gt_upload_duration_seconds", "Duration of successful uploads.", durationBuckets),
+			throughput:    r.NewHistogram("gt_upload_throughput_bytes_per_second", "Average throughput of successful uploads.", throughputBuckets),
+		}
+		if ft.Mode == "receiver" {
+			r.NewGaugeFunc("gt_disk_free_bytes", "Free disk space available in the storage path.", func() (float64, bool) {
+				free, err := system.DiskFree(system.ExpandPath(ft.StoragePath))
+				return float64(free), err == nil
+			})
+		}
+	})
+	return ft.metrics
+}
+
+// observeUpload 记录一次成功上传的耗时和平均速度，n 为期间传输的字节数
+func (m *serverMetrics) observeUpload(start time.Time, n int64) {
+	elapsed := time.Since(start).Seconds()
+	m.duration.Observe(elapsed)
+	if elapsed > 0 {
+		m.throughput.Observe(float64(n) / elapsed)
+	}
+}
+
+// handleMetrics 以 Prometheus 文本格式输出运行指标
+func (ft *FileTransfer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	ft.stats().registry.Handler()(w, r)
+}
+
+// statusRecorder 记录处理函数写入的响应状态码
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.code == 0 {
+		s.code = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.code == 0 {
+		s.code = http.StatusOK
+	}
+	return s.ResponseWriter.Write(p)
+}
+
+// Unwrap 供 http.ResponseController 访问底层的 ResponseWriter
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// status 返回响应状态码，处理函数未写入响应时为 200
+func (s *statusRecorder) status() string {
+	if s.code == 0 {
+		return strconv.Itoa(http.StatusOK)
+	}
+	return strconv.Itoa(s.code)
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+)
+
+// scrape 读取 /metrics 的输出
+func scrape(t *testing.T, ft *FileTransfer) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	ft.handleMetrics(rec, httptest.NewRequest(http.MethodGet, constants.MetricsRoute, nil))
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", rec.Header().Get("Content-Type"))
+	}
+	return rec.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	receiver := &FileTransfer{Mode: "receiver", StoragePath: t.TempDir(), OnConflict: constants.ConflictFail}
+	upload(receiver, "a.txt", "hello", "")
+	upload(receiver, "a.txt", "hello", "")
+
+	out := scrape(t, receiver)
+	for _, want := range []string{
+		"# TYPE gt_received_bytes_total counter\ngt_received_bytes_total 5\n",
+		`gt_uploads_total{code="200"} 1`,
+		`gt_uploads_total{code="409"} 1`,
+		"gt_active_uploads 0\n",
+		"gt_upload_duration_seconds_count 1\n",
+		`gt_upload_duration_seconds_bucket{le="+Inf"} 1`,
+		"gt_upload_throughput_bytes_per_second_count 1\n",
+		"# TYPE gt_disk_free_bytes gauge\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("指标缺少 %q:\n%s", want, out)
+		}
+	}
+
+	// 转发节点统计转发字节数和下一跳返回的错误
+	next := httptest.NewServer(StreamUploadHandler(receiver))
+	defer next.Close()
+	forward := &FileTransfer{Mode: "forward", TargetURL: next.URL}
+	upload(forward, "b.txt", "hello", "")
+	upload(forward, "b.txt", "hello", "")
+
+	out = scrape(t, forward)
+	for _, want := range []string{
+		"gt_forwarded_bytes_total 10\n",
+		`gt_forward_errors_total{code="409"} 1`,
+		`gt_uploads_total{code="409"} 1`,
+		"gt_upload_duration_seconds_count 1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("转发指标缺少 %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "gt_disk_free_bytes") {
+		t.Errorf("转发节点不应输出磁盘剩余空间")
+	}
+}
+
+func TestForwardedBytesOnClientError(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	receiver := &FileTransfer{Mode: "receiver", StoragePath: t.TempDir()}
+	next := httptest.NewServer(StreamUploadHandler(receiver))
+	defer next.Close()
+	forward := &FileTransfer{Mode: "forward", TargetURL: next.URL}
+
+	// 客户端发送一半后连接出错：已转发的字节数仍计入统计
+	body := io.MultiReader(strings.NewReader(strings.Repeat("x", 1024)), iotest.ErrReader(errors.New("connection reset")))
+	code, _ := postJSON(t, StreamUploadHandler(forward), "c.bin", body, map[string]string{constants.HeaderContentLength: "2048"})
+	if code < http.StatusBadRequest {
+		t.Errorf("客户端出错时状态码 = %d", code)
+	}
+	if out := scrape(t, forward); !strings.Contains(out, "gt_forwarded_bytes_total 1024\n") {
+		t.Errorf("转发字节数统计错误:\n%s", out)
+	}
+
+	// 下一跳不可达时转发请求先于读取客户端数据结束
+	unreachable := &FileTransfer{Mode: "forward", TargetURL: "http://127.0.0.1:1"}
+	if code, _ := postJSON(t, StreamUploadHandler(unreachable), "d.bin", strings.NewReader("hello"), nil); code != http.StatusBadGateway {
+		t.Errorf("下一跳不可达时状态码 = %d", code)
+	}
+}
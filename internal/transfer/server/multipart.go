@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+)
+
+// maxFormField 表单中非文件字段的最大长度
+const maxFormField = 4096
+
+// handleMultipartUpload 处理FormData上传（浏览器友好）：用 multipart.Reader 逐个读取文件部分，
+// 每个文件直接流入接收或转发流程，不在内存或临时文件中缓存。
+// 文件名依次取自：紧邻文件之前的 name 字段、URL 的 name 参数（仅第一个文件）、文件部分的 filename（保留相对路径）
+func handleMultipartUpload(ft *FileTransfer, w http.ResponseWriter, r *http.Request) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "解析表单失败: %v", err)
+		return
+	}
+
+	// 各文件的响应先记录下来，全部处理完后汇总；下一跳和本节点的处理结果统一以 JSON 记录
+	partRequest := r.Clone(r.Context())
+	partRequest.Header.Set("Accept", "application/json")
+
+	var parts []*partRecorder
+	var results []uploadResponse
+	queryName := r.URL.Query().Get("name")
+	fieldName := ""
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if respondCancelled(w, r, queryName) {
+				return
+			}
+			if len(parts) == 0 {
+				writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "解析表单失败: %v", err)
+				return
+			}
+			// 已处理的文件保留结果，其余部分无法读取
+			message := fmt.Sprintf("解析表单失败: %v", err)
+			parts = append(parts, &partRecorder{code: http.StatusBadRequest})
+			results = append(results, uploadResponse{
+				Status:  constants.UploadStatusError,
+				Error:   &uploadError{Code: constants.ErrCodeBadRequest, Message: message},
+				Message: message,
+			})
+			break
+		}
+
+		fileName := partFileName(part)
+		if fileName == "" {
+			// 普通字段：name 指定下一个文件的保存路径
+			if part.FormName() == "name" {
+				value, _ := io.ReadAll(io.LimitReader(part, maxFormField))
+				fieldName = strings.TrimSpace(string(value))
+			}
+			part.Close()
+			continue
+		}
+		switch {
+		case fieldName != "":
+			fileName, fieldName = fieldName, ""
+		case queryName != "" && len(parts) == 0:
+			fileName = queryName
+		}
+
+		rec := &partRecorder{header: make(http.Header)}
+		switch ft.Mode {
+		case "receiver":
+			handleReceive(ft, rec, partRequest, part, fileName, -1, true)
+		case "forward":
+			handleForward(ft, rec, partRequest, part, fileName, -1, true)
+		default:
+			writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "未知服务模式")
+			return
+		}
+		part.Close()
+		parts = append(parts, rec)
+		results = append(results, rec.result(fileName))
+	}
+
+	switch len(parts) {
+	case 0:
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "表单中没有文件")
+	case 1:
+		// 单个文件保持原有的响应头和响应内容
+		copyHeaders(w.Header(), parts[0].header, constants.HeaderUploadOffset, constants.HeaderContentDigest,
+			constants.HeaderConflictResult, constants.HeaderStoredName)
+		writeResponse(w, r, parts[0].code, &results[0])
+	default:
+		code, resp := batchResponse(parts, results)
+		resp.setTiming(requestStart(r), resp.Bytes)
+		logger.LogInfo("📦 表单上传结束: %d 个文件", len(results))
+		writeResponse(w, r, code, resp)
+	}
+}
+
+// partFileName 返回文件部分的 filename，不是文件时返回空字符串。
+// 不使用 Part.FileName()，它只保留最后一级文件名，会丢失文件夹上传的相对路径
+func partFileName(part *multipart.Part) string {
+	_, params, err := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+	if err != nil {
+		return ""
+	}
+	return params["filename"]
+}
+
+// batchResponse 汇总多个文件的结果：全部成功时返回 200，否则返回第一个失败文件的状态码
+func batchResponse(parts []*partRecorder, results []uploadResponse) (int, *uploadResponse) {
+	code := http.StatusOK
+	resp := &uploadResponse{Status: constants.UploadStatusOK, Files: results}
+	messages := make([]string, len(results))
+	for i, result := range results {
+		resp.Bytes += result.Bytes
+		messages[i] = result.Message
+		if result.Status == constants.UploadStatusError && resp.Error == nil {
+			code = parts[i].code
+			resp.Status = constants.UploadStatusError
+			resp.Error = result.Error
+		}
+	}
+	resp.Message = strings.Join(messages, "\n")
+	return code, resp
+}
+
+// partRecorder 记录单个文件部分的响应
+type partRecorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (p *partRecorder) Header() http.Header {
+	return p.header
+}
+
+func (p *partRecorder) WriteHeader(code int) {
+	if p.code == 0 {
+		p.code = code
+	}
+}
+
+func (p *partRecorder) Write(b []byte) (int, error) {
+	if p.code == 0 {
+		p.code = http.StatusOK
+	}
+	return p.body.Write(b)
+}
+
+// result 解析记录的响应，下一跳返回纯文本时按状态码构造结果
+func (p *partRecorder) result(fileName string) uploadResponse {
+	if p.code == 0 {
+		p.code = http.StatusOK
+	}
+	var resp uploadResponse
+	if json.Unmarshal(p.body.Bytes(), &resp) == nil && resp.Status != "" {
+		return resp
+	}
+
+	message := strings.TrimSpace(p.body.String())
+	resp = uploadResponse{Status: constants.UploadStatusOK, Name: fileName, Message: message}
+	if p.code >= http.StatusBadRequest {
+		resp.Status = constants.UploadStatusError
+		resp.Error = &uploadError{Code: constants.ErrCodeUpstream, Message: message}
+	}
+	return resp
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+)
+
+// formPart 表单中的一个部分，fileName 为空时是普通字段
+type formPart struct {
+	field, fileName, data string
+}
+
+// postForm 以 multipart/form-data 上传
+func postForm(handler http.Handler, accept string, parts ...formPart) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, p := range parts {
+		if p.fileName == "" {
+			writer.WriteField(p.field, p.data)
+			continue
+		}
+		// 手动写入 Content-Disposition，保留文件名中的目录
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", `form-data; name="`+p.field+`"; filename="`+p.fileName+`"`)
+		header.Set("Content-Type", "application/octet-stream")
+		part, _ := writer.CreatePart(header)
+		part.Write([]byte(p.data))
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMultipartSingleFile(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	ft := &FileTransfer{Mode: "receiver", StoragePath: storage}
+
+	rec := postForm(StreamUploadHandler(ft), "", formPart{"file", "a.txt", "hello"})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "文件上传成功: a.txt") {
+		t.Fatalf("上传结果 = %d %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get(constants.HeaderContentDigest) == "" {
+		t.Error("缺少摘要响应头")
+	}
+	if data, _ := os.ReadFile(filepath.Join(storage, "a.txt")); string(data) != "hello" {
+		t.Errorf("文件内容 = %q", data)
+	}
+
+	if rec := postForm(StreamUploadHandler(ft), "", formPart{"note", "", "x"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("没有文件的表单状态码 = %d, 期望 %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestMultipartMultipleFiles(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	for _, mode := range []string{"receiver", "forward"} {
+		t.Run(mode, func(t *testing.T) {
+			storage := t.TempDir()
+			ft := &FileTransfer{Mode: "receiver", StoragePath: storage}
+			if mode == "forward" {
+				next := httptest.NewServer(ft.routes())
+				defer next.Close()
+				ft = &FileTransfer{Mode: "forward", TargetURL: next.URL}
+			}
+
+			rec := postForm(StreamUploadHandler(ft), "application/json",
+				formPart{"file", "a.txt", "hello"},
+				formPart{"file", "dir/b.txt", "world!"},
+				formPart{"name", "", "renamed/c.txt"},
+				formPart{"file", "ignored.txt", "third"},
+			)
+			var resp uploadResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("解析响应失败: %v: %s", err, rec.Body.String())
+			}
+			if rec.Code != http.StatusOK || resp.Status != constants.UploadStatusOK || resp.Bytes != 16 || len(resp.Files) != 3 {
+				t.Fatalf("上传结果 = %d %+v", rec.Code, resp)
+			}
+
+			want := map[string]string{"a.txt": "hello", "dir/b.txt": "world!", "renamed/c.txt": "third"}
+			for i, name := range []string{"a.txt", "dir/b.txt", "renamed/c.txt"} {
+				if resp.Files[i].Stored != name {
+					t.Errorf("第 %d 个文件保存为 %q, 期望 %q", i, resp.Files[i].Stored, name)
+				}
+				if data, _ := os.ReadFile(filepath.Join(storage, filepath.FromSlash(name))); string(data) != want[name] {
+					t.Errorf("%s 内容 = %q", name, data)
+				}
+			}
+		})
+	}
+}
+
+func TestMultipartPartialFailure(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	ft := &FileTransfer{Mode: "receiver", StoragePath: t.TempDir(), OnConflict: constants.ConflictFail}
+	upload(ft, "b.txt", "old", "")
+
+	// 失败的文件不影响其余文件，整体状态码取第一个失败文件
+	rec := postForm(StreamUploadHandler(ft), "application/json",
+		formPart{"file", "a.txt", "hello"},
+		formPart{"file", "b.txt", "new"},
+		formPart{"file", "c.txt", "more"},
+	)
+	var resp uploadResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v: %s", err, rec.Body.String())
+	}
+	if rec.Code != http.StatusConflict || resp.Status != constants.UploadStatusError || len(resp.Files) != 3 {
+		t.Fatalf("上传结果 = %d %+v", rec.Code, resp)
+	}
+	if resp.Files[0].Status != constants.UploadStatusOK || resp.Files[1].Status != constants.UploadStatusError || resp.Files[2].Status != constants.UploadStatusOK {
+		t.Errorf("各文件结果 = %+v", resp.Files)
+	}
+}
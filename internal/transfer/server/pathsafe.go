@@ -0,0 +1,183 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-transfer/internal/constants"
+)
+
+// errUnsafePath 文件名不安全时返回的错误
+var errUnsafePath = errors.New("非法文件名")
+
+// windowsReserved Windows 保留设备名（不区分大小写，忽略扩展名）
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// isReservedDir 判断相对路径是否为存储目录顶层的隔离目录或旧版本目录，
+// 这两个目录由服务自身维护，不允许上传、下载或列出
+func isReservedDir(rel string) bool {
+	return strings.EqualFold(rel, constants.QuarantineDir) || strings.EqualFold(rel, constants.VersionsDir)
+}
+
+// sanitizeFileName 校验并规范化客户端提供的相对路径，返回以 / 分隔的安全路径
+func sanitizeFileName(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("%w: 文件名为空", errUnsafePath)
+	}
+	if strings.ContainsRune(name, 0) {
+		return "", fmt.Errorf("%w: 包含NUL字符", errUnsafePath)
+	}
+
+	// 统一分隔符，Windows 客户端可能使用反斜杠
+	normalized := strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(normalized, "/") {
+		return "", fmt.Errorf("%w: 不允许绝对路径 %q", errUnsafePath, name)
+	}
+	if len(normalized) >= 2 && normalized[1] == ':' {
+		return "", fmt.Errorf("%w: 不允许盘符 %q", errUnsafePath, name)
+	}
+
+	var parts []string
+	for _, part := range strings.Split(normalized, "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			return "", fmt.Errorf("%w: 不允许上级目录 %q", errUnsafePath, name)
+		}
+
+		if strings.ContainsRune(part, ':') {
+			return "", fmt.Errorf("%w: 包含冒号 %q", errUnsafePath, name)
+		}
+		base, _, _ := strings.Cut(part, ".")
+		if windowsReserved[strings.ToUpper(strings.TrimRight(base, " "))] {
+			return "", fmt.Errorf("%w: Windows保留名 %q", errUnsafePath, part)
+		}
+		if isStagingFile(part) {
+			return "", fmt.Errorf("%w: 与暂存文件冲突 %q", errUnsafePath, part)
+		}
+		if len(parts) == 0 && isReservedDir(part) {
+			return "", fmt.Errorf("%w: 保留目录 %q", errUnsafePath, part)
+		}
+		parts = append(parts, part)
+	}
+
+	if len(parts) == 0 {
+		return "", fmt.Errorf("%w: 文件名为空", errUnsafePath)
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// safeJoin 将已校验的相对路径拼接到根目录下，并再次确认结果未逃逸根目录
+func safeJoin(root, name string) (string, error) {
+	clean, err := sanitizeFileName(name)
+	if err != nil {
+		return "", err
+	}
+
+	joined := filepath.Join(root, filepath.FromSlash(clean))
+	if !within(root, joined) {
+		return "", fmt.Errorf("%w: 路径逃逸存储目录 %q", errUnsafePath, name)
+	}
+	return joined, nil
+}
+
+// within 判断 target 是否为 root 本身或其下的路径（均为清理过的绝对路径）
+func within(root, target string) bool {
+	rel, err := filepath.Rel(root, target)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// ensureDir 在根目录下逐级创建目录。已有的符号链接须解析到根目录内的目录，
+// 避免借助链接（例如归档中先创建的链接）写到存储目录之外
+func ensureDir(root, dir string) error {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || !within(root, dir) {
+		return fmt.Errorf("%w: 路径逃逸存储目录 %q", errUnsafePath, dir)
+	}
+	if rel == "." {
+		return nil
+	}
+
+	current := root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		switch {
+		case os.IsNotExist(err):
+			if err := os.Mkdir(current, constants.DirPermission); err != nil && !os.IsExist(err) {
+				return err
+			}
+		case err != nil:
+			return err
+		case info.Mode()&os.ModeSymlink != 0:
+			if !resolvesInside(root, current) {
+				return fmt.Errorf("%w: 经过指向存储目录外的链接 %q", errUnsafePath, filepath.ToSlash(rel))
+			}
+		case !info.IsDir():
+			return fmt.Errorf("%q 不是目录", filepath.ToSlash(rel))
+		}
+	}
+	return nil
+}
+
+// resolvesInside 判断路径（可经过符号链接）是否解析到根目录内的目录
+func resolvesInside(root, dir string) bool {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return false
+	}
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil || !within(realRoot, resolved) {
+		return false
+	}
+	info, err := os.Stat(resolved)
+	return err == nil && info.IsDir()
+}
+
+// safeLinkTarget 校验要在 linkPath 创建的符号链接目标：必须是相对路径，".." 只能出现在开头，
+// 且从链接所在目录的实际位置解析后仍在根目录内。".." 不出现在中间，保证经过其他链接时也不会回到根目录之外
+func safeLinkTarget(root, linkPath, target string) error {
+	if target == "" || strings.ContainsRune(target, 0) {
+		return fmt.Errorf("%w: 链接目标无效 %q", errUnsafePath, target)
+	}
+	if filepath.IsAbs(target) || strings.HasPrefix(target, "/") || strings.HasPrefix(target, `\`) ||
+		(len(target) >= 2 && target[1] == ':') {
+		return fmt.Errorf("%w: 链接指向绝对路径 %q", errUnsafePath, target)
+	}
+
+	descending := false
+	for _, part := range strings.Split(strings.ReplaceAll(target, `\`, "/"), "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if descending {
+				return fmt.Errorf("%w: 链接目标中间包含上级目录 %q", errUnsafePath, target)
+			}
+		default:
+			descending = true
+		}
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	realDir, err := filepath.EvalSymlinks(filepath.Dir(linkPath))
+	if err != nil {
+		return err
+	}
+	if !within(realRoot, filepath.Join(realDir, filepath.FromSlash(target))) {
+		return fmt.Errorf("%w: 链接指向存储目录之外 %q", errUnsafePath, target)
+	}
+	return nil
+}
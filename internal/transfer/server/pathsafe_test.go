@@ -0,0 +1,124 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-transfer/internal/infrastructure/logger"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"普通文件", "report.pdf", "report.pdf", false},
+		{"子目录", "dir/sub/file.txt", "dir/sub/file.txt", false},
+		{"中文文件名", "资料/报告.docx", "资料/报告.docx", false},
+		{"反斜杠分隔", `dir\file.txt`, "dir/file.txt", false},
+		{"冗余分隔符", "dir//./file.txt", "dir/file.txt", false},
+		{"隐藏文件", ".env", ".env", false},
+		{"空文件名", "", "", true},
+		{"仅当前目录", "./", "", true},
+		{"上级目录", "../etc/passwd", "", true},
+		{"中间上级目录", "dir/../../x", "", true},
+		{"反斜杠上级目录", `..\..\x`, "", true},
+		{"绝对路径", "/etc/passwd", "", true},
+		{"Windows绝对路径", `\Windows\system32`, "", true},
+		{"盘符", "C:/Windows/win.ini", "", true},
+		{"盘符相对路径", "c:file.txt", "", true},
+		{"NUL字符", "a\x00.txt", "", true},
+		{"备用数据流", "file.txt:stream", "", true},
+		{"保留名", "CON", "", true},
+		{"保留名带扩展名", "dir/nul.txt", "", true},
+		{"保留名小写", "com1", "", true},
+		{"非保留名", "console.txt", "console.txt", false},
+		{"暂存文件", "dir/.a.bin.gtpart", "", true},
+		{"分块状态文件", ".a.bin.gtchunks", "", true},
+		{"旧版本目录", ".gtversions/a.txt.1", "", true},
+		{"隔离目录大小写", ".GTQuarantine/a.txt", "", true},
+		{"子目录中的同名目录", "dir/.gtversions/a.txt", "dir/.gtversions/a.txt", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sanitizeFileName(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("sanitizeFileName(%q) = %q, 期望返回错误", tt.input, got)
+				}
+				if !errors.Is(err, errUnsafePath) {
+					t.Fatalf("sanitizeFileName(%q) 错误类型不正确: %v", tt.input, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("sanitizeFileName(%q) 返回错误: %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Fatalf("sanitizeFileName(%q) = %q, 期望 %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReceiveRejectsTraversal(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	root := t.TempDir()
+	ft := &FileTransfer{Mode: "receiver", StoragePath: filepath.Join(root, "storage")}
+	os.MkdirAll(ft.StoragePath, 0755)
+
+	for _, name := range []string{"../escape.txt", "/tmp/abs.txt", "a/../../escape.txt"} {
+		req := httptest.NewRequest(http.MethodPost, "/upload?name="+url.QueryEscape(name), strings.NewReader("data"))
+		rec := httptest.NewRecorder()
+		StreamUploadHandler(ft)(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("name=%q 状态码 = %d, 期望 %d", name, rec.Code, http.StatusBadRequest)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "escape.txt")); err == nil {
+		t.Fatal("文件被写到了存储目录之外")
+	}
+}
+
+func FuzzReceiveHandler(f *testing.F) {
+	logger.GlobalLogger.SetSilent(true)
+	for _, seed := range []string{
+		"file.txt", "dir/file.txt", "../x", "..\\x", "/abs", "C:\\x", "a\x00b", "CON.txt", "./.", "a/./b/../c",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, name string) {
+		root := t.TempDir()
+		storage := filepath.Join(root, "storage")
+		os.MkdirAll(storage, 0755)
+		ft := &FileTransfer{Mode: "receiver", StoragePath: storage}
+
+		req := httptest.NewRequest(http.MethodPost, "/upload?name="+url.QueryEscape(name), strings.NewReader("x"))
+		rec := httptest.NewRecorder()
+		StreamUploadHandler(ft)(rec, req)
+
+		if rec.Code != http.StatusOK && rec.Code != http.StatusBadRequest && rec.Code != http.StatusInternalServerError {
+			t.Fatalf("name=%q 意外的状态码 %d", name, rec.Code)
+		}
+
+		// 存储目录之外不应出现任何文件
+		entries, _ := os.ReadDir(root)
+		for _, entry := range entries {
+			if entry.Name() != "storage" {
+				t.Fatalf("name=%q 在存储目录外创建了 %s", name, entry.Name())
+			}
+		}
+	})
+}
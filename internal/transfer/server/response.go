@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-transfer/internal/constants"
+)
+
+// uploadResponse /upload 的响应，协商为 JSON 时整体输出，否则只输出 Message
+type uploadResponse struct {
+	Status     string           `json:"status"`            // ok、partial、skipped、error
+	Name       string           `json:"name,omitempty"`    // 请求的文件名
+	Stored     string           `json:"stored,omitempty"`  // 实际保存的相对路径
+	Bytes      int64            `json:"bytes"`             // 已接收的字节数
+	Total      int64            `json:"total,omitempty"`   // 文件总大小（partial 时）
+	Digest     string           `json:"digest,omitempty"`  // 接收端计算的整个文件的摘要
+	Result     string           `json:"result,omitempty"`  // 同名文件处理结果
+	DurationMs int64            `json:"duration_ms"`       // 接收耗时（毫秒）
+	Speed      float64          `json:"speed"`             // 平均速度（字节/秒）
+	Hops       []hopInfo        `json:"hops,omitempty"`    // 经过的节点，从客户端一侧开始
+	Files      []uploadResponse `json:"files,omitempty"`   // 表单包含多个文件时各文件的结果
+	Archive    *archiveStats    `json:"archive,omitempty"` // 目录归档上传的解压统计
+	Error      *uploadError     `json:"error,omitempty"`
+	Message    string           `json:"message"` // 供人阅读的说明，即纯文本响应的内容
+}
+
+// uploadError JSON 响应中的错误
+type uploadError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// hopInfo 上传经过的节点
+type hopInfo struct {
+	Node       string `json:"node"`        // 主机名:端口
+	Mode       string `json:"mode"`        // receiver 或 forward
+	DurationMs int64  `json:"duration_ms"` // 本节点处理请求的耗时（毫秒）
+}
+
+// requestStartKey 请求上下文中保存请求开始时间的键
+type requestStartKey struct{}
+
+// withRequestStart 在请求上下文中记录开始时间
+func withRequestStart(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestStartKey{}, time.Now()))
+}
+
+// requestStart 返回请求的开始时间，未记录时为当前时间
+func requestStart(r *http.Request) time.Time {
+	if start, ok := r.Context().Value(requestStartKey{}).(time.Time); ok {
+		return start
+	}
+	return time.Now()
+}
+
+// setTiming 记录耗时和平均速度，n 为期间传输的字节数
+func (resp *uploadResponse) setTiming(start time.Time, n int64) {
+	elapsed := time.Since(start)
+	resp.DurationMs = elapsed.Milliseconds()
+	if elapsed > 0 {
+		resp.Speed = float64(n) / elapsed.Seconds()
+	}
+}
+
+// wantsJSON 按 Accept 请求头协商响应格式：application/json 的优先级不低于 text/plain 时返回 true，
+// 未指定或只有 */* 时保持纯文本（兼容 curl）
+func wantsJSON(r *http.Request) bool {
+	jsonQ, textQ := 0.0, 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		case "text/plain", "text/*":
+			textQ = max(textQ, q)
+		}
+	}
+	return jsonQ > 0 && jsonQ >= textQ
+}
+
+// hop 返回本节点的信息
+func (ft *FileTransfer) hop(r *http.Request) hopInfo {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	return hopInfo{
+		Node:       fmt.Sprintf("%s:%d", host, ft.Port),
+		Mode:       ft.Mode,
+		DurationMs: time.Since(requestStart(r)).Milliseconds(),
+	}
+}
+
+// writeUpload 在节点列表中加入本节点后写入上传响应
+func (ft *FileTransfer) writeUpload(w http.ResponseWriter, r *http.Request, code int, resp *uploadResponse) {
+	resp.Hops = append(resp.Hops, ft.hop(r))
+	writeResponse(w, r, code, resp)
+}
+
+// writeResponse 按协商的格式写入上传响应
+func writeResponse(w http.ResponseWriter, r *http.Request, code int, resp *uploadResponse) {
+	transferFrom(r).setResult(resp)
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	if resp.Status == constants.UploadStatusError {
+		http.Error(w, resp.Message, code)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(code)
+	io.WriteString(w, resp.Message)
+}
+
+// writeError 按协商的格式写入错误响应，JSON 响应的 error.code 为 code
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, format string, v ...interface{}) {
+	message := fmt.Sprintf(format, v...)
+	writeResponse(w, r, status, &uploadResponse{
+		Status:  constants.UploadStatusError,
+		Error:   &uploadError{Code: code, Message: message},
+		Message: message,
+	})
+}
+
+// relayUpload 将下一跳的上传响应转给客户端：JSON 响应按客户端协商的格式输出（带节点列表时在前面加入本节点），
+// 无法解析的响应原样转发
+func (ft *FileTransfer) relayUpload(w http.ResponseWriter, r *http.Request, resp *http.Response) {
+	copyHeaders(w.Header(), resp.Header, constants.HeaderUploadOffset, constants.HeaderContentDigest, constants.HeaderFileDigest,
+		constants.HeaderConflictResult, constants.HeaderStoredName)
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, constants.MaxUploadResponse))
+	var result uploadResponse
+	if err == nil && strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") &&
+		json.Unmarshal(body, &result) == nil && result.Status != "" {
+		if len(result.Hops) > 0 {
+			result.Hops = append([]hopInfo{ft.hop(r)}, result.Hops...)
+		}
+		writeResponse(w, r, resp.StatusCode, &result)
+		return
+	}
+
+	copyHeaders(w.Header(), resp.Header, "Content-Type")
+	w.WriteHeader(resp.StatusCode)
+	w.Write(body)
+	io.Copy(w, resp.Body)
+}
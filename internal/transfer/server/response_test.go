@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+)
+
+func TestWantsJSON(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"text/plain", false},
+		{"application/json", true},
+		{"application/json, text/plain;q=0.5", true},
+		{"text/plain, application/json;q=0.9", false},
+		{"application/json;q=0", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/upload", nil)
+		req.Header.Set("Accept", tt.accept)
+		if got := wantsJSON(req); got != tt.want {
+			t.Errorf("wantsJSON(%q) = %v, 期望 %v", tt.accept, got, tt.want)
+		}
+	}
+}
+
+// postJSON 上传请求体并要求 JSON 响应，headers 覆盖默认的请求头（如 Content-Type）
+func postJSON(t *testing.T, handler http.Handler, name string, body io.Reader, headers map[string]string) (int, uploadResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/upload?name="+url.QueryEscape(name), body)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Accept", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var resp uploadResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v: %s", err, rec.Body.String())
+	}
+	return rec.Code, resp
+}
+
+func TestUploadJSONResponse(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	receiver := &FileTransfer{Mode: "receiver", Port: 17002, StoragePath: t.TempDir(), OnConflict: constants.ConflictFail}
+
+	code, resp := postJSON(t, StreamUploadHandler(receiver), "a.txt", strings.NewReader("hello"), nil)
+	if code != http.StatusOK || resp.Status != constants.UploadStatusOK {
+		t.Fatalf("上传结果 = %d %+v", code, resp)
+	}
+	if resp.Stored != "a.txt" || resp.Bytes != 5 || resp.Result != constants.ResultCreated || !strings.HasPrefix(resp.Digest, "sha256=") {
+		t.Errorf("响应字段错误: %+v", resp)
+	}
+	if len(resp.Hops) != 1 || resp.Hops[0].Mode != "receiver" {
+		t.Errorf("节点列表 = %+v", resp.Hops)
+	}
+
+	code, resp = postJSON(t, StreamUploadHandler(receiver), "a.txt", strings.NewReader("again"), nil)
+	if code != http.StatusConflict || resp.Error == nil || resp.Error.Code != constants.ErrCodeFileExists {
+		t.Errorf("同名文件响应 = %d %+v", code, resp)
+	}
+
+	// 纯文本响应保持不变
+	if rec := upload(receiver, "b.txt", "hello", ""); !strings.HasPrefix(rec.Body.String(), "文件上传成功: b.txt (5 bytes") {
+		t.Errorf("纯文本响应 = %q", rec.Body.String())
+	}
+
+	// 经过转发节点时节点列表从客户端一侧开始
+	next := httptest.NewServer(StreamUploadHandler(receiver))
+	defer next.Close()
+	forward := &FileTransfer{Mode: "forward", Port: 17003, TargetURL: next.URL}
+
+	code, resp = postJSON(t, StreamUploadHandler(forward), "c.txt", strings.NewReader("hello"), nil)
+	if code != http.StatusOK || resp.Stored != "c.txt" {
+		t.Fatalf("转发上传结果 = %d %+v", code, resp)
+	}
+	if len(resp.Hops) != 2 || resp.Hops[0].Mode != "forward" || resp.Hops[1].Mode != "receiver" {
+		t.Errorf("转发节点列表 = %+v", resp.Hops)
+	}
+
+	rec := upload(forward, "d.txt", "hello", "")
+	if !strings.HasPrefix(rec.Body.String(), "文件上传成功: d.txt") || strings.Contains(rec.Header().Get("Content-Type"), "json") {
+		t.Errorf("转发纯文本响应 = %q (%s)", rec.Body.String(), rec.Header().Get("Content-Type"))
+	}
+}
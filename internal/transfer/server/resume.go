@@ -0,0 +1,106 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/system"
+)
+
+// contentRange 解析后的 Content-Range 请求头
+type contentRange struct {
+	Start int64 // 本次数据的起始偏移
+	End   int64 // 本次数据的结束偏移（包含）
+	Total int64 // 文件总大小
+}
+
+// parseContentRange 解析形如 "bytes 100-199/1000" 的 Content-Range
+func parseContentRange(value string) (*contentRange, error) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(value), "bytes ")
+	if !ok {
+		return nil, fmt.Errorf("不支持的 Content-Range: %s", value)
+	}
+
+	rangePart, totalPart, ok := strings.Cut(spec, "/")
+	if !ok {
+		return nil, fmt.Errorf("Content-Range 缺少总大小: %s", value)
+	}
+
+	startStr, endStr, ok := strings.Cut(rangePart, "-")
+	if !ok {
+		return nil, fmt.Errorf("Content-Range 格式错误: %s", value)
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 {
+		return nil, fmt.Errorf("Content-Range 起始偏移无效: %s", value)
+	}
+	end, err := strconv.ParseInt(endStr, 10, 64)
+	if err != nil || end < start {
+		return nil, fmt.Errorf("Content-Range 结束偏移无效: %s", value)
+	}
+
+	total, err := strconv.ParseInt(totalPart, 10, 64)
+	if err != nil || total <= end {
+		return nil, fmt.Errorf("Content-Range 总大小无效: %s", value)
+	}
+
+	return &contentRange{Start: start, End: end, Total: total}, nil
+}
+
+// resolveStoragePath 校验文件名并计算其在存储目录中的最终路径
+func resolveStoragePath(ft *FileTransfer, fileName string) (string, error) {
+	return safeJoin(system.ExpandPath(ft.StoragePath), fileName)
+}
+
+// handleOffsetQuery 响应 HEAD /upload，告知客户端可续传的偏移
+func handleOffsetQuery(ft *FileTransfer, w http.ResponseWriter, r *http.Request) {
+	fileName := r.URL.Query().Get("name")
+	if fileName == "" {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "缺少name参数")
+		return
+	}
+	if !allowPath(w, r, fileName) {
+		return
+	}
+
+	switch ft.Mode {
+	case "receiver":
+		finalPath, err := resolveStoragePath(ft, fileName)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, constants.ErrCodeInvalidPath, "%v", err)
+			return
+		}
+		offset := committedOffset(finalPath)
+		w.Header().Set(constants.HeaderUploadOffset, strconv.FormatInt(offset, 10))
+		w.WriteHeader(http.StatusOK)
+	case "forward":
+		// 转发模式下向下一跳查询偏移
+		req, err := http.NewRequest(http.MethodHead, ft.TargetURL+"/upload?"+r.URL.RawQuery, nil)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "创建转发请求失败: %v", err)
+			return
+		}
+		copyHeaders(req.Header, r.Header, "Accept")
+		ft.setUpstreamAuth(req)
+		client, err := ft.forwardClient()
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "创建转发客户端失败: %v", err)
+			return
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			writeError(w, r, http.StatusBadGateway, constants.ErrCodeUpstream, "查询偏移失败: %v", err)
+			return
+		}
+		resp.Body.Close()
+
+		copyHeaders(w.Header(), resp.Header, constants.HeaderUploadOffset, "Content-Type")
+		w.WriteHeader(resp.StatusCode)
+	default:
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "未知服务模式")
+	}
+}
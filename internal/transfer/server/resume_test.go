@@ -0,0 +1,115 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+)
+
+// interrupted 返回先读出 data 再报错的请求体，模拟上传中途断开
+func interrupted(data string) io.Reader {
+	return io.MultiReader(strings.NewReader(data), iotest.ErrReader(errors.New("连接断开")))
+}
+
+// queryOffset 经 HEAD /upload 查询已提交的偏移
+func queryOffset(t *testing.T, handler http.Handler, name string) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/upload?name="+name, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("查询偏移状态码 = %d", rec.Code)
+	}
+	return rec.Header().Get(constants.HeaderUploadOffset)
+}
+
+func TestResumeFromCommittedOffset(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	receiver := &FileTransfer{Mode: "receiver", StoragePath: storage}
+	next := httptest.NewServer(receiver.routes())
+	defer next.Close()
+	routes := receiver.routes()
+	forward := (&FileTransfer{Mode: "forward", TargetURL: next.URL}).routes()
+
+	if got := queryOffset(t, routes, "a.txt"); got != "0" {
+		t.Errorf("没有暂存文件时偏移 = %q", got)
+	}
+
+	// 中断的上传保留已接收的数据
+	if code, _ := postJSON(t, routes, "a.txt", interrupted("hello "), nil); code != http.StatusInternalServerError {
+		t.Fatalf("中断的上传状态码 = %d", code)
+	}
+	if got := queryOffset(t, routes, "a.txt"); got != "6" {
+		t.Errorf("中断后偏移 = %q, 期望 6", got)
+	}
+	if got := queryOffset(t, forward, "a.txt"); got != "6" {
+		t.Errorf("经转发查询的偏移 = %q, 期望 6", got)
+	}
+
+	// 起始位置与已提交的偏移不一致时拒绝，并告知正确的偏移
+	req := httptest.NewRequest(http.MethodPost, "/upload?name=a.txt", strings.NewReader("world"))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Range", "bytes 4-8/9")
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), constants.ErrCodeOffsetMismatch) {
+		t.Errorf("偏移不匹配 = %d %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get(constants.HeaderUploadOffset); got != "6" {
+		t.Errorf("偏移不匹配时返回的偏移 = %q", got)
+	}
+
+	// 范围与请求体长度不一致
+	code, resp := postJSON(t, routes, "a.txt", strings.NewReader("world"), map[string]string{"Content-Range": "bytes 6-11/12"})
+	if code != http.StatusBadRequest || resp.Error == nil || resp.Error.Code != constants.ErrCodeInvalidRange {
+		t.Errorf("范围长度不一致 = %d %+v", code, resp)
+	}
+
+	// 从已提交的偏移继续，经转发完成上传
+	code, resp = postJSON(t, forward, "a.txt", strings.NewReader("world"), map[string]string{"Content-Range": "bytes 6-10/11"})
+	if code != http.StatusOK || resp.Digest != sha256Digest([]byte("hello world")) {
+		t.Fatalf("续传结果 = %d %+v", code, resp)
+	}
+	if got, _ := os.ReadFile(filepath.Join(storage, "a.txt")); string(got) != "hello world" {
+		t.Errorf("续传后的文件内容 = %q", got)
+	}
+	if got := queryOffset(t, routes, "a.txt"); got != "0" {
+		t.Errorf("完成后偏移 = %q", got)
+	}
+}
+
+func TestOffsetQueryErrors(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	tests := []struct {
+		ft     *FileTransfer
+		target string
+		status int
+		code   string
+	}{
+		{&FileTransfer{Mode: "receiver", StoragePath: t.TempDir()}, "/upload", http.StatusBadRequest, constants.ErrCodeBadRequest},
+		{&FileTransfer{Mode: "receiver", StoragePath: t.TempDir()}, "/upload?name=../a.txt", http.StatusBadRequest, constants.ErrCodeInvalidPath},
+		{&FileTransfer{Mode: "forward", TargetURL: unreachable.URL}, "/upload?name=a.txt", http.StatusBadGateway, constants.ErrCodeUpstream},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodHead, tt.target, nil)
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		tt.ft.routes().ServeHTTP(rec, req)
+		if rec.Code != tt.status || !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") || !strings.Contains(rec.Body.String(), tt.code) {
+			t.Errorf("%s %s = %d %s: %s", tt.ft.Mode, tt.target, rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+)
+
+// ErrTransfersAborted 停止服务时等待超时，仍在进行的传输被中止
+var ErrTransfersAborted = errors.New("停止服务时有传输被中止")
+
+// drainTracker 跟踪进行中的传输，停止服务时等待其结束
+type drainTracker struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup // 停止接受新的传输后才会等待，不会与 Add 并发
+	active   int
+	draining bool // 已收到停止信号，不再接受新的传输
+	aborting bool // 等待超时，正在中止剩余的传输
+}
+
+// begin 登记一个新的传输，停止服务期间返回 false
+func (d *drainTracker) begin() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return false
+	}
+	d.active++
+	d.wg.Add(1)
+	return true
+}
+
+// end 传输结束
+func (d *drainTracker) end() {
+	d.mu.Lock()
+	d.active--
+	d.mu.Unlock()
+	d.wg.Done()
+}
+
+// drain 停止接受新的传输，返回进行中的传输数
+func (d *drainTracker) drain() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.draining = true
+	return d.active
+}
+
+// abort 标记正在中止剩余的传输，返回被中止的传输数
+func (d *drainTracker) abort() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.aborting = true
+	return d.active
+}
+
+// isAborting 判断是否正在中止传输
+func (d *drainTracker) isAborting() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.aborting
+}
+
+// wait 等待所有传输结束，最多等待 timeout
+func (d *drainTracker) wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// track 跟踪传输请求，停止服务期间到达的请求返回 503
+func (ft *FileTransfer) track(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !ft.drain.begin() {
+			w.Header().Set("Connection", "close")
+			writeError(w, r, http.StatusServiceUnavailable, constants.ErrCodeShuttingDown, "服务正在停止，请稍后重试")
+			return
+		}
+		defer ft.drain.end()
+		next(w, r)
+	}
+}
+
+// discardAborted 判断被中止的上传是否应删除暂存文件（默认保留供续传）
+func (ft *FileTransfer) discardAborted() bool {
+	return ft.DiscardPartials && ft.drain.isAborting()
+}
+
+// shutdown 停止接受新的请求，等待进行中的传输在 DrainTimeout 内完成，超时后中止剩余的传输
+func (ft *FileTransfer) shutdown(server *http.Server) error {
+	if active := ft.drain.drain(); active > 0 {
+		logger.LogInfo("🛑 收到停止信号，不再接受新的上传，等待 %d 个传输完成（最长 %s）...", active, ft.DrainTimeout)
+	} else {
+		logger.LogInfo("🛑 收到停止信号，正在停止服务...")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ft.DrainTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err == nil {
+		logger.LogSuccess("服务已停止")
+		return nil
+	}
+
+	// 超时：断开剩余的连接，等待处理函数清理暂存文件
+	aborted := ft.drain.abort()
+	server.Close()
+	if !ft.drain.wait(constants.AbortWait) {
+		logger.LogWarn("部分传输未能在 %s 内结束", constants.AbortWait)
+	}
+
+	switch {
+	case ft.Mode != "receiver":
+		logger.LogWarn("等待超时，已中止 %d 个传输", aborted)
+	case ft.DiscardPartials:
+		logger.LogWarn("等待超时，已中止 %d 个传输，未完成的暂存文件已删除", aborted)
+	default:
+		logger.LogWarn("等待超时，已中止 %d 个传输，未完成的暂存文件已保留，客户端可续传", aborted)
+	}
+	return ErrTransfersAborted
+}
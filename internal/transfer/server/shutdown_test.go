@@ -0,0 +1,78 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-transfer/internal/infrastructure/logger"
+)
+
+// startServer 在随机端口上启动带传输跟踪的上传服务
+func startServer(t *testing.T, ft *FileTransfer) (*http.Server, string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: ft.track(StreamUploadHandler(ft))}
+	go server.Serve(listener)
+	return server, "http://" + listener.Addr().String()
+}
+
+func TestShutdownAbortsAfterDrainTimeout(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	for _, discard := range []bool{false, true} {
+		storage := t.TempDir()
+		ft := &FileTransfer{Mode: "receiver", StoragePath: storage, DrainTimeout: 200 * time.Millisecond, DiscardPartials: discard}
+		server, url := startServer(t, ft)
+
+		// 发送部分数据后保持连接，模拟进行中的上传
+		body, writer := io.Pipe()
+		go http.Post(url+"/upload?name=slow.bin", "application/octet-stream", body)
+		writer.Write([]byte(strings.Repeat("x", 1024)))
+		stagingFile := stagingPath(filepath.Join(storage, "slow.bin"))
+		for i := 0; i < 100; i++ {
+			if _, err := os.Stat(stagingFile); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if err := ft.shutdown(server); !errors.Is(err, ErrTransfersAborted) {
+			t.Fatalf("shutdown() = %v, 期望 ErrTransfersAborted", err)
+		}
+		writer.Close()
+
+		_, err := os.Stat(stagingFile)
+		if discard && !os.IsNotExist(err) {
+			t.Errorf("discard=true: 暂存文件未删除: %v", err)
+		}
+		if !discard && err != nil {
+			t.Errorf("discard=false: 暂存文件未保留: %v", err)
+		}
+
+		// 停止期间到达的请求返回 503
+		rec := httptest.NewRecorder()
+		ft.track(StreamUploadHandler(ft))(rec, httptest.NewRequest(http.MethodPost, "/upload?name=a.txt", strings.NewReader("a")))
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("停止期间状态码 = %d, 期望 %d", rec.Code, http.StatusServiceUnavailable)
+		}
+	}
+}
+
+func TestShutdownWaitsForIdle(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	ft := &FileTransfer{Mode: "receiver", StoragePath: t.TempDir(), DrainTimeout: time.Second}
+	server, _ := startServer(t, ft)
+	if err := ft.shutdown(server); err != nil {
+		t.Errorf("shutdown() = %v, 期望 nil", err)
+	}
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+)
+
+// stagingPath 返回最终路径对应的隐藏暂存文件路径（同目录，保证可原子重命名）
+func stagingPath(finalPath string) string {
+	dir, base := filepath.Split(finalPath)
+	return filepath.Join(dir, "."+base+constants.PartialSuffix)
+}
+
+// chunkStatePath 返回分块上传状态文件路径（与暂存文件同目录）
+func chunkStatePath(finalPath string) string {
+	dir, base := filepath.Split(finalPath)
+	return filepath.Join(dir, "."+base+constants.ChunkStateSuffix)
+}
+
+// isStagingFile 判断文件名是否为暂存文件或分块状态文件
+func isStagingFile(name string) bool {
+	return strings.HasPrefix(name, ".") &&
+		(strings.HasSuffix(name, constants.PartialSuffix) || strings.HasSuffix(name, constants.ChunkStateSuffix))
+}
+
+// committedOffset 返回暂存文件中已写入的字节数，分块上传（预分配、乱序写入）中的文件不支持按偏移续传
+func committedOffset(finalPath string) int64 {
+	if _, err := os.Stat(chunkStatePath(finalPath)); err == nil {
+		return 0
+	}
+	info, err := os.Stat(stagingPath(finalPath))
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// commitStaging 将暂存文件落盘并原子地重命名为最终文件
+func commitStaging(file *os.File, finalPath string) error {
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), finalPath)
+}
+
+// cleanupStaleStaging 清理存储目录中过期的暂存文件，较新的保留以便续传
+func cleanupStaleStaging(root string) {
+	cutoff := time.Now().Add(-constants.StaleStagingAge)
+	removed := 0
+
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() || !isStagingFile(info.Name()) {
+			return nil
+		}
+		if info.ModTime().Before(cutoff) {
+			if os.Remove(path) == nil {
+				removed++
+			}
+		}
+		return nil
+	})
+
+	if removed > 0 {
+		logger.LogInfo("🧹 已清理 %d 个过期暂存文件", removed)
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+)
+
+func TestUploadStagesBeforeCommit(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	receiver := &FileTransfer{Mode: "receiver", StoragePath: storage, OnConflict: constants.ConflictOverwrite}
+	routes := receiver.routes()
+	final := filepath.Join(storage, "dir", "a.txt")
+	staging := filepath.Join(storage, "dir", ".a.txt"+constants.PartialSuffix)
+
+	// 中断的上传只留下暂存文件，不出现目标文件
+	postJSON(t, routes, "dir/a.txt", interrupted("partial"), nil)
+	if got, err := os.ReadFile(staging); err != nil || string(got) != "partial" {
+		t.Fatalf("暂存文件内容 = %q (%v)", got, err)
+	}
+	if _, err := os.Stat(final); !os.IsNotExist(err) {
+		t.Errorf("中断的上传不应生成目标文件: %v", err)
+	}
+	if entries, _ := listEntries(t, receiver, "prefix=dir/"); len(entries) != 1 || entries[0].Name != "dir/a.txt" || !entries[0].InProgress {
+		t.Errorf("文件列表应以目标文件名显示未完成的上传: %+v", entries)
+	}
+
+	// 不带 Content-Range 的上传重新开始，完成后暂存文件改名为目标文件
+	code, resp := postJSON(t, routes, "dir/a.txt", strings.NewReader("v1"), nil)
+	if code != http.StatusOK || resp.Result != constants.ResultCreated {
+		t.Fatalf("上传结果 = %d %+v", code, resp)
+	}
+	if got, _ := os.ReadFile(final); string(got) != "v1" {
+		t.Errorf("目标文件内容 = %q", got)
+	}
+	if _, err := os.Stat(staging); !os.IsNotExist(err) {
+		t.Errorf("完成后暂存文件仍存在: %v", err)
+	}
+
+	// 覆盖已有文件的上传中断时，已有文件保持不变
+	postJSON(t, routes, "dir/a.txt", interrupted("v2-partial"), nil)
+	if got, _ := os.ReadFile(final); string(got) != "v1" {
+		t.Errorf("中断的覆盖上传改动了已有文件: %q", got)
+	}
+	if got, _ := os.ReadFile(staging); string(got) != "v2-partial" {
+		t.Errorf("覆盖上传的暂存文件内容 = %q", got)
+	}
+}
@@ -1,16 +1,25 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"go-transfer/internal/config"
 	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/digest"
 	"go-transfer/internal/infrastructure/logger"
 	"go-transfer/internal/infrastructure/progress"
 	"go-transfer/internal/infrastructure/system"
@@ -21,60 +30,198 @@ import (
 type FileTransfer struct {
 	Mode        string
 	Port        int
-	StoragePath string // receiver模式使用
-	TargetURL   string // forward模式使用
+	StoragePath string            // receiver模式使用
+	TargetURL   string            // forward模式使用
+	Tokens      []config.APIToken // 允许访问的令牌，为空时不启用认证
+	Token       string            // forward模式访问下一跳使用的令牌
+	TLS         config.TLSConfig  // TLS 配置
+	OnConflict  string            // 同名文件默认冲突策略，为空时覆盖
+	MaxFileSize int64             // 单个文件大小上限，0 表示不限制
+	Quota       int64             // receiver模式存储目录的总配额，0 表示不限制
+	DiskReserve int64             // receiver模式需保留的磁盘剩余空间
+
+	DrainTimeout    time.Duration // 停止时等待进行中传输完成的最长时间
+	DiscardPartials bool          // 停止时删除被中止上传的暂存文件，默认保留供续传
+	IgnoreMetadata  bool          // 忽略客户端发送的权限和修改时间，不创建符号链接
+
+	upstreamOnce   sync.Once
+	upstreamClient *http.Client
+	upstreamEvents *http.Client // 订阅下一跳事件流，不设整体超时
+	upstreamErr    error
+
+	chunks    chunkRegistry    // 正在拼装的分块上传
+	digests   sync.Map         // 最终路径 -> digestRecord，接收时计算的摘要
+	commitMu  sync.Mutex       // 串行化按冲突策略提交文件
+	space     spaceTracker     // 存储占用和预留空间
+	drain     drainTracker     // 进行中的传输，停止服务时等待
+	transfers transferRegistry // 进行中和最近结束的传输，由 /transfers 查看
+
+	metricsOnce sync.Once
+	metrics     *serverMetrics // 运行指标，由 stats() 创建
 }
 
-// Start 启动服务
-func (ft *FileTransfer) Start() {
+// Start 启动服务，收到 SIGINT/SIGTERM 后等待进行中的传输完成再返回。
+// 有传输因等待超时被中止时返回 ErrTransfersAborted
+func (ft *FileTransfer) Start() error {
 	// 先检查端口是否被占用
 	if system.CheckPortInUse(ft.Port) {
 		if !system.HandlePortConflict(ft.Port) {
 			logger.LogError("无法启动服务，端口 %d 被占用", ft.Port)
-			return
+			return fmt.Errorf("端口 %d 被占用", ft.Port)
 		}
 	}
 
-	mux := http.NewServeMux()
-
-	// API路由 - 纯流式上传
-	mux.HandleFunc("/upload", StreamUploadHandler(ft))
-	mux.HandleFunc("/status", ft.handleStatus)
-
-	// Swagger文档路由
-	mux.HandleFunc("/swagger.json", web.HandleSwaggerJSON)
-	mux.HandleFunc("/swagger/", web.HandleSwaggerUI)
-	mux.HandleFunc("/docs", func(w http.ResponseWriter, r *http.Request) {
-		http.Redirect(w, r, "/swagger/", http.StatusMovedPermanently)
-	})
-
 	addr := fmt.Sprintf("0.0.0.0:%d", ft.Port)
 
 	logger.LogInfo("\n========================================")
 	logger.LogInfo("启动 %s 模式服务", ft.Mode)
 	logger.LogInfo("监听地址: %s", addr)
 
+	if len(ft.Tokens) > 0 {
+		logger.LogInfo("🔑 已启用令牌认证 (%d 个令牌)", len(ft.Tokens))
+	}
+
+	if ft.MaxFileSize > 0 {
+		logger.LogInfo("最大文件: %s", system.FormatSize(ft.MaxFileSize))
+	}
 	if ft.Mode == "receiver" {
 		expandedPath := system.ExpandPath(ft.StoragePath)
 		logger.LogInfo("存储路径: %s", expandedPath)
 		os.MkdirAll(expandedPath, 0755)
+		cleanupStaleStaging(expandedPath)
+		if ft.Quota > 0 {
+			logger.LogInfo("存储配额: %s", system.FormatSize(ft.Quota))
+		}
 	} else {
 		logger.LogInfo("目标服务器: %s", ft.TargetURL)
 	}
 
-	logger.LogInfo("📚 API文档: http://%s/docs", addr)
+	// 转发模式提前创建到下一跳的客户端，TLS配置错误时立即退出
+	if ft.Mode == "forward" {
+		if _, err := ft.forwardClient(); err != nil {
+			logger.LogError("下一跳TLS配置错误: %v", err)
+			return err
+		}
+	}
+
+	scheme := "http"
+	var tlsConfig *tls.Config
+	if ft.TLS.Enabled() {
+		var err error
+		if tlsConfig, err = ft.serverTLSConfig(); err != nil {
+			logger.LogError("TLS配置错误: %v", err)
+			return err
+		}
+		scheme = "https"
+	}
+
+	logger.LogInfo("🌐 上传页面: %s://%s/", scheme, addr)
+	logger.LogInfo("📚 API文档: %s://%s/docs", scheme, addr)
 	logger.LogInfo("========================================\n")
 
 	server := &http.Server{
 		Addr:         addr,
-		Handler:      mux,
+		Handler:      ft.routes(),
 		ReadTimeout:  time.Hour,
 		WriteTimeout: time.Hour,
+		TLSConfig:    tlsConfig,
 	}
 
-	if err := server.ListenAndServe(); err != nil {
+	serveErr := make(chan error, 1)
+	go func() {
+		if tlsConfig != nil {
+			serveErr <- server.ListenAndServeTLS("", "")
+		} else {
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+
+	// 收到停止信号后不再接受新的上传，等待进行中的传输完成
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	select {
+	case err := <-serveErr:
 		logger.LogError("服务启动失败: %v", err)
+		return err
+	case <-ctx.Done():
 	}
+	stop() // 再次收到信号时立即退出
+	return ft.shutdown(server)
+}
+
+// routes 注册服务的所有路由
+func (ft *FileTransfer) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	// API路由 - 纯流式上传
+	mux.HandleFunc("/upload", ft.track(ft.withAuth(scopeWrite, StreamUploadHandler(ft))))
+	mux.HandleFunc("/status", ft.withAuth(scopeRead, ft.handleStatus))
+	mux.HandleFunc(constants.FilesRoute, ft.track(ft.handleFiles))
+	mux.HandleFunc(constants.ListRoute, ft.withAuth(scopeRead, ft.handleList))
+	mux.HandleFunc(constants.ManifestRoute, ft.withAuth(scopeRead, ft.handleManifest))
+	mux.HandleFunc(constants.SignatureRoute, ft.withAuth(scopeRead, ft.handleSignature))
+	mux.HandleFunc(constants.MetricsRoute, ft.withAuth(scopeRead, ft.handleMetrics))
+	mux.HandleFunc(constants.TransfersRoute, ft.withAuth(scopeRead, ft.handleTransfers))
+	mux.HandleFunc(constants.TransfersRoute+"/", ft.handleTransfer)
+
+	// 上传页面
+	mux.HandleFunc("/", web.HandleUploadPage)
+
+	// Swagger文档路由
+	mux.HandleFunc("/swagger.json", web.HandleSwaggerJSON)
+	mux.HandleFunc("/swagger/", web.HandleSwaggerUI)
+	mux.HandleFunc("/docs", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/swagger/", http.StatusMovedPermanently)
+	})
+	return mux
+}
+
+// serverTLSConfig 根据配置加载证书，必要时生成自签名证书
+func (ft *FileTransfer) serverTLSConfig() (*tls.Config, error) {
+	certFile, keyFile := ft.TLS.Cert, ft.TLS.Key
+	if certFile == "" || keyFile == "" {
+		homeDir, _ := os.UserHomeDir()
+		dir := filepath.Join(homeDir, constants.DefaultConfigDir, constants.TLSDirName)
+
+		var err error
+		if certFile, keyFile, err = web.EnsureSelfSignedCert(dir); err != nil {
+			return nil, fmt.Errorf("生成自签名证书失败: %v", err)
+		}
+		logger.LogInfo("🔒 使用自签名证书: %s", certFile)
+		if fingerprint, err := web.CertFingerprint(certFile); err == nil {
+			logger.LogInfo("🔒 证书指纹 (SHA-256): %s", fingerprint)
+			logger.LogInfo("   客户端可配置 tls.pin 固定该指纹")
+		}
+	} else {
+		logger.LogInfo("🔒 TLS证书: %s", certFile)
+	}
+
+	if ft.TLS.ClientCA != "" {
+		logger.LogInfo("🔒 已启用双向认证 (mTLS)")
+	}
+	return web.ServerTLSConfig(certFile, keyFile, ft.TLS.ClientCA)
+}
+
+// forwardClient 返回访问下一跳使用的共享HTTP客户端
+func (ft *FileTransfer) forwardClient() (*http.Client, error) {
+	ft.upstreamOnce.Do(func() {
+		tlsConfig, err := web.ClientTLSConfig(ft.TLS.CA, ft.TLS.Pin, ft.TLS.ClientCert, ft.TLS.ClientKey)
+		if err != nil {
+			ft.upstreamErr = err
+			return
+		}
+		ft.upstreamClient = web.CreateForwardClient(tlsConfig)
+		ft.upstreamEvents = web.CreateEventsClient(tlsConfig)
+	})
+	return ft.upstreamClient, ft.upstreamErr
+}
+
+// eventsClient 返回订阅下一跳事件流使用的共享HTTP客户端
+func (ft *FileTransfer) eventsClient() (*http.Client, error) {
+	if _, err := ft.forwardClient(); err != nil {
+		return nil, err
+	}
+	return ft.upstreamEvents, nil
 }
 
 // handleStatus 状态检查
@@ -102,13 +249,59 @@ func extractFileName(r *http.Request) string {
 // StreamUploadHandler 纯流式上传处理器（支持二进制流和FormData）
 func StreamUploadHandler(ft *FileTransfer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// HEAD 请求用于查询断点续传偏移
+		if r.Method == http.MethodHead {
+			handleOffsetQuery(ft, w, r)
+			return
+		}
+
 		if r.Method != http.MethodPost {
-			http.Error(w, "仅支持POST方法", http.StatusMethodNotAllowed)
+			writeError(w, r, http.StatusMethodNotAllowed, constants.ErrCodeMethodNotAllowed, "仅支持POST方法")
+			return
+		}
+		r = withRequestStart(r)
+
+		stats := ft.stats()
+		stats.active.Inc()
+		recorder := &statusRecorder{ResponseWriter: w}
+		w = recorder
+		defer func() {
+			stats.active.Dec()
+			stats.uploads.Inc(recorder.status())
+		}()
+
+		t, r, err := ft.transfers.begin(ft, w, r)
+		if err == errTransferExists {
+			writeError(w, r, http.StatusConflict, constants.ErrCodeUploadConflict, "传输ID正在使用: %s", r.Header.Get(constants.HeaderTransferID))
 			return
 		}
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "%v", err)
+			return
+		}
+		defer func() { ft.transfers.finish(t, recorder.code) }()
+		w.Header().Set(constants.HeaderTransferID, t.info.ID)
 
 		contentType := r.Header.Get("Content-Type")
-		
+
+		// 目录和符号链接条目（逐个文件上传目录时保留空目录和链接）
+		if r.Header.Get(constants.HeaderEntryType) != "" {
+			handleEntryUpload(ft, w, r)
+			return
+		}
+
+		// 目录的 tar 归档（gt send --archive）
+		if isArchiveUpload(r) {
+			handleArchiveUpload(ft, w, r)
+			return
+		}
+
+		// 以接收端已有文件为基准的差量上传（gt send --delta）
+		if isDeltaUpload(r) {
+			handleDeltaUpload(ft, w, r)
+			return
+		}
+
 		// 如果是multipart/form-data（浏览器文件上传）
 		if strings.HasPrefix(contentType, "multipart/form-data") {
 			handleMultipartUpload(ft, w, r)
@@ -120,79 +313,122 @@ func StreamUploadHandler(ft *FileTransfer) http.HandlerFunc {
 	}
 }
 
-// handleMultipartUpload 处理FormData上传（浏览器友好）
-func handleMultipartUpload(ft *FileTransfer, w http.ResponseWriter, r *http.Request) {
-	// 解析multipart表单，限制32MB内存
-	err := r.ParseMultipartForm(32 << 20)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("解析表单失败: %v", err), http.StatusBadRequest)
-		return
-	}
-	defer r.MultipartForm.RemoveAll()
-
-	// 获取文件
-	file, header, err := r.FormFile("file")
-	if err != nil {
-		http.Error(w, fmt.Sprintf("获取文件失败: %v", err), http.StatusBadRequest)
-		return
-	}
-	defer file.Close()
-
-	// 获取文件名（优先使用URL参数，否则使用上传的文件名）
-	fileName := extractFileName(r)
-	if fileName == fmt.Sprintf("upload_%d.bin", time.Now().Unix()) {
-		fileName = header.Filename
-	}
-
-	// 根据模式处理
-	switch ft.Mode {
-	case "receiver":
-		handleReceive(ft, w, file, fileName, header.Size, true)
-	case "forward":
-		handleForward(ft, w, file, fileName, header.Size, true)
-	default:
-		http.Error(w, "未知服务模式", http.StatusInternalServerError)
-	}
-}
-
 // handleBinaryUpload 处理二进制流上传（命令行友好）
 func handleBinaryUpload(ft *FileTransfer, w http.ResponseWriter, r *http.Request) {
 	fileName := extractFileName(r)
 
 	switch ft.Mode {
 	case "receiver":
-		handleReceive(ft, w, r.Body, fileName, r.ContentLength, false)
+		handleReceive(ft, w, r, r.Body, fileName, declaredLength(r), false)
 	case "forward":
-		handleForward(ft, w, r.Body, fileName, r.ContentLength, false)
+		handleForward(ft, w, r, r.Body, fileName, declaredLength(r), false)
 	default:
-		http.Error(w, "未知服务模式", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "未知服务模式")
 	}
 }
 
 // handleReceive 统一的接收处理函数
-func handleReceive(ft *FileTransfer, w http.ResponseWriter, reader io.Reader, fileName string, size int64, isFormData bool) {
+func handleReceive(ft *FileTransfer, w http.ResponseWriter, r *http.Request, reader io.Reader, fileName string, size int64, isFormData bool) {
+	// 客户端随请求头发送的权限和修改时间，在提交前设置
+	var meta fileMeta
+	if !isFormData {
+		var err error
+		if meta, err = ft.fileMeta(r); err != nil {
+			writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "%v", err)
+			return
+		}
+	}
+
+	// 分块并发上传的分块按偏移写入，单独处理
+	if !isFormData && r.Header.Get(constants.HeaderUploadID) != "" {
+		handleChunkReceive(ft, w, r, reader, fileName, size)
+		return
+	}
+
 	expandedPath := system.ExpandPath(ft.StoragePath)
 
-	// 处理带路径的文件名
-	systemFileName := filepath.FromSlash(fileName)
-	finalPath := filepath.Join(expandedPath, systemFileName)
+	// 处理带路径的文件名（拒绝目录穿越等不安全路径）
+	finalPath, err := resolveStoragePath(ft, fileName)
+	if err != nil {
+		logger.LogWarn("拒绝上传: %v", err)
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeInvalidPath, "%v", err)
+		return
+	}
+	if !allowPath(w, r, fileName) {
+		return
+	}
+	policy, err := ft.conflictPolicy(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "%v", err)
+		return
+	}
+	tempPath := stagingPath(finalPath)
 
-	// 如果文件名包含路径，创建目录
+	// 如果文件名包含路径，创建目录（不经过指向存储目录外的链接）
 	finalDir := filepath.Dir(finalPath)
 	if finalDir != expandedPath {
-		if err := os.MkdirAll(finalDir, constants.DirPermission); err != nil {
-			http.Error(w, fmt.Sprintf("创建目录失败: %v", err), http.StatusInternalServerError)
+		if err := ensureDir(expandedPath, finalDir); err != nil {
+			respondPathError(w, r, "创建目录失败", err)
+			return
+		}
+	}
+
+	// 解析续传范围（仅二进制流支持）
+	offset := int64(0)
+	total := size
+	value := r.Header.Get("Content-Range")
+	hasRange := value != "" && !isFormData
+	var rangeBody io.Reader
+	if hasRange {
+		cr, err := parseContentRange(value)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, constants.ErrCodeInvalidRange, "%v", err)
+			return
+		}
+		if size >= 0 && cr.End-cr.Start+1 != size {
+			writeError(w, r, http.StatusBadRequest, constants.ErrCodeInvalidRange, "Content-Range 与 Content-Length 不一致")
 			return
 		}
+
+		committed := committedOffset(finalPath)
+		if cr.Start != committed {
+			w.Header().Set(constants.HeaderUploadOffset, strconv.FormatInt(committed, 10))
+			writeError(w, r, http.StatusConflict, constants.ErrCodeOffsetMismatch, "续传偏移不匹配: 请求 %d, 已提交 %d", cr.Start, committed)
+			return
+		}
+		offset = cr.Start
+		total = cr.Total
+		rangeBody = reader
+		reader = io.LimitReader(reader, cr.End-cr.Start+1)
 	}
 
+	// 新上传时按冲突策略处理同名文件（续传的文件在提交时处理）
+	if offset == 0 && ft.rejectExisting(w, r, finalPath, fileName, policy) {
+		return
+	}
+
+	// 检查大小上限和存储空间，未声明长度时在传输中检查
+	incoming := int64(-1)
+	if total >= 0 {
+		incoming = total - offset
+	}
+	res, err := ft.admitUpload(total, incoming)
+	if err != nil {
+		respondLimit(w, r, fileName, err)
+		return
+	}
+	defer res.release()
+	reader = &guardReader{reader: reader, max: ft.MaxFileSize, offset: offset, res: res}
+
 	// 立即显示开始接收文件
 	sourceType := ""
 	if isFormData {
 		sourceType = " [FormData]"
 	}
 	
-	if size > 0 {
+	if offset > 0 {
+		logger.LogInfo("⬇️  续传接收: %s (从 %s 开始)%s", fileName, system.FormatSize(offset), sourceType)
+	} else if size > 0 {
 		sizeMB := float64(size) / 1024 / 1024
 		logger.LogInfo("⬇️  开始接收: %s (%.2f MB)%s", fileName, sizeMB, sourceType)
 	} else {
@@ -200,26 +436,81 @@ func handleReceive(ft *FileTransfer, w http.ResponseWriter, reader io.Reader, fi
 	}
 
 	// 检查文件是否已存在
-	if _, err := os.Stat(finalPath); err == nil {
-		logger.LogWarn("文件已存在，将被覆盖: %s", fileName)
+	if _, err := os.Stat(finalPath); err == nil && offset == 0 {
+		logger.LogWarn("文件已存在: %s（冲突策略: %s）", fileName, policy)
+	}
+	if offset == 0 {
+		// 重新上传时放弃同名文件未完成的分块上传
+		ft.chunks.discard(finalPath)
 	}
 
-	// 创建目标文件（如果存在则覆盖）
-	outFile, err := os.Create(finalPath)
+	// 边接收边计算摘要，算法以客户端声明的为准
+	expected := ""
+	if !isFormData {
+		expected = r.Header.Get(constants.HeaderContentDigest)
+	}
+	algorithm := digest.DefaultAlgorithm
+	if expected != "" {
+		if algorithm, _, err = digest.Parse(expected); err != nil {
+			writeError(w, r, http.StatusBadRequest, constants.ErrCodeBadRequest, "%v", err)
+			return
+		}
+	}
+	hasher, _ := digest.New(algorithm)
+	if offset > 0 {
+		if err := hashFile(hasher, tempPath); err != nil {
+			writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "读取暂存文件失败: %v", err)
+			return
+		}
+	}
+
+	// 续传时追加到暂存文件，否则重新创建
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_WRONLY | os.O_APPEND
+	}
+	outFile, err := os.OpenFile(tempPath, flags, constants.FilePermission)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("创建文件失败: %v", err), http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "创建文件失败: %v", err)
 		return
 	}
 	defer outFile.Close()
 
 	// 创建进度跟踪的Writer
 	progressWriter := progress.NewProgressWriter(outFile, size, "接收进度")
+	progressWriter.SetHasher(hasher)
+	transferFrom(r).attach(fileName, progressWriter)
 
 	// 流式复制 - 带进度跟踪
 	written, err := io.Copy(progressWriter, reader)
+	ft.stats().received.Add(float64(written))
 	if err != nil {
-		os.Remove(finalPath)
-		http.Error(w, fmt.Sprintf("写入文件失败: %v", err), http.StatusInternalServerError)
+		var le *limitError
+		if errors.As(err, &le) {
+			// 超出限制的数据不保留
+			outFile.Close()
+			os.Remove(tempPath)
+			fmt.Println()
+			respondLimit(w, r, fileName, err)
+			return
+		}
+		if transferFrom(r).isCancelled() {
+			// 取消的上传不保留暂存文件
+			outFile.Close()
+			os.Remove(tempPath)
+			respondCancelled(w, r, fileName)
+			return
+		}
+		if ft.discardAborted() {
+			outFile.Close()
+			os.Remove(tempPath)
+			logger.LogWarn("服务停止，已删除未完成的上传: %s", fileName)
+			writeError(w, r, http.StatusServiceUnavailable, constants.ErrCodeShuttingDown, "服务正在停止，上传已中止")
+			return
+		}
+		// 保留暂存文件，客户端可从已提交的偏移继续上传
+		logger.LogWarn("传输中断，已保留 %s 供续传: %s", system.FormatSize(offset+written), fileName)
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "写入文件失败: %v", err)
 		return
 	}
 
@@ -227,18 +518,122 @@ func handleReceive(ft *FileTransfer, w http.ResponseWriter, reader io.Reader, fi
 	progressWriter.PrintProgress()
 	fmt.Println() // 换行
 
+	// 范围内数据读完后确认请求体已结束（同时使trailer可用）
+	if rangeBody != nil {
+		if n, _ := io.Copy(io.Discard, io.LimitReader(rangeBody, 1)); n > 0 {
+			writeError(w, r, http.StatusBadRequest, constants.ErrCodeInvalidRange, "数据超出 Content-Range 声明的范围")
+			return
+		}
+	}
+
+	received := offset + written
+	if total >= 0 && received != total {
+		// 分段提交：尚未收齐，告知客户端新的偏移
+		if hasRange && received < total {
+			w.Header().Set(constants.HeaderUploadOffset, strconv.FormatInt(received, 10))
+			resp := &uploadResponse{
+				Status:  constants.UploadStatusPartial,
+				Name:    fileName,
+				Bytes:   received,
+				Total:   total,
+				Message: fmt.Sprintf("已接收部分数据: %s (%d/%d bytes)", fileName, received, total),
+			}
+			resp.setTiming(requestStart(r), written)
+			ft.writeUpload(w, r, http.StatusAccepted, resp)
+			return
+		}
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeIncomplete, "数据不完整: 已接收 %d / %d bytes", received, total)
+		return
+	}
+
+	// 校验摘要（请求头或trailer），不一致时隔离文件
+	if expected == "" && !isFormData {
+		expected = r.Trailer.Get(constants.HeaderContentDigest)
+	}
+	actual := digest.Format(algorithm, hasher)
+	if expected != "" {
+		if err := verifyDigest(expected, actual); err != nil {
+			outFile.Close()
+			if target, qerr := quarantine(expandedPath, tempPath, finalPath); qerr == nil {
+				logger.LogError("校验失败，文件已隔离: %s → %s (%v)", fileName, target, err)
+			} else {
+				os.Remove(tempPath)
+				logger.LogError("校验失败，文件已删除: %s (%v)", fileName, err)
+			}
+			w.Header().Set(constants.HeaderContentDigest, actual)
+			writeError(w, r, http.StatusUnprocessableEntity, constants.ErrCodeDigestMismatch, "完整性校验失败: %v", err)
+			return
+		}
+	}
+
+	// 全部数据到达后，按冲突策略落盘并原子地替换为最终文件
+	meta.apply(tempPath, false)
+	target, result, err := ft.commitUpload(outFile, finalPath, policy)
+	if err == errFileExists {
+		respondExists(w, r, fileName)
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "保存文件失败: %v", err)
+		return
+	}
+	if result == constants.ResultSkipped {
+		ft.respondSkipped(w, r, fileName)
+		return
+	}
+	ft.rememberDigest(target, actual)
+	stored := ft.setStoreResult(w, target, result)
+	if stored != fileName {
+		logger.LogInfo("📝 同名文件已存在，另存为: %s", stored)
+	}
+
 	// 计算传输速度
 	speed := progressWriter.GetSpeed()
 	speedMB := speed / 1024 / 1024
 	writtenMB := float64(written) / 1024 / 1024
 	
-	logger.LogSuccess("文件已保存: %s (%.2f MB, %.2f MB/s)", fileName, writtenMB, speedMB)
-	fmt.Fprintf(w, "文件上传成功: %s (%d bytes)", fileName, written)
+	if expected != "" {
+		logger.LogSuccess("文件已保存: %s (%.2f MB, %.2f MB/s, 校验通过)", fileName, writtenMB, speedMB)
+	} else {
+		logger.LogSuccess("文件已保存: %s (%.2f MB, %.2f MB/s)", fileName, writtenMB, speedMB)
+	}
+	w.Header().Set(constants.HeaderContentDigest, actual)
+	resp := &uploadResponse{
+		Status:  constants.UploadStatusOK,
+		Name:    fileName,
+		Stored:  stored,
+		Bytes:   received,
+		Digest:  actual,
+		Result:  result,
+		Message: fmt.Sprintf("文件上传成功: %s (%d bytes, %s, %s)", stored, received, actual, result),
+	}
+	resp.setTiming(requestStart(r), written)
+	ft.stats().observeUpload(requestStart(r), written)
+	ft.writeUpload(w, r, http.StatusOK, resp)
 }
 
 // handleForward 统一的转发处理函数
-func handleForward(ft *FileTransfer, w http.ResponseWriter, reader io.Reader, fileName string, size int64, isFormData bool) {
+func handleForward(ft *FileTransfer, w http.ResponseWriter, r *http.Request, reader io.Reader, fileName string, size int64, isFormData bool) {
 	targetURL := ft.TargetURL
+	if !allowPath(w, r, fileName) {
+		return
+	}
+	// 归档中各文件的大小由接收端解压时检查
+	archive := !isFormData && isArchiveUpload(r)
+	delta := !isFormData && isDeltaUpload(r)
+	maxSize := ft.MaxFileSize
+	if archive {
+		maxSize = 0
+	}
+	if maxSize > 0 && size > maxSize {
+		respondLimit(w, r, fileName, errTooLarge(size, maxSize))
+		return
+	}
+	if delta {
+		// 差量流的长度与文件大小无关，重建后的大小由接收端检查
+		maxSize = 0
+	}
+	reader = &guardReader{reader: reader, max: maxSize}
 
 	// 立即显示开始转发
 	sourceType := ""
@@ -257,8 +652,53 @@ func handleForward(ft *FileTransfer, w http.ResponseWriter, reader io.Reader, fi
 
 	// 创建管道，实现零缓存流式转发
 	pipeReader, pipeWriter := io.Pipe()
-	errChan := make(chan error, 2)
+	copyErrChan := make(chan error, 1)
+	forwardErrChan := make(chan error, 1)
 	transferredBytes := int64(0)
+	upstreamStatus := 0
+
+	// 创建转发请求（保留原始查询参数，文件名以解析结果为准）
+	query := r.URL.Query()
+	query.Set("name", fileName)
+	req, err := http.NewRequestWithContext(r.Context(), "POST", targetURL+"/upload?"+query.Encode(), pipeReader)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "创建转发请求失败: %v", err)
+		return
+	}
+
+	// 设置请求头
+	if size >= 0 {
+		req.Header.Set(constants.HeaderContentLength, strconv.FormatInt(size, 10))
+	}
+	req.Header.Set("X-File-Name", fileName)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if archive || delta {
+		// 归档和差量流原样转发，由接收端解压或重建
+		copyHeaders(req.Header, r.Header, "Content-Type", "Content-Encoding")
+	}
+	// 下一跳始终返回 JSON，由本节点加入节点信息后按客户端协商的格式输出
+	req.Header.Set("Accept", "application/json")
+	ft.setUpstreamAuth(req)
+	if t := transferFrom(r); t != nil {
+		// 下一跳使用相同的传输ID，以便转发其进度事件
+		req.Header.Set(constants.HeaderTransferID, t.info.ID)
+	}
+	if r.Header.Get(constants.HeaderOnConflict) == "" && ft.OnConflict != "" {
+		// 客户端未指定时使用本节点配置的策略
+		req.Header.Set(constants.HeaderOnConflict, ft.OnConflict)
+	}
+	withTrailer := !isFormData && expectsDigestTrailer(r)
+	if withTrailer {
+		// 摘要以trailer形式到达，需使用分块编码原样传递
+		req.Trailer = http.Header{constants.HeaderContentDigest: nil}
+	} else if size > 0 && !delta {
+		req.ContentLength = size
+	}
+	if !isFormData {
+		copyHeaders(req.Header, r.Header, "Content-Range", constants.HeaderContentDigest, constants.HeaderUploadID, constants.HeaderFileDigest,
+			constants.HeaderFileMode, constants.HeaderFileMtime, constants.HeaderEntryType, constants.HeaderLinkTarget, constants.HeaderDeltaBase)
+	}
+	copyHeaders(req.Header, r.Header, constants.HeaderOnConflict)
 
 	// 协程1: 从客户端读取，写入管道（带进度跟踪）
 	go func() {
@@ -266,10 +706,7 @@ func handleForward(ft *FileTransfer, w http.ResponseWriter, reader io.Reader, fi
 
 		// 创建进度跟踪的Writer
 		progressPipe := progress.NewProgressWriter(pipeWriter, size, "上传进度")
-		defer func() {
-			current, _, _ := progressPipe.GetProgress()
-			transferredBytes = current
-		}()
+		transferFrom(r).attach(fileName, progressPipe)
 
 		// 选择合适的缓冲区大小
 		bufferSize := constants.SmallBufferSize  // 256KB for streaming
@@ -279,63 +716,79 @@ func handleForward(ft *FileTransfer, w http.ResponseWriter, reader io.Reader, fi
 		
 		buffer := make([]byte, bufferSize)
 		_, err := io.CopyBuffer(progressPipe, reader, buffer)
-		errChan <- err
+		if err == nil && withTrailer {
+			// 请求体读完后trailer才可用，须在关闭管道前设置
+			req.Trailer.Set(constants.HeaderContentDigest, r.Trailer.Get(constants.HeaderContentDigest))
+		}
+		if err != nil {
+			// 中断转发请求，避免下一跳把截断的数据当作完整文件
+			pipeWriter.CloseWithError(err)
+		}
+		// 在发送结果前记录字节数，主协程收到结果后读取
+		transferredBytes, _, _ = progressPipe.GetProgress()
+		copyErrChan <- err
 	}()
 
 	// 协程2: 从管道读取，转发到目标服务器
 	go func() {
-		// 创建转发请求
-		req, err := http.NewRequest("POST", targetURL+"/upload?name="+fileName, pipeReader)
+		// 使用统一的HTTP客户端
+		client, err := ft.forwardClient()
 		if err != nil {
-			errChan <- fmt.Errorf("创建转发请求失败: %v", err)
+			pipeReader.CloseWithError(err)
+			forwardErrChan <- fmt.Errorf("创建转发客户端失败: %v", err)
 			return
 		}
-
-		// 设置请求头
-		if size > 0 {
-			req.ContentLength = size
-			req.Header.Set("Content-Length", fmt.Sprintf("%d", size))
-		}
-		req.Header.Set("X-File-Name", fileName)
-		req.Header.Set("Content-Type", "application/octet-stream")
-
-		// 使用统一的HTTP客户端
-		client := web.CreateForwardClient()
 		resp, err := client.Do(req)
 		if err != nil {
-			errChan <- fmt.Errorf("转发失败: %v", err)
+			ft.stats().forwardErrors.Inc("network")
+			forwardErrChan <- fmt.Errorf("转发失败: %v", err)
 			return
 		}
 		defer resp.Body.Close()
+		upstreamStatus = resp.StatusCode
+		if resp.StatusCode >= http.StatusBadRequest {
+			ft.stats().forwardErrors.Inc(strconv.Itoa(resp.StatusCode))
+		}
 
-		// 将目标服务器的响应流式返回给客户端
-		w.WriteHeader(resp.StatusCode)
-		buffer := make([]byte, constants.LargeBufferSize)
-		io.CopyBuffer(w, resp.Body, buffer)
-		errChan <- nil
+		// 将目标服务器的响应返回给客户端
+		ft.relayUpload(w, r, resp)
+		forwardErrChan <- nil
 	}()
 
 	// 等待两个协程完成
-	err1 := <-errChan
-	err2 := <-errChan
+	copyErr := <-copyErrChan
+	forwardErr := <-forwardErrChan
 
 	// 换行结束进度条
 	fmt.Println()
 
 	duration := time.Since(startTime)
 	speed := float64(transferredBytes) / duration.Seconds() / 1024 / 1024
+	ft.stats().forwarded.Add(float64(transferredBytes))
 
-	if err1 != nil {
-		logger.LogError("转发失败: %v", err1)
-		if err2 == nil {
-			http.Error(w, err1.Error(), http.StatusBadGateway)
+	if forwardErr != nil {
+		// 下一跳未返回响应，由本节点返回错误（超过大小上限时返回 413）
+		if !respondLimit(w, r, fileName, copyErr) && !respondCancelled(w, r, fileName) {
+			logger.LogError("转发失败: %v", forwardErr)
+			writeError(w, r, http.StatusBadGateway, constants.ErrCodeUpstream, "%v", forwardErr)
 		}
-	} else if err2 != nil {
-		logger.LogError("转发失败: %v", err2)
+	} else if copyErr != nil {
+		logger.LogError("转发失败: %v", copyErr)
 	} else {
 		transferredMB := float64(transferredBytes) / 1024 / 1024
 		logger.LogSuccess("成功转发: %s (%.2f MB, %.2f MB/s, 耗时 %.1fs)",
 			fileName, transferredMB, speed, duration.Seconds())
+		if upstreamStatus < http.StatusBadRequest {
+			ft.stats().observeUpload(startTime, transferredBytes)
+		}
 	}
 }
 
+// copyHeaders 复制指定的请求/响应头
+func copyHeaders(dst, src http.Header, keys ...string) {
+	for _, key := range keys {
+		if value := src.Get(key); value != "" {
+			dst.Set(key, value)
+		}
+	}
+}
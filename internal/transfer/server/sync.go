@@ -0,0 +1,230 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/digest"
+	"go-transfer/internal/infrastructure/logger"
+	"go-transfer/internal/infrastructure/system"
+)
+
+// manifestEntry 目录清单中的一项
+type manifestEntry struct {
+	Name    string    `json:"name"`             // 相对存储目录的路径，目录以 / 结尾
+	Type    string    `json:"type"`             // file、dir 或 symlink
+	Size    int64     `json:"size"`             // 文件大小
+	ModTime time.Time `json:"mtime"`            // 修改时间
+	Digest  string    `json:"digest,omitempty"` // 文件摘要（已知或按 checksum 参数计算时）
+	Target  string    `json:"target,omitempty"` // 符号链接的目标
+}
+
+// manifest GET /manifest 的响应
+type manifest struct {
+	Prefix  string          `json:"prefix"`
+	Entries []manifestEntry `json:"entries"`
+}
+
+// handleManifest 处理 GET /manifest?prefix=&checksum=：递归列出目录中已完成的文件、子目录和符号链接（不分页），
+// 供客户端增量同步时比较。checksum=true 时为尚无摘要的文件计算摘要并记录
+func (ft *FileTransfer) handleManifest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "仅支持GET方法", http.StatusMethodNotAllowed)
+		return
+	}
+	if ft.Mode == "forward" {
+		ft.proxyGet(w, r, nil, []string{"Content-Type"})
+		return
+	}
+	if ft.Mode != "receiver" {
+		http.Error(w, "未知服务模式", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	prefix := strings.Trim(strings.ReplaceAll(query.Get("prefix"), `\`, "/"), "/")
+	checksum, _ := strconv.ParseBool(query.Get("checksum"))
+	root := system.ExpandPath(ft.StoragePath)
+	baseDir := root
+	if prefix != "" {
+		if !allowPath(w, r, prefix) {
+			return
+		}
+		joined, err := resolveStoragePath(ft, prefix)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		baseDir = joined
+	}
+
+	entries, err := ft.manifestEntries(r, root, baseDir, checksum)
+	if err != nil && !os.IsNotExist(err) {
+		http.Error(w, "读取目录失败: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	if entries == nil {
+		entries = []manifestEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manifest{Prefix: prefix, Entries: entries})
+}
+
+// manifestEntries 遍历 baseDir（不跟随符号链接），跳过暂存文件、隔离和版本目录
+func (ft *FileTransfer) manifestEntries(r *http.Request, root, baseDir string, checksum bool) ([]manifestEntry, error) {
+	var entries []manifestEntry
+	err := filepath.Walk(baseDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if p == baseDir {
+				return err
+			}
+			return nil
+		}
+		if p == baseDir && info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		entry := manifestEntry{Name: rel, ModTime: info.ModTime()}
+		switch {
+		case info.IsDir():
+			if isReservedDir(rel) {
+				return filepath.SkipDir
+			}
+			if !pathAllowed(r, rel, true) {
+				return filepath.SkipDir
+			}
+			entry.Name, entry.Type = rel+"/", "dir"
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return nil
+			}
+			entry.Type, entry.Target = "symlink", target
+		case info.Mode().IsRegular() && !isStagingFile(info.Name()):
+			entry.Type, entry.Size = "file", info.Size()
+			entry.Digest = ft.knownDigest(p, info)
+			if entry.Digest == "" && checksum {
+				entry.Digest = ft.computeDigest(p)
+			}
+		default:
+			return nil
+		}
+		if pathAllowed(r, rel, entry.Type == "dir") {
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// computeDigest 计算已有文件的摘要并记录，失败时返回空
+func (ft *FileTransfer) computeDigest(finalPath string) string {
+	hasher, _ := digest.New(digest.DefaultAlgorithm)
+	if err := hashFile(hasher, finalPath); err != nil {
+		logger.LogWarn("计算摘要失败: %v", err)
+		return ""
+	}
+	sum := digest.Format(digest.DefaultAlgorithm, hasher)
+	ft.rememberDigest(finalPath, sum)
+	return sum
+}
+
+// handleDelete 处理 DELETE /files/{path}：接收模式删除文件、符号链接或空目录，转发模式转发到下一跳
+func (ft *FileTransfer) handleDelete(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, constants.FilesRoute)
+	if !allowPath(w, r, name) {
+		return
+	}
+
+	switch ft.Mode {
+	case "receiver":
+		ft.deleteEntry(w, r, name)
+	case "forward":
+		ft.forwardDelete(w, r)
+	default:
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "未知服务模式")
+	}
+}
+
+// deleteEntry 删除存储目录中的条目。目录须为空，符号链接只删除链接本身；
+// 所在目录须解析到存储目录之内，不经过指向外部的链接删除文件
+func (ft *FileTransfer) deleteEntry(w http.ResponseWriter, r *http.Request, name string) {
+	finalPath, err := resolveStoragePath(ft, name)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeInvalidPath, "%v", err)
+		return
+	}
+	info, err := os.Lstat(finalPath)
+	if os.IsNotExist(err) {
+		writeError(w, r, http.StatusNotFound, constants.ErrCodeNotFound, "文件不存在: %s", name)
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "读取文件信息失败: %v", err)
+		return
+	}
+	if !resolvesInside(system.ExpandPath(ft.StoragePath), filepath.Dir(finalPath)) {
+		writeError(w, r, http.StatusBadRequest, constants.ErrCodeInvalidPath, "%v: 经过指向存储目录外的链接 %q", errUnsafePath, name)
+		return
+	}
+	if info.IsDir() {
+		if children, err := os.ReadDir(finalPath); err != nil || len(children) > 0 {
+			writeError(w, r, http.StatusConflict, constants.ErrCodeDirNotEmpty, "目录非空: %s", name)
+			return
+		}
+	}
+	if err := os.Remove(finalPath); err != nil {
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "删除失败: %v", err)
+		return
+	}
+	ft.digests.Delete(finalPath)
+
+	logger.LogInfo("🗑️  已删除: %s", name)
+	resp := &uploadResponse{
+		Status:  constants.UploadStatusOK,
+		Name:    name,
+		Result:  constants.ResultDeleted,
+		Message: "已删除: " + name,
+	}
+	resp.setTiming(requestStart(r), 0)
+	ft.writeUpload(w, r, http.StatusOK, resp)
+}
+
+// forwardDelete 将删除请求转发到下一跳并转回响应
+func (ft *FileTransfer) forwardDelete(w http.ResponseWriter, r *http.Request) {
+	req, err := http.NewRequest(http.MethodDelete, ft.TargetURL+r.URL.RequestURI(), nil)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "创建转发请求失败: %v", err)
+		return
+	}
+	copyHeaders(req.Header, r.Header, "Accept")
+	ft.setUpstreamAuth(req)
+
+	client, err := ft.forwardClient()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, constants.ErrCodeInternal, "创建转发客户端失败: %v", err)
+		return
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.LogError("转发失败: %v", err)
+		writeError(w, r, http.StatusBadGateway, constants.ErrCodeUpstream, "转发失败: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	ft.relayUpload(w, r, resp)
+}
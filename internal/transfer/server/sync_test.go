@@ -0,0 +1,136 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-transfer/internal/config"
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+)
+
+// fetchManifest 经 handler 获取目录清单
+func fetchManifest(t *testing.T, handler http.Handler, query string) []manifestEntry {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, constants.ManifestRoute+"?"+query, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s 状态码 = %d: %s", query, rec.Code, rec.Body.String())
+	}
+	var m manifest
+	if err := json.Unmarshal(rec.Body.Bytes(), &m); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	return m.Entries
+}
+
+// syncTree 在存储目录中创建同步测试用的目录树
+func syncTree(t *testing.T, storage string) {
+	t.Helper()
+	for _, name := range []string{"a.txt", "p/b.txt", "p/sub/c.txt", constants.VersionsDir + "/p/b.txt.1", constants.QuarantineDir + "/a.txt.1"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(storage, name)), 0755)
+		os.WriteFile(filepath.Join(storage, name), []byte("data"), 0644)
+	}
+	os.WriteFile(filepath.Join(storage, "p", ".d.txt.gtpart"), []byte("da"), 0644)
+	os.Mkdir(filepath.Join(storage, "p", "empty"), 0755)
+	os.Symlink("b.txt", filepath.Join(storage, "p", "link"))
+}
+
+func TestManifestThroughForward(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	syncTree(t, storage)
+	receiver := &FileTransfer{Mode: "receiver", StoragePath: storage}
+	next := httptest.NewServer(receiver.routes())
+	defer next.Close()
+	forward := (&FileTransfer{Mode: "forward", TargetURL: next.URL}).routes()
+
+	entries := fetchManifest(t, forward, "prefix=p")
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Name+":"+entry.Type)
+	}
+	want := []string{"p/b.txt:file", "p/empty/:dir", "p/link:symlink", "p/sub/:dir", "p/sub/c.txt:file"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("清单 = %v, 期望 %v", got, want)
+	}
+	if entries[0].Size != 4 || entries[0].Digest != "" || entries[2].Target != "b.txt" {
+		t.Errorf("清单条目 = %+v", entries)
+	}
+
+	sum := sha256.Sum256([]byte("data"))
+	if entries := fetchManifest(t, forward, "prefix=p&checksum=true"); entries[0].Digest != "sha256="+hex.EncodeToString(sum[:]) {
+		t.Errorf("checksum=true 时的摘要 = %q", entries[0].Digest)
+	}
+	// 计算过的摘要被记录，之后的清单直接返回
+	if entries := fetchManifest(t, forward, "prefix=p/sub"); entries[0].Digest == "" {
+		t.Errorf("记录的摘要未返回: %+v", entries[0])
+	}
+	if entries := fetchManifest(t, forward, "prefix=missing"); len(entries) != 0 {
+		t.Errorf("不存在的目录 = %+v", entries)
+	}
+
+	// 旧版本和隔离目录不出现在清单中，也不能作为前缀
+	for _, entry := range fetchManifest(t, forward, "") {
+		if isReservedDir(strings.TrimSuffix(strings.SplitN(entry.Name, "/", 2)[0], "/")) {
+			t.Errorf("清单包含保留目录: %s", entry.Name)
+		}
+	}
+	rec := httptest.NewRecorder()
+	forward.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, constants.ManifestRoute+"?prefix="+constants.VersionsDir, nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("以保留目录为前缀的清单状态码 = %d", rec.Code)
+	}
+}
+
+func TestDeleteEntry(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	syncTree(t, storage)
+	ft := &FileTransfer{Mode: "receiver", StoragePath: storage, Tokens: []config.APIToken{
+		{Token: "reader", Scopes: []string{scopeRead}},
+		{Token: "writer"},
+	}}
+	routes := ft.routes()
+
+	del := func(name, token string) int {
+		req := httptest.NewRequest(http.MethodDelete, constants.FilesRoute+name, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	cases := []struct {
+		name, token string
+		want        int
+	}{
+		{"p/b.txt", "reader", http.StatusForbidden},
+		{"p/link", "writer", http.StatusOK},
+		{"p/b.txt", "writer", http.StatusOK},
+		{"p/b.txt", "writer", http.StatusNotFound},
+		{"p/sub", "writer", http.StatusConflict},
+		{"p/empty", "writer", http.StatusOK},
+		{"p/.d.txt.gtpart", "writer", http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		if code := del(c.name, c.token); code != c.want {
+			t.Errorf("DELETE %s (%s) = %d, 期望 %d", c.name, c.token, code, c.want)
+		}
+	}
+	for _, name := range []string{"p/b.txt", "p/link", "p/empty"} {
+		if _, err := os.Lstat(filepath.Join(storage, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Errorf("%s 未删除: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(storage, "p", "sub", "c.txt")); err != nil {
+		t.Errorf("非空目录中的文件不应删除: %v", err)
+	}
+}
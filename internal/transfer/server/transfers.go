@@ -0,0 +1,346 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+	"go-transfer/internal/infrastructure/progress"
+)
+
+// transferInfo GET /transfers 返回的传输信息
+type transferInfo struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`               // 请求的文件名
+	Remote     string     `json:"remote"`             // 客户端地址
+	Mode       string     `json:"mode"`               // receiver 或 forward
+	Upstream   string     `json:"upstream,omitempty"` // 转发模式的下一跳
+	State      string     `json:"state"`              // running、completed、failed、cancelled
+	Code       int        `json:"code,omitempty"`     // 已结束时的响应状态码
+	Bytes      int64      `json:"bytes"`              // 已传输的字节数
+	Total      int64      `json:"total"`              // 数据总大小，-1 表示未知
+	Speed      float64    `json:"speed"`              // 平均速度（字节/秒）
+	ETASeconds int64      `json:"eta_seconds"`        // 预计剩余时间（秒），未知时为 0
+	Started    time.Time  `json:"started"`
+	Finished   *time.Time `json:"finished,omitempty"`
+	Stored     string     `json:"stored,omitempty"` // 实际保存的相对路径（完成时）
+	Digest     string     `json:"digest,omitempty"` // 接收端计算的摘要（完成时）
+	Error      string     `json:"error,omitempty"`  // 失败时的错误码
+	Message    string     `json:"message,omitempty"`
+}
+
+// transfer 进行中或最近结束的上传
+type transfer struct {
+	mu        sync.Mutex
+	info      transferInfo
+	progress  *progress.Progress // 数据开始传输后由处理函数设置
+	cancelled bool
+	release   context.CancelFunc // 释放请求上下文
+	cancel    func()             // 中止请求：取消上下文并使读取请求体立即失败
+	done      chan struct{}      // 传输结束时关闭
+}
+
+// transferKey 请求上下文中保存传输记录的键
+type transferKey struct{}
+
+// transferFrom 返回请求对应的传输记录，未登记时为 nil
+func transferFrom(r *http.Request) *transfer {
+	t, _ := r.Context().Value(transferKey{}).(*transfer)
+	return t
+}
+
+// attach 开始传输数据时登记文件名和进度
+func (t *transfer) attach(name string, p *progress.Progress) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.info.Name = name
+	t.progress = p
+}
+
+// setResult 记录上传响应中的结果
+func (t *transfer) setResult(resp *uploadResponse) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.info.Stored, t.info.Digest, t.info.Message = resp.Stored, resp.Digest, resp.Message
+	if resp.Error != nil {
+		t.info.Error = resp.Error.Code
+	}
+}
+
+// isCancelled 判断传输是否已被取消
+func (t *transfer) isCancelled() bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cancelled
+}
+
+// snapshot 返回当前的传输信息，结束后的信息不再变化
+func (t *transfer) snapshot() transferInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	info := t.info
+	if info.State == constants.TransferRunning && t.progress != nil {
+		info.Bytes, info.Total, _ = t.progress.GetProgress()
+		info.Speed = t.progress.GetSpeed()
+		info.ETASeconds = int64(t.progress.GetETA().Seconds())
+	}
+	return info
+}
+
+// transferRegistry 进行中的传输和最近结束的传输
+type transferRegistry struct {
+	mu     sync.Mutex
+	active map[string]*transfer
+	recent []*transfer // 最近结束的传输，最新的在后
+}
+
+// newTransferID 生成传输ID
+func newTransferID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// errTransferExists 请求指定的传输ID正在使用
+var errTransferExists = errors.New("传输ID正在使用")
+
+// begin 登记新的上传请求，返回带传输记录的请求。客户端可通过 X-Transfer-Id 指定ID（转发节点以此让下一跳使用相同的ID），
+// w 用于取消时中断读取请求体
+func (tr *transferRegistry) begin(ft *FileTransfer, w http.ResponseWriter, r *http.Request) (*transfer, *http.Request, error) {
+	id := r.Header.Get(constants.HeaderTransferID)
+	if id == "" {
+		id = newTransferID()
+	} else if !validUploadID(id) {
+		return nil, r, fmt.Errorf("无效的传输ID: %q", id)
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	t := &transfer{
+		done: make(chan struct{}),
+		info: transferInfo{
+			ID:      id,
+			Name:    r.URL.Query().Get("name"),
+			Remote:  r.RemoteAddr,
+			Mode:    ft.Mode,
+			State:   constants.TransferRunning,
+			Total:   declaredLength(r),
+			Started: time.Now(),
+		},
+	}
+	if ft.Mode == "forward" {
+		t.info.Upstream = ft.TargetURL
+	}
+	t.release = cancel
+	t.cancel = func() {
+		cancel()
+		http.NewResponseController(w).SetReadDeadline(time.Now())
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if _, exists := tr.active[id]; exists {
+		cancel()
+		return nil, r, errTransferExists
+	}
+	if tr.active == nil {
+		tr.active = make(map[string]*transfer)
+	}
+	tr.active[id] = t
+	return t, r.WithContext(context.WithValue(ctx, transferKey{}, t)), nil
+}
+
+// finish 按响应状态码结束传输，移入最近结束的列表
+func (tr *transferRegistry) finish(t *transfer, code int) {
+	info := t.snapshot()
+	now := time.Now()
+
+	t.mu.Lock()
+	t.info.Bytes, t.info.Total, t.info.Speed = info.Bytes, info.Total, info.Speed
+	t.info.ETASeconds = 0
+	t.info.Code = code
+	t.info.Finished = &now
+	switch {
+	case t.cancelled:
+		t.info.State = constants.TransferCancelled
+	case code >= http.StatusBadRequest:
+		t.info.State = constants.TransferFailed
+	default:
+		t.info.State = constants.TransferCompleted
+	}
+	t.mu.Unlock()
+	t.release()
+	close(t.done)
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	delete(tr.active, t.info.ID)
+	tr.recent = append(tr.recent, t)
+	if len(tr.recent) > constants.RecentTransfers {
+		tr.recent = tr.recent[len(tr.recent)-constants.RecentTransfers:]
+	}
+}
+
+// get 按ID查找传输
+func (tr *transferRegistry) get(id string) *transfer {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if t, ok := tr.active[id]; ok {
+		return t
+	}
+	for i := len(tr.recent) - 1; i >= 0; i-- {
+		if t := tr.recent[i]; t.info.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// list 返回进行中的传输（按开始时间）和最近结束的传输（最新的在前）
+func (tr *transferRegistry) list() []*transfer {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	list := make([]*transfer, 0, len(tr.active)+len(tr.recent))
+	for _, t := range tr.active {
+		list = append(list, t)
+	}
+	for i := len(tr.recent) - 1; i >= 0; i-- {
+		list = append(list, tr.recent[i])
+	}
+	return list
+}
+
+// cancelTransfer 取消进行中的传输，已结束时返回 false
+func (tr *transferRegistry) cancelTransfer(t *transfer) bool {
+	t.mu.Lock()
+	if t.info.State != constants.TransferRunning || t.cancelled {
+		t.mu.Unlock()
+		return false
+	}
+	t.cancelled = true
+	t.mu.Unlock()
+	t.cancel()
+	return true
+}
+
+// handleTransfers 处理 GET /transfers：列出进行中和最近结束的传输（只包含令牌允许访问的路径）
+func (ft *FileTransfer) handleTransfers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "仅支持GET方法", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var running, finished []transferInfo
+	for _, t := range ft.transfers.list() {
+		info := t.snapshot()
+		if !pathAllowed(r, info.Name, false) {
+			continue
+		}
+		if info.State == constants.TransferRunning {
+			running = append(running, info)
+		} else {
+			finished = append(finished, info)
+		}
+	}
+	sort.Slice(running, func(i, j int) bool { return running[i].Started.Before(running[j].Started) })
+	infos := append(running, finished...)
+	if infos == nil {
+		infos = []transferInfo{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"transfers": infos})
+}
+
+// handleTransfer 处理 /transfers/{id}：GET 查看传输，DELETE 取消进行中的传输；
+// /transfers/{id}/events 为传输进度的 SSE 事件流
+func (ft *FileTransfer) handleTransfer(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, constants.EventsSuffix) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "仅支持GET方法", http.StatusMethodNotAllowed)
+			return
+		}
+		ft.withAuth(scopeRead, ft.handleEvents)(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		ft.withAuth(scopeRead, ft.showTransfer)(w, r)
+	case http.MethodDelete:
+		ft.withAuth(scopeWrite, ft.deleteTransfer)(w, r)
+	default:
+		http.Error(w, "仅支持GET和DELETE方法", http.StatusMethodNotAllowed)
+	}
+}
+
+// transferID 返回请求路径中的传输ID
+func transferID(r *http.Request) string {
+	id := strings.TrimPrefix(r.URL.Path, constants.TransfersRoute+"/")
+	return strings.TrimSuffix(id, constants.EventsSuffix)
+}
+
+// lookupTransfer 查找路径中的传输，不存在或令牌不允许访问时写入404响应
+func (ft *FileTransfer) lookupTransfer(w http.ResponseWriter, r *http.Request) *transfer {
+	if t := ft.transfers.get(transferID(r)); t != nil && pathAllowed(r, t.snapshot().Name, false) {
+		return t
+	}
+	http.Error(w, "传输不存在", http.StatusNotFound)
+	return nil
+}
+
+// showTransfer 返回单个传输的信息
+func (ft *FileTransfer) showTransfer(w http.ResponseWriter, r *http.Request) {
+	t := ft.lookupTransfer(w, r)
+	if t == nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t.snapshot())
+}
+
+// deleteTransfer 取消进行中的传输，已结束的传输返回 409
+func (ft *FileTransfer) deleteTransfer(w http.ResponseWriter, r *http.Request) {
+	t := ft.lookupTransfer(w, r)
+	if t == nil {
+		return
+	}
+	if !ft.transfers.cancelTransfer(t) {
+		http.Error(w, "传输已结束", http.StatusConflict)
+		return
+	}
+
+	info := t.snapshot()
+	logger.LogWarn("🚫 已取消传输: %s (%s, 来自 %s)", info.Name, info.ID, info.Remote)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(info)
+}
+
+// respondCancelled 传输已被取消时写入 410 响应
+func respondCancelled(w http.ResponseWriter, r *http.Request, fileName string) bool {
+	if !transferFrom(r).isCancelled() {
+		return false
+	}
+	logger.LogWarn("上传已取消: %s", fileName)
+	writeError(w, r, http.StatusGone, constants.ErrCodeCancelled, "上传已被取消")
+	return true
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-transfer/internal/constants"
+	"go-transfer/internal/infrastructure/logger"
+)
+
+// listTransfers 读取 GET /transfers 的结果
+func listTransfers(t *testing.T, ft *FileTransfer) []transferInfo {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	ft.handleTransfers(rec, httptest.NewRequest(http.MethodGet, constants.TransfersRoute, nil))
+	var result struct {
+		Transfers []transferInfo `json:"transfers"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("解析传输列表失败: %v: %s", err, rec.Body.String())
+	}
+	return result.Transfers
+}
+
+// transferRequest 对 /transfers/{id} 发起请求
+func transferRequest(ft *FileTransfer, method, id string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	ft.handleTransfer(rec, httptest.NewRequest(method, constants.TransfersRoute+"/"+id, nil))
+	return rec
+}
+
+func TestTransferCancel(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	storage := t.TempDir()
+	ft := &FileTransfer{Mode: "receiver", StoragePath: storage}
+	server, url := startServer(t, ft)
+	defer server.Close()
+
+	// 发送部分数据后保持连接，等待传输出现在列表中
+	body, writer := io.Pipe()
+	defer writer.Close()
+	result := make(chan *http.Response, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodPost, url+"/upload?name=slow.bin", body)
+		req.ContentLength = 4096
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			result <- nil
+			return
+		}
+		result <- resp
+	}()
+	writer.Write([]byte(strings.Repeat("x", 1024)))
+
+	var info transferInfo
+	for i := 0; i < 100; i++ {
+		if list := listTransfers(t, ft); len(list) == 1 && list[0].Bytes == 1024 {
+			info = list[0]
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if info.State != constants.TransferRunning || info.Name != "slow.bin" || info.Total != 4096 || info.Mode != "receiver" {
+		t.Fatalf("进行中的传输 = %+v", info)
+	}
+
+	if rec := transferRequest(ft, http.MethodGet, info.ID); rec.Code != http.StatusOK {
+		t.Errorf("GET 状态码 = %d", rec.Code)
+	}
+	if rec := transferRequest(ft, http.MethodDelete, info.ID); rec.Code != http.StatusAccepted {
+		t.Fatalf("DELETE 状态码 = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	select {
+	case resp := <-result:
+		if resp != nil && resp.StatusCode != http.StatusGone {
+			t.Errorf("被取消的上传状态码 = %d, 期望 %d", resp.StatusCode, http.StatusGone)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("取消后上传请求未结束")
+	}
+
+	// 处理函数结束后传输移入最近结束的列表
+	var list []transferInfo
+	for i := 0; i < 100; i++ {
+		if list = listTransfers(t, ft); len(list) == 1 && list[0].State != constants.TransferRunning {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(list) != 1 || list[0].State != constants.TransferCancelled || list[0].Code != http.StatusGone {
+		t.Errorf("取消后的传输 = %+v", list)
+	}
+	if _, err := os.Stat(stagingPath(filepath.Join(storage, "slow.bin"))); !os.IsNotExist(err) {
+		t.Errorf("暂存文件未删除: %v", err)
+	}
+
+	if rec := transferRequest(ft, http.MethodDelete, info.ID); rec.Code != http.StatusConflict {
+		t.Errorf("重复取消状态码 = %d, 期望 %d", rec.Code, http.StatusConflict)
+	}
+	if rec := transferRequest(ft, http.MethodGet, "missing"); rec.Code != http.StatusNotFound {
+		t.Errorf("不存在的传输状态码 = %d, 期望 %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestTransferCompleted(t *testing.T) {
+	logger.GlobalLogger.SetSilent(true)
+	ft := &FileTransfer{Mode: "receiver", StoragePath: t.TempDir()}
+	upload(ft, "a.txt", "hello", "")
+
+	list := listTransfers(t, ft)
+	if len(list) != 1 || list[0].State != constants.TransferCompleted || list[0].Bytes != 5 || list[0].Code != http.StatusOK || list[0].Finished == nil {
+		t.Errorf("完成的传输 = %+v", list)
+	}
+}